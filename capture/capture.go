@@ -0,0 +1,214 @@
+package capture
+
+import (
+	"bufio"
+	"fmt"
+	"free5gc/src/amf/logger"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const ngapPpid uint32 = 60
+
+// Config is the packet capture configuration
+type Config struct {
+	// File is the path of the capture file; every file of the ring gets a sequence
+	// number and its creation time inserted before the extension
+	File         string
+	MaxFileSize  int64 // a new file is started when the current one exceeds MaxFileSize bytes, 0 for no limit
+	MaxFiles     int   // the oldest files are removed to keep at most MaxFiles files, 0 for no limit
+	NasPlaintext bool  // also capture the plaintext of protected NAS messages
+}
+
+type capturer struct {
+	mutex  sync.Mutex
+	config Config
+	file   *os.File
+	writer *bufio.Writer
+	size   int64
+	seq    int
+	files  []string
+	tsn    uint32
+}
+
+var pcap capturer
+var enabled int32
+var nasPlaintext int32
+
+type endpoint struct {
+	ip   net.IP
+	port int
+}
+
+// endpointOf returns the first IP address and the port of a transport address;
+// SCTP addresses list every address of the endpoint, e.g. "10.0.0.1/10.0.1.1:38412"
+func endpointOf(addr net.Addr) endpoint {
+	ep := endpoint{ip: net.IPv4zero}
+	if addr == nil {
+		return ep
+	}
+	s := addr.String()
+	i := strings.LastIndex(s, ":")
+	if i < 0 {
+		return ep
+	}
+	if ip := net.ParseIP(strings.Trim(strings.Split(s[:i], "/")[0], "[]")); ip != nil {
+		ep.ip = ip
+	}
+	ep.port, _ = strconv.Atoi(s[i+1:])
+	return ep
+}
+
+// Start starts capturing to the files of config; a capture already running is stopped first
+func Start(config Config) error {
+	if config.File == "" {
+		return fmt.Errorf("Capture file is not set")
+	}
+	Stop()
+
+	pcap.mutex.Lock()
+	defer pcap.mutex.Unlock()
+
+	pcap.config = config
+	pcap.files = nil
+	pcap.seq = 0
+	if err := pcap.openFile(); err != nil {
+		return err
+	}
+	if config.NasPlaintext {
+		atomic.StoreInt32(&nasPlaintext, 1)
+	}
+	atomic.StoreInt32(&enabled, 1)
+	logger.CaptureLog.Infof("Capture NGAP to %s", pcap.file.Name())
+	return nil
+}
+
+// Stop stops capturing and closes the current file
+func Stop() {
+	atomic.StoreInt32(&enabled, 0)
+	atomic.StoreInt32(&nasPlaintext, 0)
+
+	pcap.mutex.Lock()
+	defer pcap.mutex.Unlock()
+	pcap.closeFile()
+}
+
+// Enabled reports whether NGAP PDUs are captured
+func Enabled() bool {
+	return atomic.LoadInt32(&enabled) == 1
+}
+
+// NasPlaintextEnabled reports whether the plaintext of protected NAS messages is captured
+func NasPlaintextEnabled() bool {
+	return atomic.LoadInt32(&nasPlaintext) == 1
+}
+
+// Ngap captures an NGAP PDU exchanged on an NGAP association
+func Ngap(local, remote net.Addr, received bool, stream uint16, pdu []byte) {
+	if !Enabled() {
+		return
+	}
+	src, dst := endpointOf(local), endpointOf(remote)
+	if received {
+		src, dst = dst, src
+	}
+
+	pcap.mutex.Lock()
+	defer pcap.mutex.Unlock()
+	pcap.tsn++
+	pcap.write(interfaceNgap, buildSctpPacket(src, dst, stream, pcap.tsn, ngapPpid, pdu), "")
+}
+
+// NasPlaintext captures the plaintext of a protected NAS message, which is carried
+// ciphered in the NGAP PDUs; ueId identifies the UE in the packet comment
+func NasPlaintext(ueId string, uplink bool, pdu []byte) {
+	if !NasPlaintextEnabled() {
+		return
+	}
+	direction := "downlink"
+	if uplink {
+		direction = "uplink"
+	}
+
+	pcap.mutex.Lock()
+	defer pcap.mutex.Unlock()
+	pcap.write(interfaceNas, buildExportedPdu("nas-5gs", pdu),
+		fmt.Sprintf("NAS plaintext, %s, UE %s", direction, ueId))
+}
+
+func (c *capturer) write(interfaceId uint32, data []byte, comment string) {
+	if c.writer == nil {
+		return
+	}
+	if c.config.MaxFileSize > 0 && c.size >= c.config.MaxFileSize {
+		c.closeFile()
+		if err := c.openFile(); err != nil {
+			logger.CaptureLog.Errorf("Capture file error: %+v", err)
+			return
+		}
+	}
+
+	if err := writePacket(c, interfaceId, time.Now(), data, comment); err != nil {
+		logger.CaptureLog.Errorf("Capture write error: %+v", err)
+		return
+	}
+	// a packet is readable from the file as soon as it is captured
+	if err := c.writer.Flush(); err != nil {
+		logger.CaptureLog.Errorf("Capture write error: %+v", err)
+	}
+}
+
+// Write counts the bytes written to the current file
+func (c *capturer) Write(b []byte) (int, error) {
+	n, err := c.writer.Write(b)
+	c.size += int64(n)
+	return n, err
+}
+
+func (c *capturer) openFile() error {
+	c.seq++
+	ext := filepath.Ext(c.config.File)
+	name := fmt.Sprintf("%s_%05d_%s%s", strings.TrimSuffix(c.config.File, ext), c.seq,
+		time.Now().Format("20060102150405"), ext)
+
+	file, err := os.OpenFile(name, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0640)
+	if err != nil {
+		return fmt.Errorf("Open capture file error: %+v", err)
+	}
+	c.file = file
+	c.writer = bufio.NewWriter(file)
+	c.size = 0
+	if err := writeFileHeader(c); err != nil {
+		c.closeFile()
+		return fmt.Errorf("Write capture file error: %+v", err)
+	}
+
+	c.files = append(c.files, name)
+	for c.config.MaxFiles > 0 && len(c.files) > c.config.MaxFiles {
+		if err := os.Remove(c.files[0]); err != nil {
+			logger.CaptureLog.Warnf("Remove capture file error: %+v", err)
+		}
+		c.files = c.files[1:]
+	}
+	return nil
+}
+
+func (c *capturer) closeFile() {
+	if c.file == nil {
+		return
+	}
+	if err := c.writer.Flush(); err != nil {
+		logger.CaptureLog.Errorf("Capture write error: %+v", err)
+	}
+	if err := c.file.Close(); err != nil {
+		logger.CaptureLog.Errorf("Close capture file error: %+v", err)
+	}
+	c.file = nil
+	c.writer = nil
+}
@@ -0,0 +1,73 @@
+package capture
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// blockTypes returns the types of the pcapng blocks of a capture file
+func blockTypes(t *testing.T, b []byte) []uint32 {
+	var types []uint32
+	for len(b) > 0 {
+		require.True(t, len(b) >= 12)
+		blockLen := binary.BigEndian.Uint32(b[4:8])
+		require.True(t, blockLen >= 12 && int(blockLen) <= len(b) && blockLen%4 == 0)
+		require.Equal(t, blockLen, binary.BigEndian.Uint32(b[blockLen-4:blockLen]))
+		types = append(types, binary.BigEndian.Uint32(b[0:4]))
+		b = b[blockLen:]
+	}
+	return types
+}
+
+func TestCapture(t *testing.T) {
+	dir, err := ioutil.TempDir("", "capture")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	require.NoError(t, Start(Config{File: filepath.Join(dir, "amf.pcapng"), MaxFileSize: 400, MaxFiles: 2,
+		NasPlaintext: true}))
+	defer Stop()
+
+	ran := &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 9487}
+	amf := &net.TCPAddr{IP: net.ParseIP("10.0.0.2"), Port: 38412}
+	for i := 0; i < 8; i++ {
+		Ngap(amf, ran, true, 1, []byte{0x00, 0x0f, 0x40, 0x01, 0x02})
+	}
+	NasPlaintext("imsi-208930000000003", true, []byte{0x7e, 0x00, 0x41})
+	Stop()
+
+	files, err := filepath.Glob(filepath.Join(dir, "amf_*.pcapng"))
+	require.NoError(t, err)
+	assert.Len(t, files, 2)
+
+	b, err := ioutil.ReadFile(files[len(files)-1])
+	require.NoError(t, err)
+	types := blockTypes(t, b)
+	require.True(t, len(types) > 3)
+	assert.Equal(t, []uint32{blockTypeSectionHeader, blockTypeInterfaceDescription, blockTypeInterfaceDescription},
+		types[:3])
+	for _, blockType := range types[3:] {
+		assert.Equal(t, blockTypeEnhancedPacket, blockType)
+	}
+}
+
+func TestBuildSctpPacket(t *testing.T) {
+	src := endpointOf(&net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 9487})
+	dst := endpointOf(&net.TCPAddr{IP: net.ParseIP("10.0.0.2"), Port: 38412})
+	packet := buildSctpPacket(src, dst, 3, 1, ngapPpid, []byte{0x00, 0x15, 0x00})
+
+	require.Len(t, packet, 20+12+16+4)
+	assert.Equal(t, uint16(0), ipv4Checksum(packet[:20]))
+	assert.Equal(t, byte(132), packet[9])
+	assert.Equal(t, uint16(9487), binary.BigEndian.Uint16(packet[20:22]))
+	assert.Equal(t, uint16(38412), binary.BigEndian.Uint16(packet[22:24]))
+	assert.Equal(t, uint16(3), binary.BigEndian.Uint16(packet[40:42]))
+	assert.Equal(t, ngapPpid, binary.BigEndian.Uint32(packet[44:48]))
+}
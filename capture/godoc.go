@@ -0,0 +1,3 @@
+// Package capture writes the NGAP PDUs of an AMF instance, and optionally the plaintext of protected NAS messages,
+// to pcapng files which Wireshark dissects
+package capture
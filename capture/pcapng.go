@@ -0,0 +1,198 @@
+package capture
+
+import (
+	"encoding/binary"
+	"io"
+	"time"
+)
+
+// pcapng blocks, https://www.ietf.org/archive/id/draft-tuexen-opsawg-pcapng-05.html
+const (
+	blockTypeSectionHeader        uint32 = 0x0a0d0d0a
+	blockTypeInterfaceDescription uint32 = 0x00000001
+	blockTypeEnhancedPacket       uint32 = 0x00000006
+	byteOrderMagic                uint32 = 0x1a2b3c4d
+
+	optionEndOfOpt uint16 = 0
+	optionComment  uint16 = 1
+	optionIfName   uint16 = 2
+
+	// raw IPv4 or IPv6 packets
+	linkTypeRaw uint16 = 101
+	// PDUs exported by Wireshark, dissected by the protocol named in their header
+	linkTypeWiresharkUpperPdu uint16 = 252
+
+	// exported PDU tags
+	exportedPduTagEndOfOpt  uint16 = 0
+	exportedPduTagProtoName uint16 = 12
+
+	// interfaces of the capture files
+	interfaceNgap uint32 = 0
+	interfaceNas  uint32 = 1
+
+	snapLen uint32 = 262144
+)
+
+// the capture files are written in big endian
+var order = binary.BigEndian
+
+func padLen(n int) int {
+	return (4 - n%4) % 4
+}
+
+// appendOption appends a pcapng option, padded to 32 bits
+func appendOption(b []byte, code uint16, value []byte) []byte {
+	b = appendUint16(b, code)
+	b = appendUint16(b, uint16(len(value)))
+	b = append(b, value...)
+	return append(b, make([]byte, padLen(len(value)))...)
+}
+
+func appendUint16(b []byte, v uint16) []byte {
+	var buf [2]byte
+	order.PutUint16(buf[:], v)
+	return append(b, buf[:]...)
+}
+
+func appendUint32(b []byte, v uint32) []byte {
+	var buf [4]byte
+	order.PutUint32(buf[:], v)
+	return append(b, buf[:]...)
+}
+
+// writeBlock writes a block whose body follows the block type and length
+func writeBlock(w io.Writer, blockType uint32, body []byte) error {
+	blockLen := uint32(12 + len(body))
+	b := make([]byte, 0, blockLen)
+	b = appendUint32(b, blockType)
+	b = appendUint32(b, blockLen)
+	b = append(b, body...)
+	b = appendUint32(b, blockLen)
+	_, err := w.Write(b)
+	return err
+}
+
+// writeFileHeader writes the section header and the interfaces of a capture file
+func writeFileHeader(w io.Writer) error {
+	var body []byte
+	body = appendUint32(body, byteOrderMagic)
+	body = appendUint16(body, 1) // major version
+	body = appendUint16(body, 0) // minor version
+	// section length is not specified
+	body = appendUint32(body, 0xffffffff)
+	body = appendUint32(body, 0xffffffff)
+	body = appendOption(body, optionEndOfOpt, nil)
+	if err := writeBlock(w, blockTypeSectionHeader, body); err != nil {
+		return err
+	}
+
+	interfaces := []struct {
+		linkType uint16
+		name     string
+	}{
+		{linkTypeRaw, "ngap"},                  // interfaceNgap
+		{linkTypeWiresharkUpperPdu, "nas-5gs"}, // interfaceNas
+	}
+	for _, i := range interfaces {
+		body = body[:0]
+		body = appendUint16(body, i.linkType)
+		body = appendUint16(body, 0) // reserved
+		body = appendUint32(body, snapLen)
+		body = appendOption(body, optionIfName, []byte(i.name))
+		body = appendOption(body, optionEndOfOpt, nil)
+		if err := writeBlock(w, blockTypeInterfaceDescription, body); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writePacket writes an enhanced packet block; the timestamp is in microseconds
+func writePacket(w io.Writer, interfaceId uint32, timeStamp time.Time, data []byte, comment string) error {
+	ts := uint64(timeStamp.UnixNano() / int64(time.Microsecond))
+
+	body := make([]byte, 0, 20+len(data)+4+len(comment)+8)
+	body = appendUint32(body, interfaceId)
+	body = appendUint32(body, uint32(ts>>32))
+	body = appendUint32(body, uint32(ts))
+	body = appendUint32(body, uint32(len(data)))
+	body = appendUint32(body, uint32(len(data)))
+	body = append(body, data...)
+	body = append(body, make([]byte, padLen(len(data)))...)
+	if comment != "" {
+		body = appendOption(body, optionComment, []byte(comment))
+		body = appendOption(body, optionEndOfOpt, nil)
+	}
+	return writeBlock(w, blockTypeEnhancedPacket, body)
+}
+
+// buildSctpPacket frames an NGAP message as the IP packet of an SCTP DATA chunk,
+// so that Wireshark dissects it as NGAP (PPID 60); the checksum is not computed
+func buildSctpPacket(src, dst endpoint, stream uint16, tsn uint32, ppid uint32, msg []byte) []byte {
+	chunkLen := 16 + len(msg)
+	sctpLen := 12 + chunkLen + padLen(chunkLen)
+
+	sctp := make([]byte, 0, sctpLen)
+	// common header
+	sctp = appendUint16(sctp, uint16(src.port))
+	sctp = appendUint16(sctp, uint16(dst.port))
+	sctp = appendUint32(sctp, 0) // verification tag
+	sctp = appendUint32(sctp, 0) // checksum
+	// DATA chunk, unfragmented (B and E flags)
+	sctp = append(sctp, 0, 0x03)
+	sctp = appendUint16(sctp, uint16(chunkLen))
+	sctp = appendUint32(sctp, tsn)
+	sctp = appendUint16(sctp, stream)
+	sctp = appendUint16(sctp, 0) // stream sequence number
+	sctp = appendUint32(sctp, ppid)
+	sctp = append(sctp, msg...)
+	sctp = append(sctp, make([]byte, padLen(chunkLen))...)
+
+	srcIPv4, dstIPv4 := src.ip.To4(), dst.ip.To4()
+	if srcIPv4 != nil && dstIPv4 != nil {
+		ip := make([]byte, 20, 20+len(sctp))
+		ip[0] = 0x45 // version 4, header length 20 bytes
+		order.PutUint16(ip[2:4], uint16(20+len(sctp)))
+		ip[8] = 64  // TTL
+		ip[9] = 132 // SCTP
+		copy(ip[12:16], srcIPv4)
+		copy(ip[16:20], dstIPv4)
+		order.PutUint16(ip[10:12], ipv4Checksum(ip))
+		return append(ip, sctp...)
+	}
+
+	ip := make([]byte, 40, 40+len(sctp))
+	ip[0] = 0x60 // version 6
+	order.PutUint16(ip[4:6], uint16(len(sctp)))
+	ip[6] = 132 // SCTP
+	ip[7] = 64  // hop limit
+	copy(ip[8:24], src.ip.To16())
+	copy(ip[24:40], dst.ip.To16())
+	return append(ip, sctp...)
+}
+
+func ipv4Checksum(header []byte) uint16 {
+	var sum uint32
+	for i := 0; i+1 < len(header); i += 2 {
+		sum += uint32(order.Uint16(header[i : i+2]))
+	}
+	for sum > 0xffff {
+		sum = (sum >> 16) + (sum & 0xffff)
+	}
+	return ^uint16(sum)
+}
+
+// buildExportedPdu prefixes a PDU with the exported PDU header naming its dissector
+func buildExportedPdu(protoName string, pdu []byte) []byte {
+	name := []byte(protoName)
+	// the name is NUL terminated and padded to 32 bits
+	name = append(name, make([]byte, 1+padLen(len(name)+1))...)
+
+	b := make([]byte, 0, 8+len(name)+len(pdu))
+	b = appendUint16(b, exportedPduTagProtoName)
+	b = appendUint16(b, uint16(len(name)))
+	b = append(b, name...)
+	b = appendUint16(b, exportedPduTagEndOfOpt)
+	b = appendUint16(b, 0)
+	return append(b, pdu...)
+}
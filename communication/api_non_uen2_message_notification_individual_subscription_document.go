@@ -1,7 +1,11 @@
 package communication
 
 import (
+	"free5gc/lib/http_wrapper"
+	"free5gc/lib/openapi"
+	"free5gc/lib/openapi/models"
 	"free5gc/src/amf/logger"
+	"free5gc/src/amf/producer"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
@@ -9,6 +13,22 @@ import (
 
 // HTTPNonUeN2InfoUnSubscribe is the API callback for the Namf_Communication Non UE N2 Info UnSubscribe service peration
 func HTTPNonUeN2InfoUnSubscribe(c *gin.Context) {
-	logger.CommLog.Warnf("Handle Non Ue N2 Info UnSubscribe is not implemented.")
-	c.JSON(http.StatusOK, gin.H{})
+
+	req := http_wrapper.NewRequest(c.Request, nil)
+	req.Params["n2NotifySubscriptionId"] = c.Params.ByName("n2NotifySubscriptionId")
+
+	rsp := producer.HandleNonUeN2InfoUnSubscribeRequest(req)
+
+	responseBody, err := openapi.Serialize(rsp.Body, "application/json")
+	if err != nil {
+		logger.CommLog.Errorln(err)
+		problemDetails := models.ProblemDetails{
+			Status: http.StatusInternalServerError,
+			Cause:  "SYSTEM_FAILURE",
+			Detail: err.Error(),
+		}
+		c.JSON(http.StatusInternalServerError, problemDetails)
+	} else {
+		c.Data(rsp.Status, "application/json", responseBody)
+	}
 }
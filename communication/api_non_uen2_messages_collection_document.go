@@ -1,14 +1,73 @@
 package communication
 
 import (
+	"fmt"
+	"free5gc/lib/http_wrapper"
+	"free5gc/lib/openapi"
+	"free5gc/lib/openapi/models"
 	"free5gc/src/amf/logger"
+	"free5gc/src/amf/producer"
 	"net/http"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 )
 
 // HTTPNonUeN2MessageTransfer is the API callback for the Namf_Communication Non UE N2 Message Transfer service peration
 func HTTPNonUeN2MessageTransfer(c *gin.Context) {
-	logger.CommLog.Warnf("Handle Non Ue N2 Message Transfer is not implemented.")
-	c.JSON(http.StatusOK, gin.H{})
+	var nonUeN2MessageTransferRequest models.NonUeN2MessageTransferRequest
+	nonUeN2MessageTransferRequest.JsonData = new(models.N2InformationTransferReqData)
+
+	requestBody, err := c.GetRawData()
+	if err != nil {
+		problemDetail := models.ProblemDetails{
+			Title:  "System failure",
+			Status: http.StatusInternalServerError,
+			Detail: err.Error(),
+			Cause:  "SYSTEM_FAILURE",
+		}
+		logger.CommLog.Errorf("Get Request Body error: %+v", err)
+		c.JSON(http.StatusInternalServerError, problemDetail)
+		return
+	}
+
+	contentType := c.GetHeader("Content-Type")
+	s := strings.Split(contentType, ";")
+	switch s[0] {
+	case "application/json":
+		err = fmt.Errorf("N2 information is Empty in NonUeN2MessageTransfer")
+	case "multipart/related":
+		err = openapi.Deserialize(&nonUeN2MessageTransferRequest, requestBody, contentType)
+	default:
+		err = fmt.Errorf("Wrong content type")
+	}
+
+	if err != nil {
+		problemDetail := "[Request Body] " + err.Error()
+		rsp := models.ProblemDetails{
+			Title:  "Malformed request syntax",
+			Status: http.StatusBadRequest,
+			Detail: problemDetail,
+		}
+		logger.CommLog.Errorln(problemDetail)
+		c.JSON(http.StatusBadRequest, rsp)
+		return
+	}
+
+	req := http_wrapper.NewRequest(c.Request, nonUeN2MessageTransferRequest)
+
+	rsp := producer.HandleNonUeN2MessageTransferRequest(req)
+
+	responseBody, err := openapi.Serialize(rsp.Body, "application/json")
+	if err != nil {
+		logger.CommLog.Errorln(err)
+		problemDetails := models.ProblemDetails{
+			Status: http.StatusInternalServerError,
+			Cause:  "SYSTEM_FAILURE",
+			Detail: err.Error(),
+		}
+		c.JSON(http.StatusInternalServerError, problemDetails)
+	} else {
+		c.Data(rsp.Status, "application/json", responseBody)
+	}
 }
@@ -1,7 +1,11 @@
 package communication
 
 import (
+	"free5gc/lib/http_wrapper"
+	"free5gc/lib/openapi"
+	"free5gc/lib/openapi/models"
 	"free5gc/src/amf/logger"
+	"free5gc/src/amf/producer"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
@@ -9,6 +13,51 @@ import (
 
 // HTTPNonUeN2InfoSubscribe is the API callback for the Namf_Communication Non UE N2 Info Subscribe service operation
 func HTTPNonUeN2InfoSubscribe(c *gin.Context) {
-	logger.CommLog.Warnf("Handle Non Ue N2 Info Subscribe is not implemented.")
-	c.JSON(http.StatusOK, gin.H{})
+	var nonUeN2InfoSubscriptionCreateData models.NonUeN2InfoSubscriptionCreateData
+
+	requestBody, err := c.GetRawData()
+	if err != nil {
+		logger.CommLog.Errorf("Get Request Body error: %+v", err)
+		problemDetail := models.ProblemDetails{
+			Title:  "System failure",
+			Status: http.StatusInternalServerError,
+			Detail: err.Error(),
+			Cause:  "SYSTEM_FAILURE",
+		}
+		c.JSON(http.StatusInternalServerError, problemDetail)
+		return
+	}
+
+	err = openapi.Deserialize(&nonUeN2InfoSubscriptionCreateData, requestBody, "application/json")
+	if err != nil {
+		problemDetail := "[Request Body] " + err.Error()
+		rsp := models.ProblemDetails{
+			Title:  "Malformed request syntax",
+			Status: http.StatusBadRequest,
+			Detail: problemDetail,
+		}
+		logger.CommLog.Errorln(problemDetail)
+		c.JSON(http.StatusBadRequest, rsp)
+		return
+	}
+
+	req := http_wrapper.NewRequest(c.Request, nonUeN2InfoSubscriptionCreateData)
+
+	rsp := producer.HandleNonUeN2InfoSubscribeRequest(req)
+
+	for key, val := range rsp.Header {
+		c.Header(key, val[0])
+	}
+	responseBody, err := openapi.Serialize(rsp.Body, "application/json")
+	if err != nil {
+		logger.CommLog.Errorln(err)
+		problemDetails := models.ProblemDetails{
+			Status: http.StatusInternalServerError,
+			Cause:  "SYSTEM_FAILURE",
+			Detail: err.Error(),
+		}
+		c.JSON(http.StatusInternalServerError, problemDetails)
+	} else {
+		c.Data(rsp.Status, "application/json", responseBody)
+	}
 }
@@ -0,0 +1,180 @@
+package consumer
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"free5gc/lib/openapi"
+	"free5gc/lib/openapi/models"
+	amf_context "free5gc/src/amf/context"
+	"free5gc/src/amf/util"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+const (
+	// determineLocationTimeout bounds the positioning of a UE by the LMF
+	determineLocationTimeout = 30 * time.Second
+	lcsPrivacyDataTimeout    = 10 * time.Second
+)
+
+// DetermineLocationRequest is the InputData of the Nlmf_Location DetermineLocation service
+// operation, TS 29.572 6.1.6.2.2
+type DetermineLocationRequest struct {
+	ExternalClientType models.ExternalClientType   `json:"externalClientType,omitempty"`
+	CorrelationID      string                      `json:"correlationID,omitempty"`
+	AmfId              string                      `json:"amfId,omitempty"`
+	LocationQoS        *models.LocationQoS         `json:"locationQoS,omitempty"`
+	SupportedGADShapes []models.SupportedGadShapes `json:"supportedGADShapes,omitempty"`
+	Supi               string                      `json:"supi,omitempty"`
+	Pei                string                      `json:"pei,omitempty"`
+	Gpsi               string                      `json:"gpsi,omitempty"`
+	Ecgi               *models.Ecgi                `json:"ecgi,omitempty"`
+	Ncgi               *models.Ncgi                `json:"ncgi,omitempty"`
+	Priority           models.LcsPriority          `json:"priority,omitempty"`
+	VelocityRequested  models.VelocityRequested    `json:"velocityRequested,omitempty"`
+}
+
+// LocationData is the LocationData of the Nlmf_Location DetermineLocation response, TS 29.572 6.1.6.2.3
+type LocationData struct {
+	LocationEstimate            *models.GeographicArea                 `json:"locationEstimate,omitempty"`
+	AccuracyFulfilmentIndicator models.AccuracyFulfilmentIndicator     `json:"accuracyFulfilmentIndicator,omitempty"`
+	AgeOfLocationEstimate       int32                                  `json:"ageOfLocationEstimate,omitempty"`
+	VelocityEstimate            *models.VelocityEstimate               `json:"velocityEstimate,omitempty"`
+	CivicAddress                *models.CivicAddress                   `json:"civicAddress,omitempty"`
+	PositioningDataList         []models.PositioningMethodAndUsage     `json:"positioningDataList,omitempty"`
+	GnssPositioningDataList     []models.GnssPositioningMethodAndUsage `json:"gnssPositioningDataList,omitempty"`
+	Ecgi                        *models.Ecgi                           `json:"ecgi,omitempty"`
+	Ncgi                        *models.Ncgi                           `json:"ncgi,omitempty"`
+	Altitude                    float64                                `json:"altitude,omitempty"`
+	BarometricPressure          int32                                  `json:"barometricPressure,omitempty"`
+}
+
+// SendDetermineLocation asks the LMF of the UE to position it
+func SendDetermineLocation(ue *amf_context.AmfUe, request DetermineLocationRequest) (
+	locationData *LocationData, problemDetails *models.ProblemDetails, err error) {
+	body, err := openapi.Serialize(request, "application/json")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// there is no generated client for the Nlmf_Location service
+	ctx, cancel := context.WithTimeout(context.Background(), determineLocationTimeout)
+	defer cancel()
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, ue.LmfUri+"/nlmf-loc/v1/determine-location",
+		bytes.NewReader(body))
+	if err != nil {
+		return nil, nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	httpResp, err := util.SbiClient().Do(httpReq)
+	if err != nil {
+		return nil, nil, openapi.ReportError("%s: server no response", ue.LmfUri)
+	}
+	defer httpResp.Body.Close()
+
+	rspBody, err := ioutil.ReadAll(httpResp.Body)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	switch {
+	case httpResp.StatusCode == http.StatusOK:
+		locationData = new(LocationData)
+		if err := openapi.Deserialize(locationData, rspBody, "application/json"); err != nil {
+			return nil, nil, err
+		}
+		return locationData, nil, nil
+	case httpResp.StatusCode >= http.StatusBadRequest:
+		problemDetails = new(models.ProblemDetails)
+		// the status is taken from the response when the problem details do not carry it
+		if err := openapi.Deserialize(problemDetails, rspBody, "application/json"); err != nil ||
+			problemDetails.Status == 0 {
+			problemDetails.Status = int32(httpResp.StatusCode)
+		}
+		return nil, problemDetails, nil
+	default:
+		return nil, nil, fmt.Errorf("Unexpected DetermineLocation response status: %s", httpResp.Status)
+	}
+}
+
+// LcsPrivacyData is the LCS privacy subscription data of a UE, TS 29.503 6.1.6.2.59; only the
+// attributes which the AMF checks are decoded
+type LcsPrivacyData struct {
+	Lpi                 *Lpi                `json:"lpi,omitempty"`
+	UnrelatedClass      *UnrelatedClass     `json:"unrelatedClass,omitempty"`
+	PlmnOperatorClasses []PlmnOperatorClass `json:"plmnOperatorClasses,omitempty"`
+}
+
+// Lpi is the location privacy indication of a UE, TS 29.503 6.1.6.2.60
+type Lpi struct {
+	LocationPrivacyInd string `json:"locationPrivacyInd"`
+}
+
+// UnrelatedClass is the privacy class of the LCS clients unrelated to the UE, TS 29.503 6.1.6.2.61
+type UnrelatedClass struct {
+	DefaultUnrelatedClass DefaultUnrelatedClass `json:"defaultUnrelatedClass"`
+}
+
+// DefaultUnrelatedClass is the default privacy of the unrelated LCS clients, TS 29.503 6.1.6.2.63
+type DefaultUnrelatedClass struct {
+	PrivacyCheckRelatedAction string `json:"privacyCheckRelatedAction,omitempty"`
+}
+
+// PlmnOperatorClass is a class of PLMN operator LCS clients allowed to locate the UE, TS 29.503 6.1.6.2.62
+type PlmnOperatorClass struct {
+	LcsClientClass string   `json:"lcsClientClass"`
+	LcsClientIds   []string `json:"lcsClientIds"`
+}
+
+const (
+	LocationPrivacyIndDisallowed                   = "LOCATION_DISALLOWED"
+	PrivacyCheckLocationAllowedWithoutNotification = "LOCATION_ALLOWED_WITHOUT_NOTIFICATION"
+)
+
+// SDMGetLcsPrivacyData retrieves the LCS privacy data of the UE from its UDM, for which there is no
+// generated client; the data is nil when the UE has none
+func SDMGetLcsPrivacyData(ue *amf_context.AmfUe) (
+	lcsPrivacyData *LcsPrivacyData, problemDetails *models.ProblemDetails, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), lcsPrivacyDataTimeout)
+	defer cancel()
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet,
+		ue.NudmSDMUri+"/nudm-sdm/v1/"+ue.Supi+"/lcs-privacy-data", nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	httpResp, err := util.SbiClient().Do(httpReq)
+	if err != nil {
+		return nil, nil, openapi.ReportError("%s: server no response", ue.NudmSDMUri)
+	}
+	defer httpResp.Body.Close()
+
+	rspBody, err := ioutil.ReadAll(httpResp.Body)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	switch {
+	case httpResp.StatusCode == http.StatusOK:
+		lcsPrivacyData = new(LcsPrivacyData)
+		if err := openapi.Deserialize(lcsPrivacyData, rspBody, "application/json"); err != nil {
+			return nil, nil, err
+		}
+		return lcsPrivacyData, nil, nil
+	case httpResp.StatusCode == http.StatusNotFound:
+		return nil, nil, nil
+	case httpResp.StatusCode >= http.StatusBadRequest:
+		problemDetails = new(models.ProblemDetails)
+		// the status is taken from the response when the problem details do not carry it
+		if err := openapi.Deserialize(problemDetails, rspBody, "application/json"); err != nil ||
+			problemDetails.Status == 0 {
+			problemDetails.Status = int32(httpResp.StatusCode)
+		}
+		return nil, problemDetails, nil
+	default:
+		return nil, nil, fmt.Errorf("Unexpected LCS privacy data response status: %s", httpResp.Status)
+	}
+}
@@ -100,3 +100,48 @@ func SearchAmfCommunicationInstance(ue *amf_context.AmfUe, nrfUri string, target
 	}
 	return
 }
+
+func SearchLmfLocationInstance(ue *amf_context.AmfUe, nrfUri string, targetNfType, requestNfType models.NfType,
+	param *Nnrf_NFDiscovery.SearchNFInstancesParamOpts) error {
+
+	resp, localErr := SendSearchNFInstances(nrfUri, targetNfType, requestNfType, param)
+	if localErr != nil {
+		return localErr
+	}
+
+	// select the first LMF, TODO: select base on other info
+	var lmfUri string
+	for _, nfProfile := range resp.NfInstances {
+		ue.LmfId = nfProfile.NfInstanceId
+		lmfUri = util.SearchNFServiceUri(nfProfile, models.ServiceName_NLMF_LOC, models.NfServiceStatus_REGISTERED)
+		if lmfUri != "" {
+			break
+		}
+	}
+	ue.LmfUri = lmfUri
+	if ue.LmfUri == "" {
+		return fmt.Errorf("AMF can not select an LMF by NRF")
+	}
+	return nil
+}
+
+// SearchDefaultN1MessageConsumer discovers the NF instances which consume the N1 messages of a class by default, and
+// returns the callback URI of the first default notification subscription for the class
+func SearchDefaultN1MessageConsumer(nrfUri string, targetNfType, requestNfType models.NfType,
+	n1MessageClass models.N1MessageClass, param *Nnrf_NFDiscovery.SearchNFInstancesParamOpts) (string, error) {
+
+	resp, localErr := SendSearchNFInstances(nrfUri, targetNfType, requestNfType, param)
+	if localErr != nil {
+		return "", localErr
+	}
+
+	for _, nfProfile := range resp.NfInstances {
+		for _, subscription := range nfProfile.DefaultNotificationSubscriptions {
+			if subscription.NotificationType == models.NotificationType_N1_MESSAGES &&
+				subscription.N1MessageClass == n1MessageClass && subscription.CallbackUri != "" {
+				return subscription.CallbackUri, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("AMF can not select a default consumer of %s N1 messages by NRF", n1MessageClass)
+}
@@ -18,6 +18,7 @@ func BuildNFInstance(context *amf_context.AMFContext) (profile models.NfProfile,
 	profile.NfInstanceId = context.NfId
 	profile.NfType = models.NfType_AMF
 	profile.NfStatus = models.NfStatus_REGISTERED
+	profile.Capacity = int32(context.GetRelativeCapacity())
 	var plmns []models.PlmnId
 	for _, plmnItem := range context.PlmnSupportList {
 		plmns = append(plmns, plmnItem.PlmnId)
@@ -130,3 +131,30 @@ func SendDeregisterNFInstance() (problemDetails *models.ProblemDetails, err erro
 	}
 	return
 }
+
+func SendUpdateNFInstance(patchItem []models.PatchItem) (
+	nfProfile models.NfProfile, problemDetails *models.ProblemDetails, err error) {
+
+	logger.ConsumerLog.Debugf("[AMF] Send Update NFInstance")
+
+	amfSelf := amf_context.AMF_Self()
+	// Set client and set url
+	configuration := Nnrf_NFManagement.NewConfiguration()
+	configuration.SetBasePath(amfSelf.NrfUri)
+	client := Nnrf_NFManagement.NewAPIClient(configuration)
+
+	var res *http.Response
+	nfProfile, res, err = client.NFInstanceIDDocumentApi.UpdateNFInstance(context.Background(), amfSelf.NfId, patchItem)
+	if err == nil {
+		return
+	} else if res != nil {
+		if res.Status != err.Error() {
+			return
+		}
+		problem := err.(openapi.GenericOpenAPIError).Model().(models.ProblemDetails)
+		problemDetails = &problem
+	} else {
+		err = openapi.ReportError("server no response")
+	}
+	return
+}
@@ -6,6 +6,7 @@ import (
 	"free5gc/lib/openapi/Nsmf_PDUSession"
 	"free5gc/lib/openapi/models"
 	amf_context "free5gc/src/amf/context"
+	"free5gc/src/amf/logger"
 	"strconv"
 )
 
@@ -155,6 +156,36 @@ func SendUpdateSmContextDeactivateUpCnxState(ue *amf_context.AmfUe, pduSessionId
 	updateData := BuildUpdateSmContextRequset(ue, UpdateSmContextPresentDeactivateUpCnxState, pduSessionId, param)
 	return SendUpdateSmContextRequest(ue, smContext.SmfUri, smContext.PduSessionContext.SmContextRef, updateData, nil, nil)
 }
+
+// SendUpdateSmContextDeactivateUpCnxStateAsync requests the deactivation of the user plane connection like
+// SendUpdateSmContextDeactivateUpCnxState without waiting for the SMF. The request is built from the UE
+// context before it returns, the failures of the request are only logged.
+func SendUpdateSmContextDeactivateUpCnxStateAsync(ue *amf_context.AmfUe, pduSessionId int32,
+	cause amf_context.CauseAll) {
+	smContext, ok := ue.SmContextList[pduSessionId]
+	if !ok {
+		logger.ConsumerLog.Errorf("pduSessionId : %d is not in Ue", pduSessionId)
+		return
+	}
+	param := updateSmContextRequsetParam{
+		cause: cause,
+	}
+	updateData := BuildUpdateSmContextRequset(ue, UpdateSmContextPresentDeactivateUpCnxState, pduSessionId, param)
+	ueLocation := *updateData.UeLocation
+	updateData.UeLocation = &ueLocation
+	smfUri := smContext.SmfUri
+	smContextRef := smContext.PduSessionContext.SmContextRef
+
+	go func() {
+		response, _, _, err := SendUpdateSmContextRequest(ue, smfUri, smContextRef, updateData, nil, nil)
+		if err != nil {
+			logger.ConsumerLog.Errorf("Send Update SmContextDeactivate UpCnxState Error[%s]", err.Error())
+		} else if response == nil {
+			logger.ConsumerLog.Errorln("Send Update SmContextDeactivate UpCnxState Error")
+		}
+	}()
+}
+
 func SendUpdateSmContextChangeAccessType(ue *amf_context.AmfUe, pduSessionId int32, anTypeCanBeChanged bool) (
 	*models.UpdateSmContextResponse, *models.UpdateSmContextErrorResponse, *models.ProblemDetails, error) {
 	smContext, ok := ue.SmContextList[pduSessionId]
@@ -42,6 +42,9 @@ func SDMGetAmData(ue *amf_context.AmfUe) (problemDetails *models.ProblemDetails,
 	if localErr == nil {
 		ue.AccessAndMobilitySubscriptionData = &data
 		ue.Gpsi = data.Gpsis[0] // TODO: select GPSI
+		if len(data.InternalGroupIds) > 0 {
+			ue.GroupID = data.InternalGroupIds[0]
+		}
 	} else if httpResp != nil {
 		if httpResp.Status != localErr.Error() {
 			err = localErr
@@ -114,8 +117,9 @@ func SDMSubscribe(ue *amf_context.AmfUe) (problemDetails *models.ProblemDetails,
 
 	amfSelf := amf_context.AMF_Self()
 	sdmSubscription := models.SdmSubscription{
-		NfInstanceId: amfSelf.NfId,
-		PlmnId:       &ue.PlmnId,
+		NfInstanceId:      amfSelf.NfId,
+		PlmnId:            &ue.PlmnId,
+		CallbackReference: amfSelf.GetIPv4Uri() + "/namf-callback/v1/sdm-notify/" + ue.Supi,
 	}
 
 	_, httpResp, localErr := client.SubscriptionCreationApi.Subscribe(context.Background(), ue.Supi, sdmSubscription)
@@ -0,0 +1,82 @@
+package consumer
+
+import (
+	"context"
+	"free5gc/lib/openapi"
+	"free5gc/lib/openapi/Npcf_UEPolicy"
+	"free5gc/lib/openapi/models"
+	amf_context "free5gc/src/amf/context"
+	"free5gc/src/amf/logger"
+	"regexp"
+)
+
+// UEPolicyControlCreate creates the UE policy association of the UE with the PCF, which then delivers the
+// UE policy containers to the UE by N1N2 message transfers (TS 23.502 4.16.11)
+func UEPolicyControlCreate(ue *amf_context.AmfUe, anType models.AccessType) (*models.ProblemDetails, error) {
+
+	configuration := Npcf_UEPolicy.NewConfiguration()
+	configuration.SetBasePath(ue.PcfUri)
+	client := Npcf_UEPolicy.NewAPIClient(configuration)
+
+	amfSelf := amf_context.AMF_Self()
+
+	policyAssociationRequest := models.UePolicyAssociationRequest{
+		NotificationUri: amfSelf.GetIPv4Uri() + "/namf-callback/v1/ue-policy/",
+		Supi:            ue.Supi,
+		Pei:             ue.Pei,
+		Gpsi:            ue.Gpsi,
+		AccessType:      anType,
+		ServingPlmn: &models.NetworkId{
+			Mcc: ue.PlmnId.Mcc,
+			Mnc: ue.PlmnId.Mnc,
+		},
+		Guami: &amfSelf.ServedGuamiList[0],
+	}
+
+	res, httpResp, localErr := client.DefaultApi.PoliciesPost(context.Background(), policyAssociationRequest)
+	if localErr == nil {
+		locationHeader := httpResp.Header.Get("Location")
+		logger.ConsumerLog.Debugf("location header: %+v", locationHeader)
+		ue.UePolicyUri = locationHeader
+
+		re := regexp.MustCompile("/policies/.*")
+		match := re.FindStringSubmatch(locationHeader)
+
+		ue.UePolicyAssociationId = match[0][10:]
+		ue.UePolicyAssociation = &res
+
+		logger.ConsumerLog.Debugf("UE Policy Association ID: %s", ue.UePolicyAssociationId)
+	} else if httpResp != nil {
+		if httpResp.Status != localErr.Error() {
+			return nil, localErr
+		}
+		problem := localErr.(openapi.GenericOpenAPIError).Model().(models.ProblemDetails)
+		return &problem, nil
+	} else {
+		return nil, openapi.ReportError("server no response")
+	}
+	return nil, nil
+}
+
+func UEPolicyControlDelete(ue *amf_context.AmfUe) (problemDetails *models.ProblemDetails, err error) {
+
+	configuration := Npcf_UEPolicy.NewConfiguration()
+	configuration.SetBasePath(ue.PcfUri)
+	client := Npcf_UEPolicy.NewAPIClient(configuration)
+
+	httpResp, localErr := client.DefaultApi.PoliciesPolAssoIdDelete(context.Background(), ue.UePolicyAssociationId)
+	if localErr == nil {
+		ue.RemoveUePolicyAssociation()
+	} else if httpResp != nil {
+		if httpResp.Status != localErr.Error() {
+			err = localErr
+			return
+		}
+		problem := localErr.(openapi.GenericOpenAPIError).Model().(models.ProblemDetails)
+		problemDetails = &problem
+	} else {
+		err = openapi.ReportError("server no response")
+	}
+
+	return
+}
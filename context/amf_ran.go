@@ -7,6 +7,7 @@ import (
 	"free5gc/lib/openapi/models"
 	"free5gc/src/amf/logger"
 	"net"
+	"sync"
 )
 
 const (
@@ -22,11 +23,20 @@ type AmfRan struct {
 	AnType     models.AccessType
 	/* socket Connect*/
 	Conn net.Conn
+	/* SCTP outbound streams negotiated with the RAN, 0 if not known */
+	OutboundStreams uint16
+	/* NG Setup accepted by the RAN admission policy */
+	Admitted bool
 	/* Supported TA List */
 	SupportedTAList []SupportedTAI
 
 	/* RAN UE List */
 	RanUeList []*RanUe // RanUeNgapId as key
+	// NGAP messages of different UEs are handled concurrently
+	ranUeListMutex sync.RWMutex
+
+	/* outbound NGAP messages */
+	sender ranSender
 }
 
 type SupportedTAI struct {
@@ -54,21 +64,49 @@ func (ran *AmfRan) NewRanUe(ranUeNgapID int64) (*RanUe, error) {
 	ranUe.AmfUeNgapId = amfUeNgapID
 	ranUe.RanUeNgapId = ranUeNgapID
 	ranUe.Ran = ran
+	ranUe.Stream = ran.UeStream(amfUeNgapID)
 
+	ran.ranUeListMutex.Lock()
 	ran.RanUeList = append(ran.RanUeList, &ranUe)
+	ran.ranUeListMutex.Unlock()
 	self.RanUePool.Store(ranUe.AmfUeNgapId, &ranUe)
 	return &ranUe, nil
 }
 
+// UeStream returns the SCTP stream of the UE-associated signalling of a UE. Stream 0
+// is kept for non-UE-associated signalling (TS 38.412 7), the UEs are spread over
+// the other streams, and a UE stays on the same stream for the life of its NGAP IDs.
+func (ran *AmfRan) UeStream(amfUeNgapID int64) uint16 {
+	numOfStreams := ran.OutboundStreams
+	if numOfStreams == 0 {
+		numOfStreams = AMF_Self().NgapTransportOptions.NumOutStreams
+	}
+	if numOfStreams <= 1 {
+		return 0
+	}
+	return uint16(1 + amfUeNgapID%int64(numOfStreams-1))
+}
+
 func (ran *AmfRan) RemoveAllUeInRan() {
-	for _, ranUe := range ran.RanUeList {
+	for _, ranUe := range ran.RanUeListSnapshot() {
 		if err := ranUe.Remove(); err != nil {
 			logger.ContextLog.Errorf("Remove RanUe error: %v", err)
 		}
 	}
 }
 
+// RanUeListSnapshot returns a copy of RanUeList, which may be iterated while UEs are removed
+func (ran *AmfRan) RanUeListSnapshot() []*RanUe {
+	ran.ranUeListMutex.RLock()
+	defer ran.ranUeListMutex.RUnlock()
+	ranUeList := make([]*RanUe, len(ran.RanUeList))
+	copy(ranUeList, ran.RanUeList)
+	return ranUeList
+}
+
 func (ran *AmfRan) RanUeFindByRanUeNgapID(ranUeNgapID int64) *RanUe {
+	ran.ranUeListMutex.RLock()
+	defer ran.ranUeListMutex.RUnlock()
 	for _, ranUe := range ran.RanUeList {
 		if ranUe.RanUeNgapId == ranUeNgapID {
 			return ranUe
@@ -77,6 +115,17 @@ func (ran *AmfRan) RanUeFindByRanUeNgapID(ranUeNgapID int64) *RanUe {
 	return nil
 }
 
+func (ran *AmfRan) RanUeFindByAmfUeNgapID(amfUeNgapID int64) *RanUe {
+	ran.ranUeListMutex.RLock()
+	defer ran.ranUeListMutex.RUnlock()
+	for _, ranUe := range ran.RanUeList {
+		if ranUe.AmfUeNgapId == amfUeNgapID {
+			return ranUe
+		}
+	}
+	return nil
+}
+
 func (ran *AmfRan) SetRanId(ranNodeId *ngapType.GlobalRANNodeID) {
 	ranId := ngapConvert.RanIdToModels(*ranNodeId)
 	ran.RanPresent = ranNodeId.Present
@@ -80,6 +80,9 @@ type AmfUe struct {
 	LocationChanged          bool
 	LastVisitedRegisteredTai models.Tai
 	TimeZone                 string
+	/* context about lmf */
+	LmfId  string
+	LmfUri string
 	/* context about udm */
 	UdmId                             string
 	NudmUECMUri                       string
@@ -111,6 +114,10 @@ type AmfUe struct {
 	AmPolicyAssociation          *models.PolicyAssociation
 	RequestTriggerLocationChange bool // true if AmPolicyAssociation.Trigger contains RequestTrigger_LOC_CH
 	ConfigurationUpdateMessage   []byte
+	/* context about UE policy */
+	UePolicyAssociationId string
+	UePolicyUri           string
+	UePolicyAssociation   *models.UePolicyAssociation
 	/* UeContextForHandover*/
 	HandoverNotifyUri string
 	/* N1N2Message */
@@ -119,11 +126,20 @@ type AmfUe struct {
 	N1N2MessageSubscribeIDGenerator *idgenerator.IDGenerator
 	// map[int64]models.UeN1N2InfoSubscriptionCreateData; use n1n2MessageSubscriptionID as key
 	N1N2MessageSubscription sync.Map
+	// transfers held until the UE is CM-CONNECTED, in order, see HoldN1N2Message
+	PendingN1N2Messages []*N1N2Message
+	n1n2MessageMutex    sync.Mutex
+	/* Location Reporting */
+	// map[string]*LocationReporting; use the id of the NF request as key
+	LocationReportings     sync.Map
+	locationReportingMutex sync.Mutex
 	/* Pdu Sesseion */
 	StoredSmContext map[int32]*StoredSmContext // for DUPLICATE PDU Session ID
 	SmContextList   map[int32]*SmContext
 	/* Related Context*/
 	RanUe map[models.AccessType]*RanUe
+	// held while the UE is handled by an NGAP worker, see Lock
+	ngapMutex sync.Mutex
 	/* other */
 	OnGoing                       map[models.AccessType]*OnGoing
 	UeRadioCapability             string // OCTET string
@@ -161,6 +177,14 @@ type AmfUe struct {
 	/* T3513(Paging) */
 	T3513           *time.Timer // for paging
 	T3513RetryTimes int
+	/* closed when the paging ends, see PagingDone */
+	pagingDone  chan struct{}
+	pagingMutex sync.Mutex
+	/* Mobile reachable timer, running while the UE is CM-IDLE over 3GPP access */
+	MobileReachableTimer *time.Timer
+	/* Last communication failure and loss of connectivity, for the event reports */
+	CommFailure         *models.CommunicationFailure
+	LossOfConnectReason models.LossOfConnectivityReason
 	/* T3565(Notification) */
 	T3565           *time.Timer // for NAS Notification
 	T3565RetryTimes int
@@ -186,11 +210,18 @@ type AmfUeEventSubscription struct {
 	AnyUe             bool
 	RemainReports     *int32
 	EventSubscription *models.AmfEventSubscription
+	// last presence of the UE in the areas of the events, see UpdatePresence
+	PresenceStates map[string]models.PresenceState
+	// number of UEs in the areas of the UES_IN_AREA_REPORT event, shared by the UEs of the subscription
+	uesInArea *int32
 }
 type N1N2Message struct {
 	Request     models.N1N2MessageTransferRequest
 	Status      models.N1N2MessageTransferCause
 	ResourceUri string
+	// id of a held transfer, which fails at expiry
+	ID     int64
+	expiry *time.Timer
 }
 type OnGoing struct {
 	Procedure OnGoingProcedure
@@ -263,6 +294,39 @@ func (ue *AmfUe) init() {
 	ue.ReleaseCause = make(map[models.AccessType]*CauseAll)
 }
 
+// Lock serializes the NGAP handling of the UE. The N2 connections of a UE (handover source and
+// target, 3GPP and non-3GPP accesses) are handled by different NGAP workers, which hold the lock
+// while they handle a message of the UE.
+func (ue *AmfUe) Lock() {
+	ue.ngapMutex.Lock()
+}
+
+// Unlock releases the lock taken by Lock
+func (ue *AmfUe) Unlock() {
+	ue.ngapMutex.Unlock()
+}
+
+// PagingDone returns a channel which is closed when the paging of the UE ends, because
+// the UE is CM-CONNECTED over 3GPP access or the paging is abandoned
+func (ue *AmfUe) PagingDone() <-chan struct{} {
+	ue.pagingMutex.Lock()
+	defer ue.pagingMutex.Unlock()
+	if ue.pagingDone == nil {
+		ue.pagingDone = make(chan struct{})
+	}
+	return ue.pagingDone
+}
+
+// EndPaging wakes up the waiters of PagingDone
+func (ue *AmfUe) EndPaging() {
+	ue.pagingMutex.Lock()
+	defer ue.pagingMutex.Unlock()
+	if ue.pagingDone != nil {
+		close(ue.pagingDone)
+		ue.pagingDone = nil
+	}
+}
+
 func (ue *AmfUe) CmConnect(anType models.AccessType) bool {
 	if _, ok := ue.RanUe[anType]; !ok {
 		return false
@@ -280,19 +344,52 @@ func (ue *AmfUe) Remove() {
 			logger.ContextLog.Errorf("Remove RanUe error: %v", err)
 		}
 	}
+	for _, ueSubscription := range ue.EventSubscriptionsInfo {
+		ueSubscription.leaveAreas()
+	}
+	ue.stopTimers()
 	tmsiGenerator.FreeID(int64(ue.Tmsi))
 	if len(ue.Supi) > 0 {
 		AMF_Self().UePool.Delete(ue.Supi)
 	}
 }
 
+// stopTimers stops the timers of a removed UE, and drops the N1N2 messages held for it
+func (ue *AmfUe) stopTimers() {
+	for _, timer := range []**time.Timer{&ue.T3513, &ue.T3565, &ue.T3560, &ue.T3550, &ue.T3522} {
+		if *timer != nil {
+			(*timer).Stop()
+			*timer = nil
+		}
+	}
+	ue.EndPaging()
+	ue.StopMobileReachableTimer()
+	ue.TakePendingN1N2Messages()
+}
+
 func (ue *AmfUe) DetachRanUe(anType models.AccessType) {
+	if _, ok := ue.RanUe[anType]; !ok {
+		return
+	}
 	delete(ue.RanUe, anType)
+	ue.NotifyEvent(models.AmfEventType_CONNECTIVITY_STATE_REPORT)
+	if anType == models.AccessType__3_GPP_ACCESS && ue.State[anType].Is(Registered) {
+		ue.StartMobileReachableTimer()
+	}
 }
 
 func (ue *AmfUe) AttachRanUe(ranUe *RanUe) {
+	cmIdle := ue.CmIdle(ranUe.Ran.AnType)
 	ue.RanUe[ranUe.Ran.AnType] = ranUe
 	ranUe.AmfUe = ue
+	if cmIdle {
+		ue.NotifyEvent(models.AmfEventType_CONNECTIVITY_STATE_REPORT)
+	}
+	if ranUe.Ran.AnType == models.AccessType__3_GPP_ACCESS {
+		ue.StopMobileReachableTimer()
+		ue.SetReachability(models.UeReachability_REACHABLE)
+		ue.EndPaging()
+	}
 }
 
 func (ue *AmfUe) GetAnType() models.AccessType {
@@ -546,6 +643,12 @@ func (ue *AmfUe) RemoveAmPolicyAssociation() {
 	ue.PolicyAssociationId = ""
 }
 
+func (ue *AmfUe) RemoveUePolicyAssociation() {
+	ue.UePolicyAssociation = nil
+	ue.UePolicyAssociationId = ""
+	ue.UePolicyUri = ""
+}
+
 func (ue *AmfUe) CopyDataFromUeContextModel(ueContext models.UeContext) {
 	if ueContext.Supi != "" {
 		ue.Supi = ueContext.Supi
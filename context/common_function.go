@@ -1,6 +1,7 @@
 package context
 
 import (
+	"encoding/hex"
 	"free5gc/lib/openapi/models"
 	"free5gc/src/amf/logger"
 	"reflect"
@@ -88,3 +89,14 @@ func DetachSourceUeTargetUe(ranUe *RanUe) {
 	}
 
 }
+
+// LmfRoutingID returns the Routing ID (TS 38.413 9.3.3.13) identifying the LMF of an NF instance ID
+// in the NG-RAN, as a hex string like RanUe.RoutingID
+func LmfRoutingID(lmfId string) string {
+	return hex.EncodeToString([]byte(lmfId))
+}
+
+// LmfIdOfRoutingID returns the NF instance ID of the LMF identified by a Routing ID
+func LmfIdOfRoutingID(routingID []byte) string {
+	return string(routingID)
+}
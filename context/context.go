@@ -4,7 +4,9 @@ import (
 	"fmt"
 	"free5gc/lib/idgenerator"
 	"free5gc/lib/openapi/models"
+	"free5gc/src/amf/capture"
 	"free5gc/src/amf/logger"
+	ngap_service "free5gc/src/amf/ngap/service"
 	"math"
 	"net"
 	"reflect"
@@ -17,11 +19,13 @@ import (
 var amfContext = AMFContext{}
 var tmsiGenerator *idgenerator.IDGenerator = nil
 var amfUeNGAPIDGenerator *idgenerator.IDGenerator = nil
-var amfStatusSubscriptionIDGenerator *idgenerator.IDGenerator = nil
+var amfStatusSubscriptionIDGenerator *ReservableIDGenerator = nil
+var nonUeN2InfoSubscriptionIDGenerator *idgenerator.IDGenerator = nil
 
 func init() {
 	AMF_Self().LadnPool = make(map[string]*LADN)
-	AMF_Self().EventSubscriptionIDGenerator = idgenerator.NewGenerator(1, math.MaxInt32)
+	AMF_Self().PresenceReportingAreas = make(map[string]models.PresenceInfo)
+	AMF_Self().EventSubscriptionIDGenerator = NewReservableIDGenerator(1, math.MaxInt32)
 	AMF_Self().Name = "amf"
 	AMF_Self().UriScheme = models.UriScheme_HTTPS
 	AMF_Self().RelativeCapacity = 0xff
@@ -30,18 +34,20 @@ func init() {
 	AMF_Self().NfService = make(map[models.ServiceName]models.NfService)
 	AMF_Self().NetworkName.Full = "free5GC"
 	tmsiGenerator = idgenerator.NewGenerator(1, math.MaxInt32)
-	amfStatusSubscriptionIDGenerator = idgenerator.NewGenerator(1, math.MaxInt32)
+	amfStatusSubscriptionIDGenerator = NewReservableIDGenerator(1, math.MaxInt32)
+	nonUeN2InfoSubscriptionIDGenerator = idgenerator.NewGenerator(1, math.MaxInt32)
 	amfUeNGAPIDGenerator = idgenerator.NewGenerator(1, MaxValueOfAmfUeNgapId)
 }
 
 type AMFContext struct {
-	EventSubscriptionIDGenerator    *idgenerator.IDGenerator
+	EventSubscriptionIDGenerator    *ReservableIDGenerator
 	EventSubscriptions              sync.Map
 	UePool                          sync.Map         // map[supi]*AmfUe
 	RanUePool                       sync.Map         // map[AmfUeNgapID]*RanUe
 	AmfRanPool                      sync.Map         // map[net.Conn]*AmfRan
 	LadnPool                        map[string]*LADN // dnn as key
 	SupportTaiLists                 []models.Tai
+	PresenceReportingAreas          map[string]models.PresenceInfo // pra id as key
 	ServedGuamiList                 []models.Guami
 	PlmnSupportList                 []PlmnSupportItem
 	RelativeCapacity                int64
@@ -59,7 +65,23 @@ type AMFContext struct {
 	NrfUri                          string
 	SecurityAlgorithm               SecurityAlgorithm
 	NetworkName                     NetworkName
+	RanEventLog                     ranEventLog
+	NgapPort                        int                           // SCTP or TCP port of the NGAP listeners
+	NgapAddressSets                 [][]string                    // addresses of each NGAP listener
+	NgapTransportOptions            ngap_service.TransportOptions // association parameters of the NGAP listeners
+	CaptureConfig                   capture.Config
+	SubscriptionStore               SubscriptionStore
+	RanAdmissionPolicy              RanAdmissionPolicy
+	OverloadControl                 OverloadControl
+	NonUeN2InfoSubscriptions        sync.Map
+	PwsTransactions                 sync.Map
 	NgapIpList                      []string // NGAP Server IP
+	NgapTransport                   string   // sctp, tcp or pipe
+	NgapUeQueueSize                 int      // inbound queue length of each per-UE NGAP worker
+	NgapRanQueueSize                int      // inbound queue length of each per-RAN NGAP worker
+	NgapMaxMessageSize              int      // largest NGAP message accepted, in bytes
+	NgapSendQueueSize               int      // outbound queue length of each RAN
+	NgapWriteTimeout                int      // unit is millisecond
 	T3502Value                      int      // unit is second
 	T3512Value                      int      // unit is second
 	Non3gppDeregistrationTimerValue int      // unit is second
@@ -71,6 +93,12 @@ type AMFContextEventSubscription struct {
 	UeSupiList        []string
 	Expiry            *time.Time
 	EventSubscription models.AmfEventSubscription
+	// subscription of the UEs which are added to an any UE or group subscription
+	UeEventSubscription AmfUeEventSubscription
+	// reports kept while the notifications are muted
+	MutedReports []models.AmfEventReport
+	// number of its UEs in the areas of its UES_IN_AREA_REPORT event, see UpdatePresence
+	NumberOfUesInArea int32 `json:"-"`
 }
 
 type PlmnSupportItem struct {
@@ -141,9 +169,16 @@ func (context *AMFContext) NewAMFStatusSubscription(subscriptionData models.Subs
 
 	subscriptionID = strconv.Itoa(int(id))
 	context.AMFStatusSubscriptions.Store(subscriptionID, subscriptionData)
+	context.saveAMFStatusSubscription(subscriptionID, subscriptionData)
 	return
 }
 
+func (context *AMFContext) UpdateAMFStatusSubscription(subscriptionID string,
+	subscriptionData models.SubscriptionData) {
+	context.AMFStatusSubscriptions.Store(subscriptionID, subscriptionData)
+	context.saveAMFStatusSubscription(subscriptionID, subscriptionData)
+}
+
 // Return Value: (subscriptionData *models.SubScriptionData, ok bool)
 func (context *AMFContext) FindAMFStatusSubscription(subscriptionID string) (*models.SubscriptionData, bool) {
 	if value, ok := context.AMFStatusSubscriptions.Load(subscriptionID); ok {
@@ -156,6 +191,7 @@ func (context *AMFContext) FindAMFStatusSubscription(subscriptionID string) (*mo
 
 func (context *AMFContext) DeleteAMFStatusSubscription(subscriptionID string) {
 	context.AMFStatusSubscriptions.Delete(subscriptionID)
+	context.removeAMFStatusSubscription(subscriptionID)
 	if id, err := strconv.ParseInt(subscriptionID, 10, 64); err != nil {
 		logger.ContextLog.Error(err)
 	} else {
@@ -163,8 +199,41 @@ func (context *AMFContext) DeleteAMFStatusSubscription(subscriptionID string) {
 	}
 }
 
+func (context *AMFContext) NewNonUeN2InfoSubscription(
+	subscriptionData models.NonUeN2InfoSubscriptionCreateData) (subscriptionID string) {
+	id, err := nonUeN2InfoSubscriptionIDGenerator.Allocate()
+	if err != nil {
+		logger.ContextLog.Errorf("Allocate subscriptionID error: %+v", err)
+		return ""
+	}
+
+	subscriptionID = strconv.Itoa(int(id))
+	context.NonUeN2InfoSubscriptions.Store(subscriptionID, subscriptionData)
+	return
+}
+
+func (context *AMFContext) FindNonUeN2InfoSubscription(subscriptionID string) (
+	*models.NonUeN2InfoSubscriptionCreateData, bool) {
+	if value, ok := context.NonUeN2InfoSubscriptions.Load(subscriptionID); ok {
+		subscriptionData := value.(models.NonUeN2InfoSubscriptionCreateData)
+		return &subscriptionData, ok
+	} else {
+		return nil, false
+	}
+}
+
+func (context *AMFContext) DeleteNonUeN2InfoSubscription(subscriptionID string) {
+	context.NonUeN2InfoSubscriptions.Delete(subscriptionID)
+	if id, err := strconv.ParseInt(subscriptionID, 10, 64); err != nil {
+		logger.ContextLog.Error(err)
+	} else {
+		nonUeN2InfoSubscriptionIDGenerator.FreeID(id)
+	}
+}
+
 func (context *AMFContext) NewEventSubscription(subscriptionID string, subscription *AMFContextEventSubscription) {
 	context.EventSubscriptions.Store(subscriptionID, subscription)
+	context.SaveEventSubscription(subscriptionID, subscription)
 }
 
 func (context *AMFContext) FindEventSubscription(subscriptionID string) (*AMFContextEventSubscription, bool) {
@@ -176,6 +245,7 @@ func (context *AMFContext) FindEventSubscription(subscriptionID string) (*AMFCon
 }
 func (context *AMFContext) DeleteEventSubscription(subscriptionID string) {
 	context.EventSubscriptions.Delete(subscriptionID)
+	context.removeEventSubscription(subscriptionID)
 	if id, err := strconv.ParseInt(subscriptionID, 10, 32); err != nil {
 		logger.ContextLog.Error(err)
 	} else {
@@ -323,6 +393,18 @@ func (context *AMFContext) AmfUeFindByPolicyAssociationID(polAssoId string) (ue
 	return
 }
 
+func (context *AMFContext) AmfUeFindByUePolicyAssociationID(polAssoId string) (ue *AmfUe, ok bool) {
+	context.UePool.Range(func(key, value interface{}) bool {
+		candidate := value.(*AmfUe)
+		if ok = (candidate.UePolicyAssociationId == polAssoId); ok {
+			ue = candidate
+			return false
+		}
+		return true
+	})
+	return
+}
+
 func (context *AMFContext) RanUeFindByAmfUeNgapID(amfUeNgapID int64) *RanUe {
 	if value, ok := context.RanUePool.Load(amfUeNgapID); ok {
 		return value.(*RanUe)
@@ -372,6 +454,9 @@ func (context *AMFContext) Reset() {
 	for key := range context.LadnPool {
 		delete(context.LadnPool, key)
 	}
+	for key := range context.PresenceReportingAreas {
+		delete(context.PresenceReportingAreas, key)
+	}
 	context.RanUePool.Range(func(key, value interface{}) bool {
 		context.RanUePool.Delete(key)
 		return true
@@ -390,7 +475,7 @@ func (context *AMFContext) Reset() {
 	context.SupportTaiLists = context.SupportTaiLists[:0]
 	context.PlmnSupportList = context.PlmnSupportList[:0]
 	context.ServedGuamiList = context.ServedGuamiList[:0]
-	context.RelativeCapacity = 0xff
+	context.SetRelativeCapacity(0xff)
 	context.NfId = ""
 	context.UriScheme = models.UriScheme_HTTPS
 	context.SBIPort = 0
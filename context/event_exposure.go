@@ -0,0 +1,37 @@
+package context
+
+import (
+	"free5gc/lib/openapi/models"
+	"reflect"
+)
+
+// amfEventHandler reports the events of the UEs to the Namf_EventExposure subscriptions
+var amfEventHandler func(ue *AmfUe, eventType models.AmfEventType)
+
+// SetAmfEventHandler sets the handler to which the AMF context reports the events of the UEs
+func SetAmfEventHandler(handler func(ue *AmfUe, eventType models.AmfEventType)) {
+	amfEventHandler = handler
+}
+
+// NotifyEvent reports an event of the UE to the subscribers of the event
+func (ue *AmfUe) NotifyEvent(eventType models.AmfEventType) {
+	if ue == nil || amfEventHandler == nil {
+		return
+	}
+	amfEventHandler(ue, eventType)
+}
+
+// sameServingCell tells if two locations of a UE are in the same cell, whatever their age
+func sameServingCell(location, lastLocation models.UserLocation) bool {
+	switch {
+	case location.NrLocation != nil && lastLocation.NrLocation != nil:
+		return reflect.DeepEqual(location.NrLocation.Tai, lastLocation.NrLocation.Tai) &&
+			reflect.DeepEqual(location.NrLocation.Ncgi, lastLocation.NrLocation.Ncgi)
+	case location.EutraLocation != nil && lastLocation.EutraLocation != nil:
+		return reflect.DeepEqual(location.EutraLocation.Tai, lastLocation.EutraLocation.Tai) &&
+			reflect.DeepEqual(location.EutraLocation.Ecgi, lastLocation.EutraLocation.Ecgi)
+	case location.N3gaLocation != nil && lastLocation.N3gaLocation != nil:
+		return reflect.DeepEqual(location.N3gaLocation, lastLocation.N3gaLocation)
+	}
+	return false
+}
@@ -0,0 +1,75 @@
+package context
+
+import (
+	"free5gc/lib/openapi/models"
+)
+
+// MatchEventFilter tells if the UE is in the state an event of a subscription is restricted to: in
+// the target area, and in an RM or CM state, or registered, on the access types of the event
+func (ue *AmfUe) MatchEventFilter(event *models.AmfEvent) bool {
+	if targetArea := event.TargetArea; targetArea != nil && !targetArea.AnyTa && len(targetArea.TaList) > 0 {
+		if !InTaiList(ue.Tai, targetArea.TaList) {
+			return false
+		}
+	}
+
+	if len(event.AccessTypeList) > 0 {
+		registered := false
+		for _, accessType := range event.AccessTypeList {
+			if state, ok := ue.State[accessType]; ok && state.Is(Registered) {
+				registered = true
+			}
+		}
+		if !registered {
+			return false
+		}
+	}
+
+	if len(event.RmInfoList) > 0 {
+		match := false
+		for _, rmInfo := range event.RmInfoList {
+			rmState := models.RmState_DEREGISTERED
+			if state, ok := ue.State[rmInfo.AccessType]; ok && state.Is(Registered) {
+				rmState = models.RmState_REGISTERED
+			}
+			if rmState == rmInfo.RmState {
+				match = true
+			}
+		}
+		if !match {
+			return false
+		}
+	}
+
+	if len(event.CmInfoList) > 0 {
+		match := false
+		for _, cmInfo := range event.CmInfoList {
+			cmState := models.CmState_IDLE
+			if ue.CmConnect(cmInfo.AccessType) {
+				cmState = models.CmState_CONNECTED
+			}
+			if cmState == cmInfo.CmState {
+				match = true
+			}
+		}
+		if !match {
+			return false
+		}
+	}
+	return true
+}
+
+// MatchPresenceFilter tells if the presence of the UE in the areas of an event is reported: an area
+// with a presence state only reports this state
+func MatchPresenceFilter(areaList, presenceList []models.AmfEventArea) bool {
+	for i, area := range areaList {
+		if i >= len(presenceList) || area.PresenceInfo == nil || presenceList[i].PresenceInfo == nil {
+			return true
+		}
+		if area.PresenceInfo.PresenceState == "" ||
+			area.PresenceInfo.PresenceState == presenceList[i].PresenceInfo.PresenceState {
+			return true
+		}
+	}
+	return len(areaList) == 0
+}
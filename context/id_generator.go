@@ -0,0 +1,52 @@
+package context
+
+import (
+	"free5gc/lib/idgenerator"
+	"sync"
+)
+
+// ReservableIDGenerator is an ID generator whose IDs can be reserved, like the IDs of the subscriptions
+// reloaded from the subscription store; a reserved ID is skipped when the generator reaches it
+type ReservableIDGenerator struct {
+	*idgenerator.IDGenerator
+	mutex    sync.Mutex
+	reserved map[int64]bool
+}
+
+func NewReservableIDGenerator(minValue, maxValue int64) *ReservableIDGenerator {
+	return &ReservableIDGenerator{
+		IDGenerator: idgenerator.NewGenerator(minValue, maxValue),
+		reserved:    make(map[int64]bool),
+	}
+}
+
+// Reserve marks id as in use, before the generator allocates it
+func (generator *ReservableIDGenerator) Reserve(id int64) {
+	generator.mutex.Lock()
+	defer generator.mutex.Unlock()
+	generator.reserved[id] = true
+}
+
+func (generator *ReservableIDGenerator) Allocate() (int64, error) {
+	generator.mutex.Lock()
+	defer generator.mutex.Unlock()
+	for {
+		id, err := generator.IDGenerator.Allocate()
+		if err != nil || !generator.reserved[id] {
+			return id, err
+		}
+		// the reserved ID stays allocated until it is freed
+		delete(generator.reserved, id)
+	}
+}
+
+func (generator *ReservableIDGenerator) FreeID(id int64) {
+	generator.mutex.Lock()
+	defer generator.mutex.Unlock()
+	// a reserved ID which the generator did not reach yet is still free in the generator
+	if generator.reserved[id] {
+		delete(generator.reserved, id)
+		return
+	}
+	generator.IDGenerator.FreeID(id)
+}
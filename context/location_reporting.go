@@ -0,0 +1,149 @@
+package context
+
+import (
+	"free5gc/lib/ngap/ngapType"
+	"sync"
+	"time"
+)
+
+// LocationReportingType is how the NG-RAN reports the location of a UE (TS 23.502 4.10)
+type LocationReportingType int
+
+const (
+	// the location is reported once, when the UE is CM-CONNECTED
+	LocationReportingDirect LocationReportingType = iota
+	// the location is reported once, when the UE is next CM-CONNECTED
+	LocationReportingDeferred
+	// the location is reported every Period while the UE is CM-CONNECTED
+	LocationReportingPeriodic
+	// the location is reported at every change of serving cell
+	LocationReportingChangeOfServeCell
+	// the presence of the UE in AreaOfInterest is reported at every change
+	LocationReportingAreaOfInterest
+)
+
+// MaxLocationReportingReferenceID is the range of the references of the areas of interest of a UE,
+// TS 38.413 9.3.1.76
+const MaxLocationReportingReferenceID = 64
+
+// LocationReporting is a location reporting requested by an NF for a UE, which the AMF requests
+// to the NG-RAN node serving the UE until it is stopped
+type LocationReporting struct {
+	Type   LocationReportingType
+	Period time.Duration // of a periodic reporting
+	// area of a presence reporting, and its reference in the Location Reporting Control
+	AreaOfInterest *ngapType.AreaOfInterest
+	ReferenceID    int64
+
+	reported     chan struct{}
+	reportedOnce sync.Once
+	stop         chan struct{}
+	stopOnce     sync.Once
+}
+
+// NewLocationReporting returns a location reporting of reportingType
+func NewLocationReporting(reportingType LocationReportingType) *LocationReporting {
+	return &LocationReporting{
+		Type:     reportingType,
+		reported: make(chan struct{}),
+		stop:     make(chan struct{}),
+	}
+}
+
+// OneTime tells if the reporting ends at the first report
+func (reporting *LocationReporting) OneTime() bool {
+	return reporting.Type == LocationReportingDirect || reporting.Type == LocationReportingDeferred
+}
+
+// Reported is closed when the location is reported for the first time
+func (reporting *LocationReporting) Reported() <-chan struct{} {
+	return reporting.reported
+}
+
+// Stopped is closed when the reporting is stopped
+func (reporting *LocationReporting) Stopped() <-chan struct{} {
+	return reporting.stop
+}
+
+func (reporting *LocationReporting) setReported() {
+	reporting.reportedOnce.Do(func() { close(reporting.reported) })
+}
+
+func (reporting *LocationReporting) setStopped() {
+	reporting.stopOnce.Do(func() { close(reporting.stop) })
+}
+
+// AddLocationReporting records the location reporting id of the UE; an area of interest gets
+// a reference which is not used by the other reportings of the UE
+func (ue *AmfUe) AddLocationReporting(id string, reporting *LocationReporting) bool {
+	ue.locationReportingMutex.Lock()
+	defer ue.locationReportingMutex.Unlock()
+
+	if reporting.Type == LocationReportingAreaOfInterest {
+		used := make(map[int64]bool)
+		ue.LocationReportings.Range(func(key, value interface{}) bool {
+			used[value.(*LocationReporting).ReferenceID] = true
+			return true
+		})
+		reporting.ReferenceID = 0
+		for referenceID := int64(1); referenceID <= MaxLocationReportingReferenceID; referenceID++ {
+			if !used[referenceID] {
+				reporting.ReferenceID = referenceID
+				break
+			}
+		}
+		if reporting.ReferenceID == 0 {
+			return false
+		}
+	}
+	if value, loaded := ue.LocationReportings.Load(id); loaded {
+		value.(*LocationReporting).setStopped()
+	}
+	ue.LocationReportings.Store(id, reporting)
+	return true
+}
+
+// RemoveLocationReporting forgets the location reporting id of the UE, which is stopped
+func (ue *AmfUe) RemoveLocationReporting(id string) (*LocationReporting, bool) {
+	ue.locationReportingMutex.Lock()
+	defer ue.locationReportingMutex.Unlock()
+
+	value, ok := ue.LocationReportings.Load(id)
+	if !ok {
+		return nil, false
+	}
+	ue.LocationReportings.Delete(id)
+	reporting := value.(*LocationReporting)
+	reporting.setStopped()
+	return reporting, true
+}
+
+// LocationReported ends the one time location reportings of the UE after the NG-RAN reported
+// its location
+func (ue *AmfUe) LocationReported(ranUe *RanUe) {
+	ue.LocationReportings.Range(func(key, value interface{}) bool {
+		reporting := value.(*LocationReporting)
+		reporting.setReported()
+		if reporting.OneTime() {
+			ue.RemoveLocationReporting(key.(string))
+			if ranUe != nil {
+				ranUe.LocationReportings.Delete(key)
+			}
+		}
+		return true
+	})
+}
+
+// ClearLocationReporting forgets the location reportings of reportingType the NG-RAN node
+// no longer performs for the UE, or all of them if all is set; they are requested again to
+// the next NG-RAN node serving the UE
+func (ranUe *RanUe) ClearLocationReporting(reportingType LocationReportingType, referenceID int64, all bool) {
+	ranUe.LocationReportings.Range(func(key, value interface{}) bool {
+		reporting := value.(*LocationReporting)
+		if all || (reporting.Type == reportingType &&
+			(reportingType != LocationReportingAreaOfInterest || reporting.ReferenceID == referenceID)) {
+			ranUe.LocationReportings.Delete(key)
+		}
+		return true
+	})
+}
@@ -0,0 +1,100 @@
+package context
+
+import (
+	"free5gc/lib/openapi/models"
+	"time"
+)
+
+// pendingN1N2MessageHandler transfers the N1N2 messages held for a UE, see SetPendingN1N2MessageHandler
+var pendingN1N2MessageHandler func(ue *AmfUe)
+
+// SetPendingN1N2MessageHandler sets the handler which transfers the N1N2 messages held for a UE once
+// it is CM-CONNECTED
+func SetPendingN1N2MessageHandler(handler func(ue *AmfUe)) {
+	pendingN1N2MessageHandler = handler
+}
+
+// TransferPendingN1N2Messages transfers the N1N2 messages held for the UE, after it answered a paging
+// or contacted the network
+func (ue *AmfUe) TransferPendingN1N2Messages() {
+	if pendingN1N2MessageHandler == nil || len(ue.PendingN1N2Messages) == 0 {
+		return
+	}
+	pendingN1N2MessageHandler(ue)
+}
+
+// HoldN1N2Message holds a transfer for the UE until it is CM-CONNECTED; after holdTime the transfer
+// is dropped and expired is called
+func (ue *AmfUe) HoldN1N2Message(message *N1N2Message, holdTime time.Duration, expired func(message *N1N2Message)) {
+	ue.n1n2MessageMutex.Lock()
+	defer ue.n1n2MessageMutex.Unlock()
+
+	message.expiry = time.AfterFunc(holdTime, func() {
+		if ue.removeN1N2Message(message) {
+			expired(message)
+		}
+	})
+	ue.PendingN1N2Messages = append(ue.PendingN1N2Messages, message)
+}
+
+// TakePendingN1N2Messages returns the transfers held for the UE, which are no longer held
+func (ue *AmfUe) TakePendingN1N2Messages() []*N1N2Message {
+	return ue.takeN1N2Messages(func(message *N1N2Message) bool {
+		return true
+	})
+}
+
+// TakePagedN1N2Messages returns the transfers held while the UE is paged, which are no longer held
+func (ue *AmfUe) TakePagedN1N2Messages() []*N1N2Message {
+	return ue.takeN1N2Messages(func(message *N1N2Message) bool {
+		return message.Status == models.N1N2MessageTransferCause_ATTEMPTING_TO_REACH_UE
+	})
+}
+
+func (ue *AmfUe) takeN1N2Messages(match func(message *N1N2Message) bool) (messages []*N1N2Message) {
+	ue.n1n2MessageMutex.Lock()
+	defer ue.n1n2MessageMutex.Unlock()
+
+	var pendingMessages []*N1N2Message
+	for _, message := range ue.PendingN1N2Messages {
+		if !match(message) {
+			pendingMessages = append(pendingMessages, message)
+			continue
+		}
+		message.expiry.Stop()
+		ue.N1N2MessageIDGenerator.FreeID(message.ID)
+		messages = append(messages, message)
+	}
+	ue.PendingN1N2Messages = pendingMessages
+	return messages
+}
+
+// FindN1N2Message returns the transfer of resourceUri, which is ongoing or held for the UE
+func (ue *AmfUe) FindN1N2Message(resourceUri string) (*N1N2Message, bool) {
+	if message := ue.N1N2Message; message != nil && message.ResourceUri == resourceUri {
+		return message, true
+	}
+
+	ue.n1n2MessageMutex.Lock()
+	defer ue.n1n2MessageMutex.Unlock()
+	for _, message := range ue.PendingN1N2Messages {
+		if message.ResourceUri == resourceUri {
+			return message, true
+		}
+	}
+	return nil, false
+}
+
+func (ue *AmfUe) removeN1N2Message(message *N1N2Message) bool {
+	ue.n1n2MessageMutex.Lock()
+	defer ue.n1n2MessageMutex.Unlock()
+
+	for i, pending := range ue.PendingN1N2Messages {
+		if pending == message {
+			ue.PendingN1N2Messages = append(ue.PendingN1N2Messages[:i], ue.PendingN1N2Messages[i+1:]...)
+			ue.N1N2MessageIDGenerator.FreeID(message.ID)
+			return true
+		}
+	}
+	return false
+}
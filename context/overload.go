@@ -0,0 +1,61 @@
+package context
+
+import (
+	"free5gc/lib/openapi/models"
+	"sync/atomic"
+)
+
+// OverloadControl configures the NGAP overload control: the AMF load is the highest
+// usage of the configured limits, a limit set to 0 is not checked
+type OverloadControl struct {
+	Enable            bool
+	Interval          int // unit is millisecond
+	UeCapacity        int
+	MaxQueuedMessages int
+	MaxSbiRequests    int
+	MaxCpuLoad        int // percent of all the CPUs
+	// the overload starts when the load reaches StartThreshold percent,
+	// and stops when it falls to StopThreshold percent
+	StartThreshold       int
+	StopThreshold        int
+	OverloadAction       string
+	TrafficLoadReduction int64 // percent, 0 if not indicated
+	SNssaiList           []models.Snssai
+	RelativeCapacity     int64 // advertised while overloaded
+}
+
+var sbiRequests int64
+
+// SbiRequestStarted counts an SBI request the AMF starts to serve
+func SbiRequestStarted() {
+	atomic.AddInt64(&sbiRequests, 1)
+}
+
+// SbiRequestDone counts an SBI request the AMF has served
+func SbiRequestDone() {
+	atomic.AddInt64(&sbiRequests, -1)
+}
+
+// SbiRequestsInFlight returns the number of SBI requests being served
+func SbiRequestsInFlight() int64 {
+	return atomic.LoadInt64(&sbiRequests)
+}
+
+// GetRelativeCapacity returns the relative capacity the AMF advertises to the RANs and the NRF,
+// which the overload control changes while the AMF is running
+func (context *AMFContext) GetRelativeCapacity() int64 {
+	return atomic.LoadInt64(&context.RelativeCapacity)
+}
+
+func (context *AMFContext) SetRelativeCapacity(capacity int64) {
+	atomic.StoreInt64(&context.RelativeCapacity, capacity)
+}
+
+// NumOfUes returns the number of UE contexts held by the AMF
+func (context *AMFContext) NumOfUes() (num int) {
+	context.UePool.Range(func(key, value interface{}) bool {
+		num++
+		return true
+	})
+	return
+}
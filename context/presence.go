@@ -0,0 +1,167 @@
+package context
+
+import (
+	"free5gc/lib/openapi/models"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// ResolvePresenceReportingArea returns the area of a presence reporting area given by its praId only,
+// from the presence reporting areas of the AMF
+func ResolvePresenceReportingArea(area models.PresenceInfo) (models.PresenceInfo, bool) {
+	if len(area.TrackingAreaList) > 0 || len(area.EcgiList) > 0 || len(area.NcgiList) > 0 ||
+		len(area.GlobalRanNodeIdList) > 0 {
+		return area, true
+	}
+	if area.PraId == "" {
+		return area, false
+	}
+	presenceReportingArea, ok := AMF_Self().PresenceReportingAreas[area.PraId]
+	return presenceReportingArea, ok
+}
+
+// PresenceInArea evaluates the presence of the UE in an area from its last known location
+func (ue *AmfUe) PresenceInArea(area models.PresenceInfo) models.PresenceState {
+	area, ok := ResolvePresenceReportingArea(area)
+	if !ok {
+		return models.PresenceState_UNKNOWN
+	}
+
+	location := ue.Location
+	switch {
+	case location.NrLocation != nil:
+		if location.NrLocation.Ncgi != nil {
+			for _, ncgi := range area.NcgiList {
+				if reflect.DeepEqual(ncgi, *location.NrLocation.Ncgi) {
+					return models.PresenceState_IN_AREA
+				}
+			}
+		}
+	case location.EutraLocation != nil:
+		if location.EutraLocation.Ecgi != nil {
+			for _, ecgi := range area.EcgiList {
+				if reflect.DeepEqual(ecgi, *location.EutraLocation.Ecgi) {
+					return models.PresenceState_IN_AREA
+				}
+			}
+		}
+	case location.N3gaLocation != nil:
+	default:
+		return models.PresenceState_UNKNOWN
+	}
+
+	if InTaiList(ue.Tai, area.TrackingAreaList) {
+		return models.PresenceState_IN_AREA
+	}
+	if ranUe, ok := ue.RanUe[models.AccessType__3_GPP_ACCESS]; ok && ranUe.Ran.RanId != nil {
+		for _, ranNodeId := range area.GlobalRanNodeIdList {
+			if reflect.DeepEqual(ranNodeId, *ranUe.Ran.RanId) {
+				return models.PresenceState_IN_AREA
+			}
+		}
+	}
+	return models.PresenceState_OUT_OF_AREA
+}
+
+// PresenceInLadn evaluates the presence of the UE in the service area of a LADN
+func (ue *AmfUe) PresenceInLadn(dnn string) models.PresenceState {
+	ladn, ok := AMF_Self().LadnPool[dnn]
+	if !ok || ue.Tai.Tac == "" {
+		return models.PresenceState_UNKNOWN
+	}
+	if InTaiList(ue.Tai, ladn.TaiLists) {
+		return models.PresenceState_IN_AREA
+	}
+	return models.PresenceState_OUT_OF_AREA
+}
+
+// PresenceInEventArea evaluates the presence of the UE in an area of an event subscription
+func (ue *AmfUe) PresenceInEventArea(area models.AmfEventArea) models.PresenceState {
+	switch {
+	case area.PresenceInfo != nil:
+		return ue.PresenceInArea(*area.PresenceInfo)
+	case area.LadnInfo != nil:
+		return ue.PresenceInLadn(area.LadnInfo.Ladn)
+	}
+	return models.PresenceState_UNKNOWN
+}
+
+// UpdatePresence evaluates the presence of the UE in the areas of an event of the subscription;
+// it returns the areas with the presence of the UE, and tells if the presence changed in any
+// area since the previous evaluation
+func (ueSubscription *AmfUeEventSubscription) UpdatePresence(ue *AmfUe, eventType models.AmfEventType,
+	areaList []models.AmfEventArea) (presenceList []models.AmfEventArea, changed bool) {
+	if ueSubscription.PresenceStates == nil {
+		ueSubscription.PresenceStates = make(map[string]models.PresenceState)
+	}
+	inArea := ueSubscription.inArea(eventType)
+
+	for i, area := range areaList {
+		presence := ue.PresenceInEventArea(area)
+		key := string(eventType) + "/" + strconv.Itoa(i)
+		if lastPresence, ok := ueSubscription.PresenceStates[key]; !ok || lastPresence != presence {
+			ueSubscription.PresenceStates[key] = presence
+			changed = true
+		}
+
+		switch {
+		case area.PresenceInfo != nil:
+			presenceInfo := *area.PresenceInfo
+			presenceInfo.PresenceState = presence
+			area.PresenceInfo = &presenceInfo
+		case area.LadnInfo != nil:
+			ladnInfo := *area.LadnInfo
+			ladnInfo.Presence = presence
+			area.LadnInfo = &ladnInfo
+		}
+		presenceList = append(presenceList, area)
+	}
+
+	// the subscription counts its UEs which are in any area of the UES_IN_AREA_REPORT event
+	if eventType == models.AmfEventType_UES_IN_AREA_REPORT && ueSubscription.uesInArea != nil {
+		switch nowInArea := ueSubscription.inArea(eventType); {
+		case nowInArea && !inArea:
+			atomic.AddInt32(ueSubscription.uesInArea, 1)
+		case !nowInArea && inArea:
+			atomic.AddInt32(ueSubscription.uesInArea, -1)
+		}
+	}
+	return presenceList, changed
+}
+
+// inArea tells if the UE was in any area of an event at the last evaluation of its presence
+func (ueSubscription *AmfUeEventSubscription) inArea(eventType models.AmfEventType) bool {
+	prefix := string(eventType) + "/"
+	for key, presence := range ueSubscription.PresenceStates {
+		if strings.HasPrefix(key, prefix) && presence == models.PresenceState_IN_AREA {
+			return true
+		}
+	}
+	return false
+}
+
+// leaveAreas stops counting a UE which is removed in the areas of the UES_IN_AREA_REPORT event
+func (ueSubscription *AmfUeEventSubscription) leaveAreas() {
+	if ueSubscription.uesInArea != nil && ueSubscription.inArea(models.AmfEventType_UES_IN_AREA_REPORT) {
+		atomic.AddInt32(ueSubscription.uesInArea, -1)
+	}
+	ueSubscription.PresenceStates = nil
+}
+
+// NumberOfUesInArea returns the number of UEs of the subscription which are in any area of
+// its UES_IN_AREA_REPORT event
+func (ueSubscription *AmfUeEventSubscription) NumberOfUesInArea() int32 {
+	if ueSubscription.uesInArea == nil {
+		return 0
+	}
+	return atomic.LoadInt32(ueSubscription.uesInArea)
+}
+
+// NewUeEventSubscription returns the subscription of a UE which is added to the subscription
+func (subscription *AMFContextEventSubscription) NewUeEventSubscription() *AmfUeEventSubscription {
+	ueSubscription := subscription.UeEventSubscription
+	ueSubscription.uesInArea = &subscription.NumberOfUesInArea
+	return &ueSubscription
+}
@@ -0,0 +1,196 @@
+package context
+
+import (
+	"free5gc/lib/openapi/models"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	testPlmnId = models.PlmnId{Mcc: "208", Mnc: "93"}
+	testTai    = models.Tai{PlmnId: &testPlmnId, Tac: "000001"}
+	testNcgi   = models.Ncgi{PlmnId: &testPlmnId, NrCellId: "000000010"}
+	testEcgi   = models.Ecgi{PlmnId: &testPlmnId, EutraCellId: "0000001"}
+)
+
+// newTestUe returns a UE at location, in the TAI of the location
+func newTestUe(location models.UserLocation) *AmfUe {
+	ue := &AmfUe{Location: location}
+	switch {
+	case location.NrLocation != nil && location.NrLocation.Tai != nil:
+		ue.Tai = *location.NrLocation.Tai
+	case location.EutraLocation != nil && location.EutraLocation.Tai != nil:
+		ue.Tai = *location.EutraLocation.Tai
+	}
+	return ue
+}
+
+func nrUserLocation(tai models.Tai, ncgi models.Ncgi) models.UserLocation {
+	return models.UserLocation{NrLocation: &models.NrLocation{Tai: &tai, Ncgi: &ncgi}}
+}
+
+func TestPresenceInArea(t *testing.T) {
+	otherTai := models.Tai{PlmnId: &testPlmnId, Tac: "000002"}
+	otherNcgi := models.Ncgi{PlmnId: &testPlmnId, NrCellId: "000000020"}
+
+	testCases := []struct {
+		name     string
+		location models.UserLocation
+		area     models.PresenceInfo
+		expected models.PresenceState
+	}{
+		{
+			name:     "NR cell in the area",
+			location: nrUserLocation(otherTai, testNcgi),
+			area:     models.PresenceInfo{NcgiList: []models.Ncgi{testNcgi}},
+			expected: models.PresenceState_IN_AREA,
+		},
+		{
+			name: "E-UTRA cell in the area",
+			location: models.UserLocation{EutraLocation: &models.EutraLocation{
+				Tai:  &otherTai,
+				Ecgi: &testEcgi,
+			}},
+			area:     models.PresenceInfo{EcgiList: []models.Ecgi{testEcgi}},
+			expected: models.PresenceState_IN_AREA,
+		},
+		{
+			name:     "TAI in the area",
+			location: nrUserLocation(testTai, otherNcgi),
+			area:     models.PresenceInfo{TrackingAreaList: []models.Tai{testTai}},
+			expected: models.PresenceState_IN_AREA,
+		},
+		{
+			name:     "out of the area",
+			location: nrUserLocation(otherTai, otherNcgi),
+			area: models.PresenceInfo{
+				TrackingAreaList: []models.Tai{testTai},
+				NcgiList:         []models.Ncgi{testNcgi},
+			},
+			expected: models.PresenceState_OUT_OF_AREA,
+		},
+		{
+			name:     "unknown location",
+			location: models.UserLocation{},
+			area:     models.PresenceInfo{TrackingAreaList: []models.Tai{testTai}},
+			expected: models.PresenceState_UNKNOWN,
+		},
+		{
+			name:     "unknown presence reporting area",
+			location: nrUserLocation(testTai, testNcgi),
+			area:     models.PresenceInfo{PraId: "unknown"},
+			expected: models.PresenceState_UNKNOWN,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ue := newTestUe(tc.location)
+			assert.Equal(t, tc.expected, ue.PresenceInArea(tc.area))
+		})
+	}
+}
+
+func TestUpdatePresence(t *testing.T) {
+	otherTai := models.Tai{PlmnId: &testPlmnId, Tac: "000002"}
+	otherNcgi := models.Ncgi{PlmnId: &testPlmnId, NrCellId: "000000020"}
+	areaList := []models.AmfEventArea{
+		{PresenceInfo: &models.PresenceInfo{TrackingAreaList: []models.Tai{testTai}}},
+		{PresenceInfo: &models.PresenceInfo{NcgiList: []models.Ncgi{testNcgi}}},
+	}
+	inArea := nrUserLocation(testTai, otherNcgi)
+	outOfArea := nrUserLocation(otherTai, otherNcgi)
+
+	testCases := []struct {
+		name        string
+		locations   []models.UserLocation
+		presences   []models.PresenceState
+		changed     bool
+		numberOfUes int32
+	}{
+		{
+			name:        "first evaluation",
+			locations:   []models.UserLocation{inArea},
+			presences:   []models.PresenceState{models.PresenceState_IN_AREA, models.PresenceState_OUT_OF_AREA},
+			changed:     true,
+			numberOfUes: 1,
+		},
+		{
+			name:        "same presence",
+			locations:   []models.UserLocation{inArea, inArea},
+			presences:   []models.PresenceState{models.PresenceState_IN_AREA, models.PresenceState_OUT_OF_AREA},
+			changed:     false,
+			numberOfUes: 1,
+		},
+		{
+			name:        "leaves the areas",
+			locations:   []models.UserLocation{inArea, outOfArea},
+			presences:   []models.PresenceState{models.PresenceState_OUT_OF_AREA, models.PresenceState_OUT_OF_AREA},
+			changed:     true,
+			numberOfUes: 0,
+		},
+		{
+			name:        "moves to another area",
+			locations:   []models.UserLocation{inArea, nrUserLocation(otherTai, testNcgi)},
+			presences:   []models.PresenceState{models.PresenceState_OUT_OF_AREA, models.PresenceState_IN_AREA},
+			changed:     true,
+			numberOfUes: 1,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			subscription := &AMFContextEventSubscription{}
+			ueSubscription := subscription.NewUeEventSubscription()
+			ue := newTestUe(models.UserLocation{})
+			var presenceList []models.AmfEventArea
+			var changed bool
+			for _, location := range tc.locations {
+				ue.Location = location
+				ue.Tai = *location.NrLocation.Tai
+				presenceList, changed = ueSubscription.UpdatePresence(ue, models.AmfEventType_UES_IN_AREA_REPORT,
+					areaList)
+			}
+
+			assert.Equal(t, tc.changed, changed)
+			if assert.Len(t, presenceList, len(tc.presences)) {
+				for i, presence := range tc.presences {
+					assert.Equal(t, presence, presenceList[i].PresenceInfo.PresenceState)
+				}
+			}
+			assert.Equal(t, tc.numberOfUes, ueSubscription.NumberOfUesInArea())
+			// the areas of the subscription are not modified
+			assert.Equal(t, models.PresenceState(""), areaList[0].PresenceInfo.PresenceState)
+
+			ueSubscription.leaveAreas()
+			assert.Equal(t, int32(0), ueSubscription.NumberOfUesInArea())
+		})
+	}
+}
+
+func TestUpdatePresenceCountsUesOfSubscription(t *testing.T) {
+	areaList := []models.AmfEventArea{
+		{PresenceInfo: &models.PresenceInfo{TrackingAreaList: []models.Tai{testTai}}},
+	}
+	subscription := &AMFContextEventSubscription{}
+
+	var ueSubscriptions []*AmfUeEventSubscription
+	for i := 0; i < 3; i++ {
+		ueSubscription := subscription.NewUeEventSubscription()
+		ueSubscription.UpdatePresence(newTestUe(nrUserLocation(testTai, testNcgi)),
+			models.AmfEventType_UES_IN_AREA_REPORT, areaList)
+		ueSubscriptions = append(ueSubscriptions, ueSubscription)
+	}
+	assert.Equal(t, int32(3), subscription.NumberOfUesInArea)
+
+	// the presence in the area of other events is not counted
+	other := subscription.NewUeEventSubscription()
+	other.UpdatePresence(newTestUe(nrUserLocation(testTai, testNcgi)), models.AmfEventType_PRESENCE_IN_AOI_REPORT,
+		areaList)
+	assert.Equal(t, int32(3), subscription.NumberOfUesInArea)
+
+	ueSubscriptions[0].leaveAreas()
+	ueSubscriptions[0].leaveAreas()
+	assert.Equal(t, int32(2), ueSubscriptions[1].NumberOfUesInArea())
+}
@@ -0,0 +1,105 @@
+package context
+
+import (
+	"free5gc/lib/ngap/ngapType"
+	"sync"
+)
+
+// PwsTransactionKey identifies a warning message (TS 23.041 9.4.1.2) in the
+// Write-Replace Warning or PWS Cancel procedure which is broadcasting or cancelling it
+type PwsTransactionKey struct {
+	ProcedureCode     int64
+	MessageIdentifier int32
+	SerialNumber      int32
+}
+
+// PwsResponse is the response of a RAN to a Write-Replace Warning or PWS Cancel Request
+type PwsResponse struct {
+	Ran *AmfRan
+	Pdu *ngapType.NGAPPDU
+}
+
+// PwsTransaction is a Write-Replace Warning or PWS Cancel Request sent to several RANs,
+// whose responses are collected to be reported to the CBCF
+type PwsTransaction struct {
+	Key       PwsTransactionKey
+	mutex     sync.Mutex
+	pending   map[*AmfRan]bool
+	responses []PwsResponse
+	done      chan struct{}
+}
+
+// NewPwsTransaction starts collecting the responses of rans to the procedure of key;
+// a transaction with the same key is replaced
+func (context *AMFContext) NewPwsTransaction(key PwsTransactionKey, rans []*AmfRan) *PwsTransaction {
+	transaction := &PwsTransaction{
+		Key:     key,
+		pending: make(map[*AmfRan]bool),
+		done:    make(chan struct{}),
+	}
+	for _, ran := range rans {
+		transaction.pending[ran] = true
+	}
+	if len(transaction.pending) == 0 {
+		close(transaction.done)
+	}
+	context.PwsTransactions.Store(key, transaction)
+	return transaction
+}
+
+func (context *AMFContext) PwsTransactionFind(key PwsTransactionKey) (*PwsTransaction, bool) {
+	if value, ok := context.PwsTransactions.Load(key); ok {
+		return value.(*PwsTransaction), ok
+	} else {
+		return nil, false
+	}
+}
+
+// DeletePwsTransaction stops collecting the responses of the transaction,
+// unless it has been replaced by a newer one
+func (context *AMFContext) DeletePwsTransaction(transaction *PwsTransaction) {
+	if value, ok := context.PwsTransactions.Load(transaction.Key); ok && value.(*PwsTransaction) == transaction {
+		context.PwsTransactions.Delete(transaction.Key)
+	}
+}
+
+// AddResponse records the response of a RAN; the transaction is done when every RAN responded
+func (transaction *PwsTransaction) AddResponse(ran *AmfRan, pdu *ngapType.NGAPPDU) {
+	transaction.mutex.Lock()
+	defer transaction.mutex.Unlock()
+
+	if !transaction.pending[ran] {
+		return
+	}
+	delete(transaction.pending, ran)
+	transaction.responses = append(transaction.responses, PwsResponse{Ran: ran, Pdu: pdu})
+	if len(transaction.pending) == 0 {
+		close(transaction.done)
+	}
+}
+
+// Done is closed when every RAN responded
+func (transaction *PwsTransaction) Done() <-chan struct{} {
+	return transaction.done
+}
+
+// Responses returns the responses received so far
+func (transaction *PwsTransaction) Responses() []PwsResponse {
+	transaction.mutex.Lock()
+	defer transaction.mutex.Unlock()
+	return append([]PwsResponse(nil), transaction.responses...)
+}
+
+// NewPwsTransactionKey returns the key of a warning message from the Message Identifier
+// and Serial Number IEs of the messages of the procedure, which are 16 bit strings
+func NewPwsTransactionKey(procedureCode int64, messageIdentifier *ngapType.MessageIdentifier,
+	serialNumber *ngapType.SerialNumber) PwsTransactionKey {
+	key := PwsTransactionKey{ProcedureCode: procedureCode}
+	if messageIdentifier != nil && len(messageIdentifier.Value.Bytes) >= 2 {
+		key.MessageIdentifier = int32(messageIdentifier.Value.Bytes[0])<<8 | int32(messageIdentifier.Value.Bytes[1])
+	}
+	if serialNumber != nil && len(serialNumber.Value.Bytes) >= 2 {
+		key.SerialNumber = int32(serialNumber.Value.Bytes[0])<<8 | int32(serialNumber.Value.Bytes[1])
+	}
+	return key
+}
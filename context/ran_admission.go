@@ -0,0 +1,115 @@
+package context
+
+import (
+	"fmt"
+	"free5gc/lib/openapi/models"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+type RanAdmissionResult int
+
+const (
+	RanAdmitted RanAdmissionResult = iota
+	RanNotAllowed
+	RanAtCapacity
+)
+
+// RanAdmissionPolicy decides which RANs may set up an NG connection with the AMF
+type RanAdmissionPolicy struct {
+	AllowList       []models.GlobalRanNodeId // when not empty, only the RANs in the list are admitted
+	DenyList        []models.GlobalRanNodeId
+	RanNamePatterns []*regexp.Regexp // when not empty, the RAN name must match one of the patterns
+	MaxRansPerPlmn  map[models.PlmnId]int
+	TimeToWait      int // unit is second, sent to the RANs rejected at capacity
+	// serializes the admissions, so that the limits hold for concurrent NG Setups
+	mutex sync.Mutex
+}
+
+// AdmitRan applies the RAN admission policy to a RAN whose Global RAN Node ID and name
+// are set from its NG Setup Request; the reason of a rejection is returned for logging
+func (context *AMFContext) AdmitRan(ran *AmfRan) (RanAdmissionResult, string) {
+	policy := &context.RanAdmissionPolicy
+	policy.mutex.Lock()
+	defer policy.mutex.Unlock()
+
+	result, reason := policy.admit(ran)
+	ran.Admitted = result == RanAdmitted
+	return result, reason
+}
+
+func (policy *RanAdmissionPolicy) admit(ran *AmfRan) (RanAdmissionResult, string) {
+	if ran.RanId == nil {
+		return RanNotAllowed, "Global RAN Node ID is absent"
+	}
+	ranId := *ran.RanId
+
+	for _, deniedId := range policy.DenyList {
+		if ranIdMatch(deniedId, ranId) {
+			return RanNotAllowed, "RAN is in the deny list"
+		}
+	}
+	if len(policy.AllowList) > 0 {
+		allowed := false
+		for _, allowedId := range policy.AllowList {
+			if ranIdMatch(allowedId, ranId) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return RanNotAllowed, "RAN is not in the allow list"
+		}
+	}
+
+	if len(policy.RanNamePatterns) > 0 {
+		matched := false
+		for _, pattern := range policy.RanNamePatterns {
+			if pattern.MatchString(ran.Name) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return RanNotAllowed, fmt.Sprintf("RAN name \"%s\" does not match the required patterns", ran.Name)
+		}
+	}
+
+	if ranId.PlmnId != nil {
+		if maxNumOfRans, ok := policy.MaxRansPerPlmn[*ranId.PlmnId]; ok {
+			numOfRans := 0
+			AMF_Self().AmfRanPool.Range(func(key, value interface{}) bool {
+				other := value.(*AmfRan)
+				if other != ran && other.Admitted && other.RanId != nil && other.RanId.PlmnId != nil &&
+					*other.RanId.PlmnId == *ranId.PlmnId {
+					numOfRans++
+				}
+				return true
+			})
+			if numOfRans >= maxNumOfRans {
+				return RanAtCapacity, fmt.Sprintf("PLMN[MCC:%s MNC:%s] already has %d RANs connected",
+					ranId.PlmnId.Mcc, ranId.PlmnId.Mnc, numOfRans)
+			}
+		}
+	}
+	return RanAdmitted, ""
+}
+
+// ranIdMatch reports whether ranId matches pattern: the PLMN and the node ID of the pattern
+// are compared when present, so a pattern with a PLMN only matches every RAN of the PLMN
+func ranIdMatch(pattern, ranId models.GlobalRanNodeId) bool {
+	if pattern.PlmnId != nil && (ranId.PlmnId == nil || *pattern.PlmnId != *ranId.PlmnId) {
+		return false
+	}
+	switch {
+	case pattern.GNbId != nil:
+		return ranId.GNbId != nil && strings.EqualFold(pattern.GNbId.GNBValue, ranId.GNbId.GNBValue) &&
+			(pattern.GNbId.BitLength == 0 || pattern.GNbId.BitLength == ranId.GNbId.BitLength)
+	case pattern.NgeNbId != "":
+		return strings.EqualFold(pattern.NgeNbId, ranId.NgeNbId)
+	case pattern.N3IwfId != "":
+		return strings.EqualFold(pattern.N3IwfId, ranId.N3IwfId)
+	}
+	return true
+}
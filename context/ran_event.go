@@ -0,0 +1,70 @@
+package context
+
+import (
+	"free5gc/lib/openapi/models"
+	"free5gc/src/amf/logger"
+	"sync"
+	"time"
+)
+
+const MaxNumOfRanEvents int = 256
+
+type RanEventType string
+
+const (
+	RanEventAssociationUp      RanEventType = "ASSOCIATION_UP"
+	RanEventAssociationRestart RanEventType = "ASSOCIATION_RESTART"
+	RanEventAssociationLost    RanEventType = "ASSOCIATION_LOST"
+	RanEventPeerAddressChange  RanEventType = "PEER_ADDRESS_CHANGE"
+)
+
+// RanEvent records a change of the NG connection with a RAN, for operators
+type RanEvent struct {
+	Type      RanEventType            `json:"type"`
+	TimeStamp time.Time               `json:"timeStamp"`
+	RanId     *models.GlobalRanNodeId `json:"ranId,omitempty"`
+	RanName   string                  `json:"ranName,omitempty"`
+	Address   string                  `json:"address,omitempty"`
+	Detail    string                  `json:"detail,omitempty"`
+	NumOfUe   int                     `json:"numOfUe"`
+}
+
+// ranEventLog keeps the latest MaxNumOfRanEvents RAN events
+type ranEventLog struct {
+	mutex  sync.Mutex
+	events []RanEvent
+}
+
+func (context *AMFContext) AddRanEvent(ran *AmfRan, eventType RanEventType, detail string, numOfUe int) {
+	event := RanEvent{
+		Type:      eventType,
+		TimeStamp: time.Now().UTC(),
+		Detail:    detail,
+		NumOfUe:   numOfUe,
+	}
+	if ran != nil {
+		event.RanId = ran.RanId
+		event.RanName = ran.Name
+		if ran.Conn != nil && ran.Conn.RemoteAddr() != nil {
+			event.Address = ran.Conn.RemoteAddr().String()
+		}
+	}
+	logger.ContextLog.Infof("RAN event %s: RAN[Name: %s, Address: %s] %s", event.Type, event.RanName, event.Address,
+		event.Detail)
+
+	context.RanEventLog.mutex.Lock()
+	defer context.RanEventLog.mutex.Unlock()
+	if len(context.RanEventLog.events) >= MaxNumOfRanEvents {
+		context.RanEventLog.events = context.RanEventLog.events[1:]
+	}
+	context.RanEventLog.events = append(context.RanEventLog.events, event)
+}
+
+// RanEvents returns the recorded RAN events, oldest first
+func (context *AMFContext) RanEvents() []RanEvent {
+	context.RanEventLog.mutex.Lock()
+	defer context.RanEventLog.mutex.Unlock()
+	events := make([]RanEvent, len(context.RanEventLog.events))
+	copy(events, context.RanEventLog.events)
+	return events
+}
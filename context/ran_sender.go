@@ -0,0 +1,162 @@
+package context
+
+import (
+	"errors"
+	"free5gc/lib/openapi/models"
+	"free5gc/src/amf/capture"
+	"free5gc/src/amf/logger"
+	ngap_service "free5gc/src/amf/ngap/service"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrSendQueueFull is returned when an NGAP message is dropped because the send queue of the RAN is full
+var ErrSendQueueFull = errors.New("NGAP send queue is full")
+
+// RanSendStatistics is a snapshot of the send queue of a RAN
+type RanSendStatistics struct {
+	RanId           *models.GlobalRanNodeId `json:"ranId,omitempty"`
+	RanName         string                  `json:"ranName,omitempty"`
+	QueuedMessages  int                     `json:"queuedMessages"`
+	SentMessages    uint64                  `json:"sentMessages"`
+	DroppedMessages uint64                  `json:"droppedMessages"` // the queue was full
+	FailedMessages  uint64                  `json:"failedMessages"`  // the write failed or timed out
+}
+
+// ranSendJob is an NGAP message waiting in the send queue of a RAN; a job without
+// packet only calls done, once the messages queued before it are written
+type ranSendJob struct {
+	packet []byte
+	stream uint16
+	done   func(err error)
+}
+
+// ranSender serializes the writes to the NG connection of a RAN: messages are queued
+// from any goroutine and written by a single writer goroutine, which is started on
+// demand and exits once the queue is drained
+type ranSender struct {
+	mutex   sync.Mutex
+	queue   chan ranSendJob
+	running bool
+
+	sent    uint64
+	dropped uint64
+	failed  uint64
+}
+
+// SendNgap queues an NGAP message to the RAN on the given SCTP stream. When the queue
+// is full the message is dropped and ErrSendQueueFull returned; otherwise done, if not
+// nil, is called from the writer goroutine with the result of the write.
+func (ran *AmfRan) SendNgap(packet []byte, stream uint16, done func(err error)) error {
+	sender := &ran.sender
+	job := ranSendJob{packet: packet, stream: stream, done: done}
+
+	sender.mutex.Lock()
+	if sender.queue == nil {
+		queueSize := AMF_Self().NgapSendQueueSize
+		if queueSize <= 0 {
+			queueSize = 1
+		}
+		sender.queue = make(chan ranSendJob, queueSize)
+	}
+	select {
+	case sender.queue <- job:
+	default:
+		sender.mutex.Unlock()
+		atomic.AddUint64(&sender.dropped, 1)
+		return ErrSendQueueFull
+	}
+	if !sender.running {
+		sender.running = true
+		go ran.runSender()
+	}
+	sender.mutex.Unlock()
+	return nil
+}
+
+func (ran *AmfRan) runSender() {
+	sender := &ran.sender
+	for {
+		var job ranSendJob
+		// the queue is checked under the mutex so that SendNgap never queues to an exiting writer
+		sender.mutex.Lock()
+		select {
+		case job = <-sender.queue:
+			sender.mutex.Unlock()
+		default:
+			sender.running = false
+			sender.mutex.Unlock()
+			return
+		}
+
+		var err error
+		if job.packet != nil {
+			if err = ran.write(job.packet, job.stream); err != nil {
+				atomic.AddUint64(&sender.failed, 1)
+				logger.NgapLog.Errorf("Send to RAN[Name: %s] error: %+v", ran.Name, err)
+			} else {
+				atomic.AddUint64(&sender.sent, 1)
+			}
+		}
+		if job.done != nil {
+			job.done(err)
+		}
+	}
+}
+
+// FlushSendQueue waits until the messages queued so far are written, for at most timeout
+func (ran *AmfRan) FlushSendQueue(timeout time.Duration) bool {
+	flushed := make(chan struct{})
+	if err := ran.SendNgap(nil, 0, func(err error) { close(flushed) }); err != nil {
+		return false
+	}
+
+	select {
+	case <-flushed:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+// write writes one NGAP message to the NG connection within the NGAP write timeout
+func (ran *AmfRan) write(packet []byte, stream uint16) error {
+	if timeout := AMF_Self().NgapWriteTimeout; timeout > 0 {
+		deadline := time.Now().Add(time.Duration(timeout) * time.Millisecond)
+		if err := ran.Conn.SetWriteDeadline(deadline); err != nil {
+			logger.NgapLog.Debugf("Set write deadline error: %+v", err)
+		}
+	}
+
+	var n int
+	var err error
+	if conn, ok := ran.Conn.(ngap_service.Conn); ok {
+		n, err = conn.WriteMsg(packet, &ngap_service.StreamInfo{Stream: stream, PPID: ngap_service.NGAP_PPID})
+	} else {
+		n, err = ran.Conn.Write(packet)
+	}
+	if err != nil {
+		return err
+	}
+	logger.NgapLog.Debugf("Write %d bytes on stream %d", n, stream)
+	if capture.Enabled() {
+		capture.Ngap(ran.Conn.LocalAddr(), ran.Conn.RemoteAddr(), false, stream, packet)
+	}
+	return nil
+}
+
+// SendStatistics returns the statistics of the send queue of the RAN
+func (ran *AmfRan) SendStatistics() RanSendStatistics {
+	stats := RanSendStatistics{
+		RanId:           ran.RanId,
+		RanName:         ran.Name,
+		SentMessages:    atomic.LoadUint64(&ran.sender.sent),
+		DroppedMessages: atomic.LoadUint64(&ran.sender.dropped),
+		FailedMessages:  atomic.LoadUint64(&ran.sender.failed),
+	}
+	ran.sender.mutex.Lock()
+	stats.QueuedMessages = len(ran.sender.queue)
+	ran.sender.mutex.Unlock()
+	return stats
+}
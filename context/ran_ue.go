@@ -7,6 +7,7 @@ import (
 	"free5gc/lib/ngap/ngapType"
 	"free5gc/lib/openapi/models"
 	"free5gc/src/amf/logger"
+	"sync"
 	"time"
 
 	"github.com/mohae/deepcopy"
@@ -27,6 +28,8 @@ type RanUe struct {
 	/* UE identity*/
 	RanUeNgapId int64
 	AmfUeNgapId int64
+	/* SCTP stream of the UE-associated signalling */
+	Stream uint16
 
 	/* HandOver Info*/
 	HandOverType        ngapType.HandoverType
@@ -47,12 +50,16 @@ type RanUe struct {
 	AmfUe *AmfUe
 	Ran   *AmfRan
 
+	/* Location reportings requested to the RAN, map[string]*LocationReporting */
+	LocationReportings sync.Map
 	/* Routing ID */
 	RoutingID string
 	/* Trace Recording Session Reference */
 	Trsr string
 	/* Ue Context Release Action */
 	ReleaseAction RelAction
+	/* Cause of the UE Context Release Request of the RAN */
+	ReleaseRequestCause *models.NgApCause
 	/* context used for AMF Re-allocation procedure */
 	OldAmfName            string
 	InitialUEMessage      []byte
@@ -76,12 +83,14 @@ func (ranUe *RanUe) Remove() error {
 		ranUe.DetachAmfUe()
 	}
 
+	ran.ranUeListMutex.Lock()
 	for index, ranUe1 := range ran.RanUeList {
 		if ranUe1 == ranUe {
 			ran.RanUeList = append(ran.RanUeList[:index], ran.RanUeList[index+1:]...)
 			break
 		}
 	}
+	ran.ranUeListMutex.Unlock()
 	self := AMF_Self()
 	self.RanUePool.Delete(ranUe.AmfUeNgapId)
 	return nil
@@ -104,28 +113,40 @@ func (ranUe *RanUe) SwitchToRan(newRan *AmfRan, ranUeNgapId int64) error {
 	oldRan := ranUe.Ran
 
 	// remove ranUe from oldRan
+	oldRan.ranUeListMutex.Lock()
 	for index, ranUe1 := range oldRan.RanUeList {
 		if ranUe1 == ranUe {
 			oldRan.RanUeList = append(oldRan.RanUeList[:index], oldRan.RanUeList[index+1:]...)
 			break
 		}
 	}
+	oldRan.ranUeListMutex.Unlock()
 
 	// add ranUe to newRan
+	newRan.ranUeListMutex.Lock()
 	newRan.RanUeList = append(newRan.RanUeList, ranUe)
+	newRan.ranUeListMutex.Unlock()
 
 	// switch to newRan
 	ranUe.Ran = newRan
 	ranUe.RanUeNgapId = ranUeNgapId
+	ranUe.Stream = newRan.UeStream(ranUe.AmfUeNgapId)
 
 	logger.ContextLog.Infof("RanUe[RanUeNgapID: %d] Switch to new Ran[Name: %s]", ranUe.RanUeNgapId, ranUe.Ran.Name)
 	return nil
 }
 
-func (ranUe *RanUe) UpdateLocation(userLocationInformation *ngapType.UserLocationInformation) {
+// UpdateLocation updates the location of the UE, and tells if the UE changed of serving cell;
+// the subscribers of the location of the UE are notified of the change
+func (ranUe *RanUe) UpdateLocation(userLocationInformation *ngapType.UserLocationInformation) (changed bool) {
 
 	if userLocationInformation == nil {
-		return
+		return false
+	}
+
+	var lastLocation models.UserLocation
+	if ranUe.AmfUe != nil {
+		lastLocation = ranUe.AmfUe.Location
 	}
 
 	amfSelf := AMF_Self()
@@ -235,4 +256,9 @@ func (ranUe *RanUe) UpdateLocation(userLocationInformation *ngapType.UserLocatio
 	case ngapType.UserLocationInformationPresentNothing:
 	}
 
+	if ranUe.AmfUe != nil && !sameServingCell(ranUe.AmfUe.Location, lastLocation) {
+		ranUe.AmfUe.NotifyEvent(models.AmfEventType_LOCATION_REPORT)
+		return true
+	}
+	return false
 }
@@ -0,0 +1,121 @@
+package context
+
+import (
+	"free5gc/lib/ngap/ngapType"
+	"free5gc/lib/openapi/models"
+	"free5gc/src/amf/logger"
+	"strconv"
+	"time"
+)
+
+// the mobile reachable timer is 4 minutes greater than T3512, TS 24.501 5.3.7
+const mobileReachableTimerMargin = 4 * time.Minute
+
+// StartMobileReachableTimer starts the mobile reachable timer of a UE which enters CM-IDLE over 3GPP
+// access; at expiry the UE is unreachable and its loss of connectivity is reported
+func (ue *AmfUe) StartMobileReachableTimer() {
+	ue.StopMobileReachableTimer()
+
+	ue.MobileReachableTimer = time.AfterFunc(ue.MobileReachableTime(), func() {
+		logger.ContextLog.Infof("UE[%s] mobile reachable timer expires", ue.Supi)
+		ue.SetReachability(models.UeReachability_UNREACHABLE)
+		ue.ReportLossOfConnectivity(models.LossOfConnectivityReason_MAX_DETECTION_TIME_EXPIRED)
+	})
+}
+
+// MobileReachableTime is the duration of the mobile reachable timer, within which a UE in CM-IDLE
+// contacts the network at the latest
+func (ue *AmfUe) MobileReachableTime() time.Duration {
+	t3512 := ue.T3512Value
+	if t3512 <= 0 {
+		t3512 = DefaultT3512
+	}
+	return time.Duration(t3512)*time.Second + mobileReachableTimerMargin
+}
+
+func (ue *AmfUe) StopMobileReachableTimer() {
+	if ue.MobileReachableTimer != nil {
+		ue.MobileReachableTimer.Stop()
+		ue.MobileReachableTimer = nil
+	}
+}
+
+// SetReachability updates the reachability of the UE, and reports its change
+func (ue *AmfUe) SetReachability(reachability models.UeReachability) {
+	if ue.Reachability == reachability {
+		return
+	}
+	ue.Reachability = reachability
+	ue.NotifyEvent(models.AmfEventType_REACHABILITY_REPORT)
+}
+
+// ReportLossOfConnectivity reports that the network lost the connectivity with the UE
+func (ue *AmfUe) ReportLossOfConnectivity(reason models.LossOfConnectivityReason) {
+	ue.LossOfConnectReason = reason
+	ue.NotifyEvent(models.AmfEventType_LOSS_OF_CONNECTIVITY)
+}
+
+// ReportCommunicationFailure reports the RAN and NAS causes of an abnormal release of the N2
+// connection of the UE, or of a failed delivery of NAS to the UE
+func (ue *AmfUe) ReportCommunicationFailure(cause CauseAll) {
+	commFailure := new(models.CommunicationFailure)
+	if cause.NgapCause != nil {
+		ngapCause := *cause.NgapCause
+		commFailure.RanReleaseCode = &ngapCause
+	}
+	if cause.Var5GmmCause != nil {
+		commFailure.NasReleaseCode = strconv.Itoa(int(*cause.Var5GmmCause))
+	}
+	ue.CommFailure = commFailure
+	ue.NotifyEvent(models.AmfEventType_COMMUNICATION_FAILURE_REPORT)
+}
+
+// SetNasReleaseCause records the 5GMM cause of the failed NAS procedure for which the N2 connection
+// of the UE is released
+func (ue *AmfUe) SetNasReleaseCause(anType models.AccessType, cause uint8) {
+	gmmCause := int32(cause)
+	ue.ReleaseCause[anType] = &CauseAll{Var5GmmCause: &gmmCause}
+}
+
+// AbnormalRelease tells if the N2 connection of a UE is released for a failed NAS procedure, or for
+// another reason than the inactivity, the deregistration or the handover of the UE
+func AbnormalRelease(cause CauseAll) bool {
+	if cause.Var5GmmCause != nil {
+		return true
+	}
+	if cause.NgapCause == nil {
+		return false
+	}
+	switch int(cause.NgapCause.Group) {
+	case ngapType.CausePresentRadioNetwork:
+		switch uint64(cause.NgapCause.Value) {
+		case uint64(ngapType.CauseRadioNetworkPresentUserInactivity),
+			uint64(ngapType.CauseRadioNetworkPresentSuccessfulHandover),
+			uint64(ngapType.CauseRadioNetworkPresentReleaseDueToNgranGeneratedReason),
+			uint64(ngapType.CauseRadioNetworkPresentReleaseDueTo5gcGeneratedReason):
+			return false
+		}
+	case ngapType.CausePresentNas:
+		switch uint64(cause.NgapCause.Value) {
+		case uint64(ngapType.CauseNasPresentNormalRelease), uint64(ngapType.CauseNasPresentDeregister):
+			return false
+		}
+	}
+	return true
+}
+
+// InRestrictedServiceArea tells if the UE is in a non-allowed area, or out of the allowed areas, of
+// its service area restriction, where it is only reachable for regulatory prioritized services
+func (ue *AmfUe) InRestrictedServiceArea() bool {
+	if ue.AmPolicyAssociation == nil || ue.AmPolicyAssociation.ServAreaRes == nil {
+		return false
+	}
+	servAreaRes := ue.AmPolicyAssociation.ServAreaRes
+	switch servAreaRes.RestrictionType {
+	case models.RestrictionType_ALLOWED_AREAS:
+		return !TacInAreas(ue.Tai.Tac, servAreaRes.Areas)
+	case models.RestrictionType_NOT_ALLOWED_AREAS:
+		return TacInAreas(ue.Tai.Tac, servAreaRes.Areas)
+	}
+	return false
+}
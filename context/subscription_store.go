@@ -0,0 +1,326 @@
+package context
+
+import (
+	"encoding/json"
+	"fmt"
+	"free5gc/lib/openapi/models"
+	"free5gc/src/amf/logger"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// SubscriptionStore keeps the event subscriptions and the AMF status subscriptions of the AMF,
+// which are reloaded into the context when the AMF restarts
+type SubscriptionStore interface {
+	PutEventSubscription(subscriptionID string, subscription *AMFContextEventSubscription) error
+	DeleteEventSubscription(subscriptionID string) error
+	PutAMFStatusSubscription(subscriptionID string, subscriptionData models.SubscriptionData) error
+	DeleteAMFStatusSubscription(subscriptionID string) error
+	Load() (eventSubscriptions map[string]*AMFContextEventSubscription,
+		amfStatusSubscriptions map[string]models.SubscriptionData, err error)
+	Close() error
+}
+
+// NewSubscriptionStore opens the subscription store of storeType at path: "file" keeps a JSON file per
+// subscription in the directory path, "bolt" keeps the subscriptions in the BoltDB database path
+func NewSubscriptionStore(storeType string, path string) (SubscriptionStore, error) {
+	switch storeType {
+	case "file", "":
+		return newFileSubscriptionStore(path)
+	case "bolt":
+		return newBoltSubscriptionStore(path)
+	default:
+		return nil, fmt.Errorf("Unknown subscription store type: %s", storeType)
+	}
+}
+
+const (
+	eventSubscriptionKind     = "eventSubscriptions"
+	amfStatusSubscriptionKind = "amfStatusSubscriptions"
+)
+
+type fileSubscriptionStore struct {
+	mutex sync.Mutex
+	dir   string
+}
+
+func newFileSubscriptionStore(dir string) (*fileSubscriptionStore, error) {
+	for _, kind := range []string{eventSubscriptionKind, amfStatusSubscriptionKind} {
+		if err := os.MkdirAll(filepath.Join(dir, kind), 0700); err != nil {
+			return nil, err
+		}
+	}
+	return &fileSubscriptionStore{dir: dir}, nil
+}
+
+// put writes a subscription to a temporary file first, so that a crash does not leave it truncated
+func (store *fileSubscriptionStore) put(kind string, subscriptionID string, subscription interface{}) error {
+	data, err := json.Marshal(subscription)
+	if err != nil {
+		return err
+	}
+
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	path := filepath.Join(store.dir, kind, subscriptionID+".json")
+	if err := ioutil.WriteFile(path+".tmp", data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+func (store *fileSubscriptionStore) delete(kind string, subscriptionID string) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	err := os.Remove(filepath.Join(store.dir, kind, subscriptionID+".json"))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+func (store *fileSubscriptionStore) load(kind string, decode func(subscriptionID string, data []byte) error) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	files, err := ioutil.ReadDir(filepath.Join(store.dir, kind))
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		if !strings.HasSuffix(file.Name(), ".json") {
+			continue
+		}
+		data, err := ioutil.ReadFile(filepath.Join(store.dir, kind, file.Name()))
+		if err != nil {
+			return err
+		}
+		if err := decode(strings.TrimSuffix(file.Name(), ".json"), data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (store *fileSubscriptionStore) PutEventSubscription(subscriptionID string,
+	subscription *AMFContextEventSubscription) error {
+	return store.put(eventSubscriptionKind, subscriptionID, subscription)
+}
+
+func (store *fileSubscriptionStore) DeleteEventSubscription(subscriptionID string) error {
+	return store.delete(eventSubscriptionKind, subscriptionID)
+}
+
+func (store *fileSubscriptionStore) PutAMFStatusSubscription(subscriptionID string,
+	subscriptionData models.SubscriptionData) error {
+	return store.put(amfStatusSubscriptionKind, subscriptionID, subscriptionData)
+}
+
+func (store *fileSubscriptionStore) DeleteAMFStatusSubscription(subscriptionID string) error {
+	return store.delete(amfStatusSubscriptionKind, subscriptionID)
+}
+
+func (store *fileSubscriptionStore) Load() (map[string]*AMFContextEventSubscription,
+	map[string]models.SubscriptionData, error) {
+	eventSubscriptions := make(map[string]*AMFContextEventSubscription)
+	amfStatusSubscriptions := make(map[string]models.SubscriptionData)
+	if err := store.load(eventSubscriptionKind, eventSubscriptionDecoder(eventSubscriptions)); err != nil {
+		return nil, nil, err
+	}
+	if err := store.load(amfStatusSubscriptionKind, amfStatusSubscriptionDecoder(amfStatusSubscriptions)); err != nil {
+		return nil, nil, err
+	}
+	return eventSubscriptions, amfStatusSubscriptions, nil
+}
+
+func (store *fileSubscriptionStore) Close() error {
+	return nil
+}
+
+type boltSubscriptionStore struct {
+	db *bolt.DB
+}
+
+func newBoltSubscriptionStore(path string) (*boltSubscriptionStore, error) {
+	db, err := bolt.Open(path, 0600, nil)
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, kind := range []string{eventSubscriptionKind, amfStatusSubscriptionKind} {
+			if _, err := tx.CreateBucketIfNotExists([]byte(kind)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &boltSubscriptionStore{db: db}, nil
+}
+
+func (store *boltSubscriptionStore) put(kind string, subscriptionID string, subscription interface{}) error {
+	data, err := json.Marshal(subscription)
+	if err != nil {
+		return err
+	}
+	return store.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(kind)).Put([]byte(subscriptionID), data)
+	})
+}
+
+func (store *boltSubscriptionStore) delete(kind string, subscriptionID string) error {
+	return store.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(kind)).Delete([]byte(subscriptionID))
+	})
+}
+
+func (store *boltSubscriptionStore) load(kind string, decode func(subscriptionID string, data []byte) error) error {
+	return store.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(kind)).ForEach(func(key, value []byte) error {
+			return decode(string(key), value)
+		})
+	})
+}
+
+func (store *boltSubscriptionStore) PutEventSubscription(subscriptionID string,
+	subscription *AMFContextEventSubscription) error {
+	return store.put(eventSubscriptionKind, subscriptionID, subscription)
+}
+
+func (store *boltSubscriptionStore) DeleteEventSubscription(subscriptionID string) error {
+	return store.delete(eventSubscriptionKind, subscriptionID)
+}
+
+func (store *boltSubscriptionStore) PutAMFStatusSubscription(subscriptionID string,
+	subscriptionData models.SubscriptionData) error {
+	return store.put(amfStatusSubscriptionKind, subscriptionID, subscriptionData)
+}
+
+func (store *boltSubscriptionStore) DeleteAMFStatusSubscription(subscriptionID string) error {
+	return store.delete(amfStatusSubscriptionKind, subscriptionID)
+}
+
+func (store *boltSubscriptionStore) Load() (map[string]*AMFContextEventSubscription,
+	map[string]models.SubscriptionData, error) {
+	eventSubscriptions := make(map[string]*AMFContextEventSubscription)
+	amfStatusSubscriptions := make(map[string]models.SubscriptionData)
+	if err := store.load(eventSubscriptionKind, eventSubscriptionDecoder(eventSubscriptions)); err != nil {
+		return nil, nil, err
+	}
+	if err := store.load(amfStatusSubscriptionKind, amfStatusSubscriptionDecoder(amfStatusSubscriptions)); err != nil {
+		return nil, nil, err
+	}
+	return eventSubscriptions, amfStatusSubscriptions, nil
+}
+
+func (store *boltSubscriptionStore) Close() error {
+	return store.db.Close()
+}
+
+func eventSubscriptionDecoder(subscriptions map[string]*AMFContextEventSubscription) func(string, []byte) error {
+	return func(subscriptionID string, data []byte) error {
+		subscription := new(AMFContextEventSubscription)
+		if err := json.Unmarshal(data, subscription); err != nil {
+			return fmt.Errorf("Event subscription[%s]: %+v", subscriptionID, err)
+		}
+		subscriptions[subscriptionID] = subscription
+		return nil
+	}
+}
+
+func amfStatusSubscriptionDecoder(subscriptions map[string]models.SubscriptionData) func(string, []byte) error {
+	return func(subscriptionID string, data []byte) error {
+		var subscriptionData models.SubscriptionData
+		if err := json.Unmarshal(data, &subscriptionData); err != nil {
+			return fmt.Errorf("AMF status subscription[%s]: %+v", subscriptionID, err)
+		}
+		subscriptions[subscriptionID] = subscriptionData
+		return nil
+	}
+}
+
+// LoadSubscriptions reloads the subscriptions of the subscription store into the context, and
+// reserves their IDs. The UEs of an event subscription are added again when they register.
+func (context *AMFContext) LoadSubscriptions() (eventSubscriptionIDs []string, err error) {
+	if context.SubscriptionStore == nil {
+		return nil, nil
+	}
+	eventSubscriptions, amfStatusSubscriptions, err := context.SubscriptionStore.Load()
+	if err != nil {
+		return nil, err
+	}
+
+	for subscriptionID, subscription := range eventSubscriptions {
+		id, err := strconv.ParseInt(subscriptionID, 10, 32)
+		if err != nil {
+			logger.ContextLog.Errorf("Event subscription[%s] is not reloaded: %+v", subscriptionID, err)
+			continue
+		}
+		context.EventSubscriptionIDGenerator.Reserve(id)
+		subscription.UeSupiList = nil
+		subscription.UeEventSubscription.EventSubscription = &subscription.EventSubscription
+		context.EventSubscriptions.Store(subscriptionID, subscription)
+		eventSubscriptionIDs = append(eventSubscriptionIDs, subscriptionID)
+	}
+
+	numberOfAmfStatusSubscriptions := 0
+	for subscriptionID, subscriptionData := range amfStatusSubscriptions {
+		id, err := strconv.ParseInt(subscriptionID, 10, 64)
+		if err != nil {
+			logger.ContextLog.Errorf("AMF status subscription[%s] is not reloaded: %+v", subscriptionID, err)
+			continue
+		}
+		amfStatusSubscriptionIDGenerator.Reserve(id)
+		numberOfAmfStatusSubscriptions++
+		context.AMFStatusSubscriptions.Store(subscriptionID, subscriptionData)
+	}
+
+	logger.ContextLog.Infof("Reload %d event subscriptions and %d AMF status subscriptions",
+		len(eventSubscriptionIDs), numberOfAmfStatusSubscriptions)
+	return eventSubscriptionIDs, nil
+}
+
+// SaveEventSubscription writes an event subscription which is created or modified to the subscription store
+func (context *AMFContext) SaveEventSubscription(subscriptionID string, subscription *AMFContextEventSubscription) {
+	if context.SubscriptionStore == nil {
+		return
+	}
+	if err := context.SubscriptionStore.PutEventSubscription(subscriptionID, subscription); err != nil {
+		logger.ContextLog.Errorf("Save event subscription[%s] error: %+v", subscriptionID, err)
+	}
+}
+
+func (context *AMFContext) saveAMFStatusSubscription(subscriptionID string, subscriptionData models.SubscriptionData) {
+	if context.SubscriptionStore == nil {
+		return
+	}
+	if err := context.SubscriptionStore.PutAMFStatusSubscription(subscriptionID, subscriptionData); err != nil {
+		logger.ContextLog.Errorf("Save AMF status subscription[%s] error: %+v", subscriptionID, err)
+	}
+}
+
+func (context *AMFContext) removeEventSubscription(subscriptionID string) {
+	if context.SubscriptionStore == nil {
+		return
+	}
+	if err := context.SubscriptionStore.DeleteEventSubscription(subscriptionID); err != nil {
+		logger.ContextLog.Errorf("Remove event subscription[%s] error: %+v", subscriptionID, err)
+	}
+}
+
+func (context *AMFContext) removeAMFStatusSubscription(subscriptionID string) {
+	if context.SubscriptionStore == nil {
+		return
+	}
+	if err := context.SubscriptionStore.DeleteAMFStatusSubscription(subscriptionID); err != nil {
+		logger.ContextLog.Errorf("Remove AMF status subscription[%s] error: %+v", subscriptionID, err)
+	}
+}
@@ -0,0 +1,108 @@
+package context
+
+import (
+	"free5gc/lib/openapi/models"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSubscriptionStoreRoundTrip(t *testing.T) {
+	for _, storeType := range []string{"file", "bolt"} {
+		t.Run(storeType, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "amf-subscriptions")
+			require.NoError(t, err)
+			defer os.RemoveAll(dir)
+			path := dir
+			if storeType == "bolt" {
+				path = filepath.Join(dir, "subscriptions.db")
+			}
+
+			store, err := NewSubscriptionStore(storeType, path)
+			require.NoError(t, err)
+
+			expiry := time.Now().Add(time.Hour).UTC().Round(time.Second)
+			remainReports := int32(3)
+			eventSubscription := &AMFContextEventSubscription{
+				IsAnyUe: true,
+				Expiry:  &expiry,
+				EventSubscription: models.AmfEventSubscription{
+					EventList:      &[]models.AmfEvent{{Type: models.AmfEventType_LOCATION_REPORT}},
+					EventNotifyUri: "http://nef/notify",
+					AnyUE:          true,
+				},
+				UeEventSubscription: AmfUeEventSubscription{AnyUe: true, RemainReports: &remainReports},
+			}
+			amfStatusSubscription := models.SubscriptionData{AmfStatusUri: "http://nf/status"}
+
+			require.NoError(t, store.PutEventSubscription("1", eventSubscription))
+			require.NoError(t, store.PutEventSubscription("2", eventSubscription))
+			require.NoError(t, store.PutAMFStatusSubscription("7", amfStatusSubscription))
+			// the saved remaining reports replace the previous ones
+			remainReports--
+			require.NoError(t, store.PutEventSubscription("1", eventSubscription))
+			require.NoError(t, store.DeleteEventSubscription("2"))
+			require.NoError(t, store.DeleteEventSubscription("unknown"))
+			require.NoError(t, store.Close())
+
+			// the subscriptions are reloaded by a new store at the same path
+			store, err = NewSubscriptionStore(storeType, path)
+			require.NoError(t, err)
+			defer store.Close()
+			eventSubscriptions, amfStatusSubscriptions, err := store.Load()
+			require.NoError(t, err)
+
+			require.Len(t, eventSubscriptions, 1)
+			loaded := eventSubscriptions["1"]
+			require.NotNil(t, loaded)
+			assert.True(t, loaded.IsAnyUe)
+			assert.Equal(t, eventSubscription.EventSubscription, loaded.EventSubscription)
+			if assert.NotNil(t, loaded.Expiry) {
+				assert.True(t, expiry.Equal(*loaded.Expiry))
+			}
+			if assert.NotNil(t, loaded.UeEventSubscription.RemainReports) {
+				assert.Equal(t, int32(2), *loaded.UeEventSubscription.RemainReports)
+			}
+			assert.Equal(t, map[string]models.SubscriptionData{"7": amfStatusSubscription}, amfStatusSubscriptions)
+		})
+	}
+}
+
+func TestReservableIDGenerator(t *testing.T) {
+	generator := NewReservableIDGenerator(1, 5)
+	generator.Reserve(2)
+	generator.Reserve(4)
+
+	var ids []int64
+	for i := 0; i < 3; i++ {
+		id, err := generator.Allocate()
+		require.NoError(t, err)
+		ids = append(ids, id)
+	}
+	assert.Equal(t, []int64{1, 3, 5}, ids)
+	_, err := generator.Allocate()
+	assert.Error(t, err)
+
+	// a reserved ID is allocated again once freed
+	generator.FreeID(4)
+	id, err := generator.Allocate()
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), id)
+
+	// a reserved ID which is freed before the generator reaches it is allocated in turn
+	generator = NewReservableIDGenerator(1, 5)
+	generator.Reserve(2)
+	generator.FreeID(2)
+	ids = nil
+	for i := 0; i < 2; i++ {
+		id, err := generator.Allocate()
+		require.NoError(t, err)
+		ids = append(ids, id)
+	}
+	assert.Equal(t, []int64{1, 2}, ids)
+}
@@ -21,10 +21,16 @@ type Info struct {
 type Configuration struct {
 	AmfName                    string                    `yaml:"amfName,omitempty"`
 	NgapIPList                 []string                  `yaml:"ngapIpList,omitempty"`
+	Ngap                       *Ngap                     `yaml:"ngap,omitempty"`
+	Capture                    *Capture                  `yaml:"capture,omitempty"`
+	SubscriptionStore          *SubscriptionStore        `yaml:"subscriptionStore,omitempty"`
+	RanAdmission               *RanAdmission             `yaml:"ranAdmission,omitempty"`
+	OverloadControl            *OverloadControl          `yaml:"overloadControl,omitempty"`
 	Sbi                        *Sbi                      `yaml:"sbi,omitempty"`
 	ServiceNameList            []string                  `yaml:"serviceNameList,omitempty"`
 	ServedGumaiList            []models.Guami            `yaml:"servedGuamiList,omitempty"`
 	SupportTAIList             []models.Tai              `yaml:"supportTaiList,omitempty"`
+	PresenceReportingAreaList  []models.PresenceInfo     `yaml:"presenceReportingAreaList,omitempty"` // by praId
 	PlmnSupportList            []context.PlmnSupportItem `yaml:"plmnSupportList,omitempty"`
 	SupportDnnList             []string                  `yaml:"supportDnnList,omitempty"`
 	NrfURI                     string                    `yaml:"nrfUri,omitempty"`
@@ -35,6 +41,80 @@ type Configuration struct {
 	Non3gppDeregistrationTimer int                       `yaml:"mon3gppDeregistrationTimer,omitempty"`
 }
 
+// Ngap corresponds to the <root>.configuration.ngap element of an AMF YAML configuration
+type Ngap struct {
+	Transport    string `yaml:"transport,omitempty"`    // sctp (default), tcp or pipe
+	Port         int    `yaml:"port,omitempty"`         // 38412 by default
+	UeQueueSize  int    `yaml:"ueQueueSize,omitempty"`  // inbound queue length of each per-UE NGAP worker
+	RanQueueSize int    `yaml:"ranQueueSize,omitempty"` // inbound queue length of each per-RAN NGAP worker
+	// one listener per address set, whose addresses are the SCTP multi-homing addresses;
+	// ngapIpList is one address set when addressSets is absent
+	AddressSets [][]string `yaml:"addressSets,omitempty"`
+	Ipv6        bool       `yaml:"ipv6,omitempty"` // listen on IPv6 only
+	// SCTP streams; stream 0 carries non-UE-associated signalling, the others are shared by the UEs
+	NumOutStreams int `yaml:"numOutStreams,omitempty"`
+	MaxInStreams  int `yaml:"maxInStreams,omitempty"`
+	// SCTP association parameters; the INIT timeout, RTO and path supervision ones keep the defaults of
+	// the system when absent
+	MaxAttempts       int `yaml:"maxAttempts,omitempty"`       // INIT retransmissions
+	MaxInitTimeout    int `yaml:"maxInitTimeout,omitempty"`    // unit is millisecond
+	RtoInitial        int `yaml:"rtoInitial,omitempty"`        // unit is millisecond
+	RtoMin            int `yaml:"rtoMin,omitempty"`            // unit is millisecond
+	RtoMax            int `yaml:"rtoMax,omitempty"`            // unit is millisecond
+	HeartbeatInterval int `yaml:"heartbeatInterval,omitempty"` // unit is millisecond
+	PathMaxRetrans    int `yaml:"pathMaxRetrans,omitempty"`    // retransmissions before a peer address is unreachable
+
+	MaxMessageSize int `yaml:"maxMessageSize,omitempty"` // largest NGAP message accepted, in bytes
+	SendQueueSize  int `yaml:"sendQueueSize,omitempty"`  // outbound queue length of each RAN
+	WriteTimeout   int `yaml:"writeTimeout,omitempty"`   // unit is millisecond
+}
+
+// Capture corresponds to the <root>.configuration.capture element of an AMF YAML configuration
+type Capture struct {
+	File         string `yaml:"file"`                   // pcapng file, numbered and time stamped per rotation
+	MaxFileSize  int    `yaml:"maxFileSize,omitempty"`  // unit is megabyte
+	MaxFiles     int    `yaml:"maxFiles,omitempty"`     // rotated files kept
+	NasPlaintext bool   `yaml:"nasPlaintext,omitempty"` // also capture deciphered NAS messages
+}
+
+// SubscriptionStore corresponds to the <root>.configuration.subscriptionStore element of an AMF YAML
+// configuration; the event and AMF status subscriptions are kept in memory only when it is absent
+type SubscriptionStore struct {
+	Type string `yaml:"type,omitempty"` // file (default) or bolt
+	Path string `yaml:"path"`           // directory of the files, or BoltDB database file
+}
+
+// RanAdmission corresponds to the <root>.configuration.ranAdmission element of an AMF YAML configuration
+type RanAdmission struct {
+	AllowList       []models.GlobalRanNodeId `yaml:"allowList,omitempty"`       // only these RANs are admitted
+	DenyList        []models.GlobalRanNodeId `yaml:"denyList,omitempty"`        // these RANs are rejected
+	RanNamePatterns []string                 `yaml:"ranNamePatterns,omitempty"` // regular expressions
+	MaxRansPerPlmn  []PlmnRanLimit           `yaml:"maxRansPerPlmn,omitempty"`
+	TimeToWait      int                      `yaml:"timeToWait,omitempty"` // unit is second
+}
+
+// PlmnRanLimit corresponds to an element of <root>.configuration.ranAdmission.maxRansPerPlmn
+type PlmnRanLimit struct {
+	PlmnId       models.PlmnId `yaml:"plmnId"`
+	MaxNumOfRans int           `yaml:"maxNumOfRans"`
+}
+
+// OverloadControl corresponds to the <root>.configuration.overloadControl element of an AMF YAML configuration
+type OverloadControl struct {
+	Enable               bool            `yaml:"enable"`
+	Interval             int             `yaml:"interval,omitempty"` // unit is millisecond
+	UeCapacity           int             `yaml:"ueCapacity,omitempty"`
+	MaxQueuedMessages    int             `yaml:"maxQueuedMessages,omitempty"`
+	MaxSbiRequests       int             `yaml:"maxSbiRequests,omitempty"`
+	MaxCpuLoad           int             `yaml:"maxCpuLoad,omitempty"`     // percent
+	StartThreshold       int             `yaml:"startThreshold,omitempty"` // percent of the load
+	StopThreshold        int             `yaml:"stopThreshold,omitempty"`  // percent of the load
+	OverloadAction       string          `yaml:"overloadAction,omitempty"`
+	TrafficLoadReduction int             `yaml:"trafficLoadReduction,omitempty"` // percent
+	SNssaiList           []models.Snssai `yaml:"sNssaiList,omitempty"`
+	RelativeCapacity     *int            `yaml:"relativeCapacity,omitempty"` // while overloaded
+}
+
 // Sbi corresponds to the <root>.configuration.sbi element of an AMF YAML configuration
 type Sbi struct {
 	Scheme       string `yaml:"scheme"`
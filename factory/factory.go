@@ -3,6 +3,7 @@ package factory
 import (
 	"fmt"
 	"io/ioutil"
+	"regexp"
 
 	"gopkg.in/yaml.v2"
 
@@ -32,5 +33,19 @@ func InitConfigFactory(f string) {
 	err = yaml.Unmarshal([]byte(content), &AmfConfig)
 	checkErr(err)
 
+	if configuration := AmfConfig.Configuration; configuration != nil && configuration.RanAdmission != nil {
+		checkErr(checkRanAdmission(configuration.RanAdmission))
+	}
+
 	logger.InitLog.Infof("Successfully initialize configuration %s", f)
 }
+
+// checkRanAdmission returns an error if a RAN name pattern is not a valid regular expression
+func checkRanAdmission(ranAdmission *RanAdmission) error {
+	for _, pattern := range ranAdmission.RanNamePatterns {
+		if _, err := regexp.Compile(pattern); err != nil {
+			return fmt.Errorf("invalid RAN name pattern '%s': %s", pattern, err.Error())
+		}
+	}
+	return nil
+}
@@ -27,6 +27,7 @@ import (
 	"reflect"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/antihax/optional"
@@ -108,15 +109,23 @@ func HandleULNASTransport(ue *context.AmfUe, anType models.AccessType,
 			return HandleStatus5GSM(ue, anType, ulNasTransport.PayloadContainer.Buffer, pduSessionId)
 		}
 	case nasMessage.PayloadContainerTypeSMS:
-		return fmt.Errorf("PayloadContainerTypeSMS has not been implemented yet in UL NAS TRANSPORT")
+		logger.GmmLog.Infoln("AMF Transfer SMS To SMSF")
+		return forwardN1Message(ue, models.N1MessageClass_SMS,
+			ulNasTransport.PayloadContainer.GetPayloadContainerContents())
 	case nasMessage.PayloadContainerTypeLPP:
-		return fmt.Errorf("PayloadContainerTypeLPP has not been implemented yet in UL NAS TRANSPORT")
+		logger.GmmLog.Infoln("AMF Transfer LPP To LMF")
+		return forwardN1Message(ue, models.N1MessageClass_LPP,
+			ulNasTransport.PayloadContainer.GetPayloadContainerContents())
+	case payloadContainerTypeLCS:
+		logger.GmmLog.Infoln("AMF Transfer LCS To LMF")
+		return forwardN1Message(ue, models.N1MessageClass_LCS,
+			ulNasTransport.PayloadContainer.GetPayloadContainerContents())
 	case nasMessage.PayloadContainerTypeSOR:
 		return fmt.Errorf("PayloadContainerTypeSOR has not been implemented yet in UL NAS TRANSPORT")
 	case nasMessage.PayloadContainerTypeUEPolicy:
 		logger.GmmLog.Infoln("AMF Transfer UEPolicy To PCF")
-		callback.SendN1MessageNotify(ue, models.N1MessageClass_UPDP,
-			ulNasTransport.PayloadContainer.GetPayloadContainerContents(), nil)
+		return forwardN1Message(ue, models.N1MessageClass_UPDP,
+			ulNasTransport.PayloadContainer.GetPayloadContainerContents())
 	case nasMessage.PayloadContainerTypeUEParameterUpdate:
 		logger.GmmLog.Infoln("AMF Transfer UEParameterUpdate To UDM")
 		upuMac, err := nasConvert.UpuAckToModels(ulNasTransport.PayloadContainer.GetPayloadContainerContents())
@@ -134,6 +143,124 @@ func HandleULNASTransport(ue *context.AmfUe, anType models.AccessType,
 	return nil
 }
 
+// nonSmN2InformationHoldTime is how long a paged transfer of non SM N2 information waits for the UE to be
+// CM-CONNECTED after it answered the paging
+const nonSmN2InformationHoldTime = 10 * time.Second
+
+// payloadContainerTypeLCS is the payload container type of the location services message container
+// (TS 24.501 9.11.3.40)
+const payloadContainerTypeLCS uint8 = 0x07
+
+// n1MessageConsumerNfType is the type of the NF which consumes the N1 messages of a class by default
+var n1MessageConsumerNfType = map[models.N1MessageClass]models.NfType{
+	models.N1MessageClass_SMS:  models.NfType_SMSF,
+	models.N1MessageClass_LPP:  models.NfType_LMF,
+	models.N1MessageClass_LCS:  models.NfType_LMF,
+	models.N1MessageClass_UPDP: models.NfType_PCF,
+}
+
+// n1MessageQueue holds the uplink N1 messages until the forwarder goroutine notifies them, so that the
+// handling of the UE does not wait for the NRF and the consumers of the messages
+var n1MessageQueue struct {
+	mutex    sync.Mutex
+	messages []n1Message
+	running  bool
+}
+
+type n1Message struct {
+	ue      *context.AmfUe
+	supi    string
+	class   models.N1MessageClass
+	content []byte
+}
+
+// defaultN1MessageConsumers caches the callback URI of the default consumer of the classes whose consumer
+// is not selected for the UE, map[models.N1MessageClass]string
+var defaultN1MessageConsumers sync.Map
+
+// forwardN1Message queues an uplink N1 message, which is notified to the NFs which subscribed to its class;
+// if none did, the message is notified to the default consumer of the class
+func forwardN1Message(ue *context.AmfUe, n1MessageClass models.N1MessageClass, n1Msg []byte) error {
+	if _, ok := n1MessageConsumerNfType[n1MessageClass]; !ok {
+		return fmt.Errorf("No consumer of %s N1 messages", n1MessageClass)
+	}
+
+	n1MessageQueue.mutex.Lock()
+	defer n1MessageQueue.mutex.Unlock()
+	n1MessageQueue.messages = append(n1MessageQueue.messages, n1Message{
+		ue:      ue,
+		supi:    ue.Supi,
+		class:   n1MessageClass,
+		content: n1Msg,
+	})
+	if !n1MessageQueue.running {
+		n1MessageQueue.running = true
+		go runN1MessageForwarder()
+	}
+	return nil
+}
+
+// runN1MessageForwarder notifies the queued N1 messages in order, until the queue is empty
+func runN1MessageForwarder() {
+	for {
+		n1MessageQueue.mutex.Lock()
+		messages := n1MessageQueue.messages
+		n1MessageQueue.messages = nil
+		if len(messages) == 0 {
+			n1MessageQueue.running = false
+			n1MessageQueue.mutex.Unlock()
+			return
+		}
+		n1MessageQueue.mutex.Unlock()
+
+		for _, message := range messages {
+			if err := notifyN1Message(message); err != nil {
+				logger.GmmLog.Errorf("Forward %s N1 message of UE[%s] error: %+v", message.class, message.supi, err)
+			}
+		}
+	}
+}
+
+func notifyN1Message(message n1Message) error {
+	if callback.SendN1MessageNotify(message.ue, message.class, message.content, nil) {
+		return nil
+	}
+
+	callbackUri, err := defaultN1MessageConsumer(message)
+	if err != nil {
+		return err
+	}
+	if !callback.SendN1MessageNotifyToDefaultConsumer(message.class, message.content, callbackUri) {
+		// the default consumer is discovered again for the next message
+		defaultN1MessageConsumers.Delete(message.class)
+		return fmt.Errorf("Notify %s N1 message to [%s] failed", message.class, callbackUri)
+	}
+	return nil
+}
+
+// defaultN1MessageConsumer returns the callback URI of the default consumer of the class of an N1
+// message discovered by NRF; the PCF and the SMSF are discovered for the SUPI of the UE each time
+func defaultN1MessageConsumer(message n1Message) (string, error) {
+	nfType := n1MessageConsumerNfType[message.class]
+	param := Nnrf_NFDiscovery.SearchNFInstancesParamOpts{}
+	selectedForUe := nfType == models.NfType_PCF || nfType == models.NfType_SMSF
+	if selectedForUe {
+		param.Supi = optional.NewString(message.supi)
+	} else if callbackUri, ok := defaultN1MessageConsumers.Load(message.class); ok {
+		return callbackUri.(string), nil
+	}
+
+	callbackUri, err := consumer.SearchDefaultN1MessageConsumer(context.AMF_Self().NrfUri, nfType, models.NfType_AMF,
+		message.class, &param)
+	if err != nil {
+		return "", err
+	}
+	if !selectedForUe {
+		defaultN1MessageConsumers.Store(message.class, callbackUri)
+	}
+	return callbackUri, nil
+}
+
 func HandlePDUSessionEstablishmentRequest(ue *context.AmfUe, anType models.AccessType, payload []byte,
 	pduSessionID int32, requestType models.RequestType, sNssai *models.Snssai, dnn string) error {
 
@@ -859,6 +986,16 @@ func HandleInitialRegistration(ue *context.AmfUe, anType models.AccessType) erro
 		logger.GmmLog.Errorf("AM Policy Control Create Error[%+v]", err)
 	}
 
+	// the UE policy association is per UE, the PCF delivers the UE policies over any access
+	if ue.UePolicyAssociation == nil {
+		problemDetails, err := consumer.UEPolicyControlCreate(ue, anType)
+		if problemDetails != nil {
+			logger.GmmLog.Errorf("UE Policy Control Create Failed Problem[%+v]", problemDetails)
+		} else if err != nil {
+			logger.GmmLog.Errorf("UE Policy Control Create Error[%+v]", err)
+		}
+	}
+
 	// Service Area Restriction are applicable only to 3GPP access
 	if anType == models.AccessType__3_GPP_ACCESS {
 		if ue.AmPolicyAssociation != nil && ue.AmPolicyAssociation.ServAreaRes != nil {
@@ -1086,8 +1223,8 @@ func HandleMobilityAndPeriodicRegistrationUpdating(ue *context.AmfUe, anType mod
 			n1Msg := ue.N1N2Message.Request.BinaryDataN1Message
 			n2Info := ue.N1N2Message.Request.BinaryDataN2Information
 
-			// downlink signalling
-			if n2Info == nil {
+			// downlink signalling, the non SM N2 information is transferred once the UE is registered
+			if n2Info == nil || requestData.N2InfoContainer.N2InformationClass != models.N2InformationClass_SM {
 				if len(suList.List) != 0 {
 					nasPdu, err := gmm_message.BuildRegistrationAccept(ue, anType, pduSessionStatus,
 						reactivationResult, errPduSessionId, errCause)
@@ -1099,6 +1236,10 @@ func HandleMobilityAndPeriodicRegistrationUpdating(ue *context.AmfUe, anType mod
 					gmm_message.SendRegistrationAccept(ue, anType, pduSessionStatus,
 						reactivationResult, errPduSessionId, errCause, &ctxList)
 				}
+				if n2Info != nil {
+					holdNonSmN2Information(ue)
+					return nil
+				}
 				switch requestData.N1MessageContainer.N1MessageClass {
 				case models.N1MessageClass_SM:
 					gmm_message.SendDLNASTransport(ue.RanUe[anType], nasMessage.PayloadContainerTypeN1SMInfo,
@@ -1745,6 +1886,7 @@ func HandleServiceRequest(ue *context.AmfUe, anType models.AccessType,
 	if !ue.SecurityContextIsValid() {
 		logger.GmmLog.Warnf("No Security Context : SUPI[%s]", ue.Supi)
 		gmm_message.SendServiceReject(ue.RanUe[anType], nil, nasMessage.Cause5GMMUEIdentityCannotBeDerivedByTheNetwork)
+		ue.SetNasReleaseCause(anType, nasMessage.Cause5GMMUEIdentityCannotBeDerivedByTheNetwork)
 		ngap_message.SendUEContextReleaseCommand(ue.RanUe[anType],
 			context.UeContextN2NormalRelease, ngapType.CausePresentNas, ngapType.CauseNasPresentNormalRelease)
 		return nil
@@ -1771,9 +1913,6 @@ func HandleServiceRequest(ue *context.AmfUe, anType models.AccessType,
 		if ue.N1N2Message.Request.BinaryDataN2Information != nil {
 			if requestData.N2InfoContainer.N2InformationClass == models.N2InformationClass_SM {
 				targetPduSessionId = requestData.N2InfoContainer.SmInfo.PduSessionId
-			} else {
-				ue.N1N2Message = nil
-				return fmt.Errorf("Service Request triggered by Network has not implemented about non SM N2Info")
 			}
 		}
 	}
@@ -1845,13 +1984,17 @@ func HandleServiceRequest(ue *context.AmfUe, anType models.AccessType,
 			n1Msg := ue.N1N2Message.Request.BinaryDataN1Message
 			n2Info := ue.N1N2Message.Request.BinaryDataN2Information
 
-			// downlink signalling
-			if n2Info == nil {
+			// downlink signalling, the non SM N2 information is transferred once the Service Request is accepted
+			if n2Info == nil || requestData.N2InfoContainer.N2InformationClass != models.N2InformationClass_SM {
 				err := sendServiceAccept(ue, anType, ctxList, suList, acceptPduSessionPsi,
 					reactivationResult, errPduSessionId, errCause)
 				if err != nil {
 					return err
 				}
+				if n2Info != nil {
+					holdNonSmN2Information(ue)
+					return nil
+				}
 				switch requestData.N1MessageContainer.N1MessageClass {
 				case models.N1MessageClass_SM:
 					gmm_message.SendDLNASTransport(ue.RanUe[anType],
@@ -1994,6 +2137,15 @@ func HandleServiceRequest(ue *context.AmfUe, anType models.AccessType,
 	return nil
 }
 
+// holdNonSmN2Information holds the paged transfer of non SM N2 information, which is transferred with the
+// other held transfers once the UE is registered or its Service Request is accepted
+func holdNonSmN2Information(ue *context.AmfUe) {
+	ue.HoldN1N2Message(ue.N1N2Message, nonSmN2InformationHoldTime, func(message *context.N1N2Message) {
+		callback.SendHeldN1N2TransferFailureNotification(message, models.N1N2MessageTransferCause_UE_NOT_RESPONDING)
+	})
+	ue.N1N2Message = nil
+}
+
 func sendServiceAccept(ue *context.AmfUe, anType models.AccessType, ctxList ngapType.PDUSessionResourceSetupListCxtReq,
 	suList ngapType.PDUSessionResourceSetupListSUReq, pDUSessionStatus *[16]bool,
 	reactivationResult *[16]bool, errPduSessionId, errCause []uint8) error {
@@ -2338,22 +2490,29 @@ func HandleDeregistrationRequest(ue *context.AmfUe, anType models.AccessType,
 		}
 	}
 
-	if ue.AmPolicyAssociation != nil {
-		terminateAmPolicyAssocaition := true
-		switch anType {
-		case models.AccessType__3_GPP_ACCESS:
-			terminateAmPolicyAssocaition = ue.State[models.AccessType_NON_3_GPP_ACCESS].Is(context.Deregistered)
-		case models.AccessType_NON_3_GPP_ACCESS:
-			terminateAmPolicyAssocaition = ue.State[models.AccessType__3_GPP_ACCESS].Is(context.Deregistered)
+	terminatePolicyAssociations := true
+	switch anType {
+	case models.AccessType__3_GPP_ACCESS:
+		terminatePolicyAssociations = ue.State[models.AccessType_NON_3_GPP_ACCESS].Is(context.Deregistered)
+	case models.AccessType_NON_3_GPP_ACCESS:
+		terminatePolicyAssociations = ue.State[models.AccessType__3_GPP_ACCESS].Is(context.Deregistered)
+	}
+
+	if ue.AmPolicyAssociation != nil && terminatePolicyAssociations {
+		problemDetails, err := consumer.AMPolicyControlDelete(ue)
+		if problemDetails != nil {
+			logger.GmmLog.Errorf("AM Policy Control Delete Failed Problem[%+v]", problemDetails)
+		} else if err != nil {
+			logger.GmmLog.Errorf("AM Policy Control Delete Error[%v]", err.Error())
 		}
+	}
 
-		if terminateAmPolicyAssocaition {
-			problemDetails, err := consumer.AMPolicyControlDelete(ue)
-			if problemDetails != nil {
-				logger.GmmLog.Errorf("AM Policy Control Delete Failed Problem[%+v]", problemDetails)
-			} else if err != nil {
-				logger.GmmLog.Errorf("AM Policy Control Delete Error[%v]", err.Error())
-			}
+	if ue.UePolicyAssociation != nil && terminatePolicyAssociations {
+		problemDetails, err := consumer.UEPolicyControlDelete(ue)
+		if problemDetails != nil {
+			logger.GmmLog.Errorf("UE Policy Control Delete Failed Problem[%+v]", problemDetails)
+		} else if err != nil {
+			logger.GmmLog.Errorf("UE Policy Control Delete Error[%v]", err.Error())
 		}
 	}
 
@@ -58,6 +58,9 @@ func Registered(state *fsm.State, event fsm.EventType, args fsm.ArgsType) {
 		amfUe := args[ArgAmfUe].(*context.AmfUe)
 		accessType := args[ArgAccessType].(models.AccessType)
 		amfUe.ClearRegistrationRequestData(accessType)
+		amfUe.NotifyEvent(models.AmfEventType_REGISTRATION_STATE_REPORT)
+		amfUe.NotifyEvent(models.AmfEventType_ACCESS_TYPE_REPORT)
+		amfUe.TransferPendingN1N2Messages()
 	case GmmMessageEvent:
 		amfUe := args[ArgAmfUe].(*context.AmfUe)
 		procedureCode := args[ArgProcedureCode].(int64)
@@ -88,6 +91,8 @@ func Registered(state *fsm.State, event fsm.EventType, args fsm.ArgsType) {
 		case nas.MsgTypeServiceRequest:
 			if err := HandleServiceRequest(amfUe, accessType, gmmMessage.ServiceRequest); err != nil {
 				logger.GmmLog.Errorln(err)
+			} else {
+				amfUe.TransferPendingN1N2Messages()
 			}
 		case nas.MsgTypeNotificationResponse:
 			if err := HandleNotificationResponse(amfUe, gmmMessage.NotificationResponse); err != nil {
@@ -375,6 +380,14 @@ func DeregisteredInitiated(state *fsm.State, event fsm.EventType, args fsm.ArgsT
 		logger.GmmLog.Debugln(event)
 	case fsm.ExitEvent:
 		logger.GmmLog.Debugln(event)
+		// the UE is no longer registered for this access
+		amfUe := args[ArgAmfUe].(*context.AmfUe)
+		amfUe.NotifyEvent(models.AmfEventType_REGISTRATION_STATE_REPORT)
+		amfUe.NotifyEvent(models.AmfEventType_ACCESS_TYPE_REPORT)
+		if accessType, ok := args[ArgAccessType].(models.AccessType); !ok || accessType == models.AccessType__3_GPP_ACCESS {
+			amfUe.StopMobileReachableTimer()
+		}
+		amfUe.ReportLossOfConnectivity(models.LossOfConnectivityReason_DEREGISTERED)
 	default:
 		logger.GmmLog.Errorf("Unknown event [%+v]", event)
 	}
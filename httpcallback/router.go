@@ -93,10 +93,24 @@ var routes = Routes{
 		HTTPAmPolicyControlUpdateNotifyTerminate,
 	},
 
+	{
+		"UePolicyControlNotifyTerminate",
+		strings.ToUpper("Post"),
+		"/ue-policy/:polAssoId/terminate",
+		HTTPUePolicyControlNotifyTerminate,
+	},
+
 	{
 		"N1MessageNotify",
 		strings.ToUpper("Post"),
 		"/n1-message-notify",
 		HTTPN1MessageNotify,
 	},
+
+	{
+		"SdmDataChangeNotify",
+		strings.ToUpper("Post"),
+		"/sdm-notify/:supi",
+		HTTPSdmDataChangeNotify,
+	},
 }
@@ -29,6 +29,7 @@ var NasLog *logrus.Entry
 var ConsumerLog *logrus.Entry
 var EeLog *logrus.Entry
 var GinLog *logrus.Entry
+var CaptureLog *logrus.Entry
 
 func init() {
 	log = logrus.New()
@@ -69,6 +70,7 @@ func init() {
 	ConsumerLog = log.WithFields(logrus.Fields{"component": "AMF", "category": "Consumer"})
 	EeLog = log.WithFields(logrus.Fields{"component": "AMF", "category": "EventExposure"})
 	GinLog = log.WithFields(logrus.Fields{"component": "AMF", "category": "GIN"})
+	CaptureLog = log.WithFields(logrus.Fields{"component": "AMF", "category": "Capture"})
 }
 
 func SetLogLevel(level logrus.Level) {
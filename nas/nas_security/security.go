@@ -6,6 +6,7 @@ import (
 	"free5gc/lib/nas"
 	"free5gc/lib/nas/security"
 	"free5gc/lib/openapi/models"
+	"free5gc/src/amf/capture"
 	"free5gc/src/amf/context"
 	"free5gc/src/amf/logger"
 	"reflect"
@@ -51,6 +52,7 @@ func Encode(ue *context.AmfUe, msg *nas.Message) ([]byte, error) {
 		logger.NasLog.Tracef("payload:\n%+v", hex.Dump(payload))
 
 		if needCiphering {
+			capture.NasPlaintext(ue.Supi, false, payload)
 			logger.NasLog.Debugln("Perform NAS encryption")
 			if err = security.NASEncrypt(ue.CipheringAlg, ue.KnasEnc, ue.DLCount.Get(), security.Bearer3GPP,
 				security.DirectionDownlink, payload); err != nil {
@@ -191,6 +193,7 @@ func Decode(ue *context.AmfUe, accessType models.AccessType, payload []byte) (*n
 				security.DirectionUplink, payload[1:]); err != nil {
 				return nil, fmt.Errorf("Encrypt error: %+v", err)
 			}
+			capture.NasPlaintext(ue.Supi, true, payload[1:])
 		}
 
 		// remove sequece Number
@@ -0,0 +1,115 @@
+package ngap
+
+import (
+	"free5gc/lib/ngap/ngapType"
+	"free5gc/lib/openapi/models"
+	"free5gc/src/amf/consumer"
+	"free5gc/src/amf/context"
+	ngap_service "free5gc/src/amf/ngap/service"
+	"free5gc/src/amf/util"
+	"net"
+	"sync"
+)
+
+// HandleAssociationEvent handles the association events reported by the NGAP transport
+func HandleAssociationEvent(conn net.Conn, event *ngap_service.Event) {
+	amfSelf := context.AMF_Self()
+
+	ran, ok := amfSelf.AmfRanFindByConn(conn)
+	switch event.Type {
+	case ngap_service.EventAssociationUp:
+		if !ok {
+			Ngaplog.Infof("Create a new NG connection for: %s", conn.RemoteAddr().String())
+			ran = amfSelf.NewAmfRan(conn)
+		}
+		ran.OutboundStreams = event.OutboundStreams
+		amfSelf.AddRanEvent(ran, context.RanEventAssociationUp, event.String(), 0)
+	case ngap_service.EventAssociationRestart:
+		if !ok {
+			return
+		}
+		// the peer restarted and lost its UE contexts, while the RAN itself is kept
+		ngapDispatcher.enqueueRanJob(ran, func() {
+			numOfUe := releaseRanUes(ran)
+			ran.OutboundStreams = event.OutboundStreams
+			amfSelf.AddRanEvent(ran, context.RanEventAssociationRestart, event.String(), numOfUe)
+		})
+	case ngap_service.EventAssociationLost:
+		if !ok {
+			return
+		}
+		ngapDispatcher.enqueueRanJob(ran, func() { releaseRan(ran, event.Cause) })
+	case ngap_service.EventPeerAddressChange:
+		if !ok {
+			return
+		}
+		amfSelf.AddRanEvent(ran, context.RanEventPeerAddressChange, event.String(), 0)
+	}
+}
+
+// releaseRan removes a RAN whose NG connection is gone. Its UEs enter CM-IDLE but
+// stay registered, and the SMFs deactivate the user plane of their PDU sessions.
+func releaseRan(ran *context.AmfRan, cause string) {
+	Ngaplog.Warnf("Release RAN[Name: %s, ID: %+v]: %s", ran.Name, ran.RanId, cause)
+
+	numOfUe := releaseRanUes(ran)
+	amfSelf := context.AMF_Self()
+	amfSelf.DeleteAmfRan(ran.Conn)
+	amfSelf.AddRanEvent(ran, context.RanEventAssociationLost, cause, numOfUe)
+}
+
+// releaseRanUes releases the N2 connection of every UE of the RAN without
+// signalling towards the RAN, and returns the number of released UEs. Every UE
+// is released on its own worker; releaseRanUes returns once all of them are released.
+func releaseRanUes(ran *context.AmfRan) int {
+	ranUeList := ran.RanUeListSnapshot()
+
+	var wg sync.WaitGroup
+	wg.Add(len(ranUeList))
+	for _, ranUe := range ranUeList {
+		ranUe := ranUe
+		ngapDispatcher.enqueueUeJob(ranUe, func() {
+			defer wg.Done()
+			releaseRanUe(ran, ranUe)
+		})
+	}
+	wg.Wait()
+	return len(ranUeList)
+}
+
+// releaseRanUe releases the N2 connection of a UE of a lost RAN; the SMFs deactivate
+// the user plane of its PDU sessions asynchronously
+func releaseRanUe(ran *context.AmfRan, ranUe *context.RanUe) {
+	causeAll := context.CauseAll{
+		NgapCause: &models.NgApCause{
+			Group: int32(ngapType.CausePresentTransport),
+			Value: int32(ngapType.CauseTransportPresentTransportResourceUnavailable),
+		},
+	}
+
+	amfUe := ranUe.AmfUe
+	if amfUe != nil {
+		// NAS procedures on the lost N2 connection cannot complete
+		util.StopT3522(amfUe)
+		util.StopT3550(amfUe)
+		util.StopT3560(amfUe)
+		util.StopT3565(amfUe)
+
+		if amfUe.State[ran.AnType].Is(context.Registered) {
+			for pduSessionID, smContext := range amfUe.SmContextList {
+				if smContext.PduSessionContext == nil || smContext.PduSessionContext.AccessType != ran.AnType {
+					continue
+				}
+				consumer.SendUpdateSmContextDeactivateUpCnxStateAsync(amfUe, pduSessionID, causeAll)
+			}
+		}
+		Ngaplog.Infof("UE[%s] enters CM-IDLE due to NG connection loss", amfUe.Supi)
+	}
+
+	if ranUe.SourceUe != nil || ranUe.TargetUe != nil {
+		context.DetachSourceUeTargetUe(ranUe)
+	}
+	if err := ranUe.Remove(); err != nil {
+		Ngaplog.Errorln(err.Error())
+	}
+}
@@ -1,10 +1,12 @@
 package ngap
 
 import (
+	"free5gc/lib/aper"
 	"free5gc/lib/ngap"
 	"free5gc/lib/ngap/ngapType"
 	"free5gc/src/amf/context"
 	"free5gc/src/amf/logger"
+	ngap_message "free5gc/src/amf/ngap/message"
 	"net"
 
 	"github.com/sirupsen/logrus"
@@ -26,18 +28,72 @@ func Dispatch(conn net.Conn, msg []byte) {
 		ran = amfSelf.NewAmfRan(conn)
 	}
 
-	if len(msg) == 0 {
-		Ngaplog.Infof("RAN[ID: %+v] close the connection.", ran.RanId)
-		ran.Remove()
-		return
-	}
-
 	pdu, err := ngap.Decoder(msg)
 	if err != nil {
 		Ngaplog.Errorf("NGAP decode error : %s\n", err)
 		return
 	}
 
+	ngapDispatcher.enqueue(ran, pdu)
+}
+
+// HandleOversizedMessage answers a message which exceeds the maximum message size with
+// an Error Indication. The message cannot be decoded, but the start of its APER
+// encoding tells the procedure it belongs to, which is reported in the criticality diagnostics.
+func HandleOversizedMessage(conn net.Conn, head []byte, size int) {
+	amfSelf := context.AMF_Self()
+
+	ran, ok := amfSelf.AmfRanFindByConn(conn)
+	if !ok {
+		Ngaplog.Infof("Create a new NG connection for: %s", conn.RemoteAddr().String())
+		ran = amfSelf.NewAmfRan(conn)
+	}
+	Ngaplog.Errorf("RAN[ID: %+v] sent a message of %d bytes, which is larger than the maximum message size",
+		ran.RanId, size)
+
+	cause := ngapType.Cause{
+		Present: ngapType.CausePresentMisc,
+		Misc: &ngapType.CauseMisc{
+			Value: ngapType.CauseMiscPresentUnspecified,
+		},
+	}
+
+	var criticalityDiagnostics *ngapType.CriticalityDiagnostics
+	// the NGAP-PDU choice is in the top bits of the first octet, the procedure code and
+	// the criticality follow in the next two octets
+	if len(head) >= 3 {
+		var triggeringMessage aper.Enumerated
+		switch head[0] >> 5 {
+		case 0:
+			triggeringMessage = ngapType.TriggeringMessagePresentInitiatingMessage
+		case 1:
+			triggeringMessage = ngapType.TriggeringMessagePresentSuccessfulOutcome
+		default:
+			triggeringMessage = ngapType.TriggeringMessagePresentUnsuccessfullOutcome
+		}
+		procedureCode := int64(head[1])
+		procedureCriticality := aper.Enumerated(head[2] >> 6)
+		diagnostics := buildCriticalityDiagnostics(&procedureCode, &triggeringMessage, &procedureCriticality, nil)
+		criticalityDiagnostics = &diagnostics
+	}
+
+	ngapDispatcher.enqueueRanJob(ran, func() {
+		ngap_message.SendErrorIndication(ran, nil, nil, &cause, criticalityDiagnostics)
+	})
+}
+
+// dispatchPdu runs the handler of a decoded NGAP PDU; it is called from the
+// worker which owns the UE or the RAN the PDU belongs to
+func dispatchPdu(ran *context.AmfRan, pdu *ngapType.NGAPPDU) {
+	if !validatePdu(ran, pdu) {
+		return
+	}
+	// NG Setup is the first procedure on an NG connection, TS 38.413 8.7.1
+	if !ran.Admitted && !isNGSetupRequest(pdu) {
+		Ngaplog.Warnf("RAN[ID: %+v] has not completed the NG Setup, discard the message", ran.RanId)
+		return
+	}
+
 	switch pdu.Present {
 	case ngapType.NGAPPDUPresentInitiatingMessage:
 		initiatingMessage := pdu.InitiatingMessage
@@ -92,8 +148,13 @@ func Dispatch(conn net.Conn, msg []byte) {
 			HandleUplinkRanStatusTransfer(ran, pdu)
 		case ngapType.ProcedureCodeUplinkNonUEAssociatedNRPPaTransport:
 			HandleUplinkNonUEAssociatedNRPPATransport(ran, pdu)
+		case ngapType.ProcedureCodePWSRestartIndication:
+			HandlePWSRestartIndication(ran, pdu)
+		case ngapType.ProcedureCodePWSFailureIndication:
+			HandlePWSFailureIndication(ran, pdu)
 		default:
 			Ngaplog.Warnf("Not implemented(choice:%d, procedureCode:%d)\n", pdu.Present, initiatingMessage.ProcedureCode.Value)
+			handleUnknownProcedure(ran, initiatingMessage)
 		}
 	case ngapType.NGAPPDUPresentSuccessfulOutcome:
 		successfulOutcome := pdu.SuccessfulOutcome
@@ -122,6 +183,10 @@ func Dispatch(conn net.Conn, msg []byte) {
 			HandlePDUSessionResourceModifyResponse(ran, pdu)
 		case ngapType.ProcedureCodeHandoverResourceAllocation:
 			HandleHandoverRequestAcknowledge(ran, pdu)
+		case ngapType.ProcedureCodeWriteReplaceWarning:
+			HandleWriteReplaceWarningResponse(ran, pdu)
+		case ngapType.ProcedureCodePWSCancel:
+			HandlePWSCancelResponse(ran, pdu)
 		default:
 			Ngaplog.Warnf("Not implemented(choice:%d, procedureCode:%d)\n", pdu.Present, successfulOutcome.ProcedureCode.Value)
 		}
@@ -145,3 +210,10 @@ func Dispatch(conn net.Conn, msg []byte) {
 		}
 	}
 }
+
+// isNGSetupRequest reports whether pdu is an NG Setup Request, the only message
+// accepted from a RAN which is not admitted
+func isNGSetupRequest(pdu *ngapType.NGAPPDU) bool {
+	return pdu.Present == ngapType.NGAPPDUPresentInitiatingMessage && pdu.InitiatingMessage != nil &&
+		pdu.InitiatingMessage.ProcedureCode.Value == ngapType.ProcedureCodeNGSetup
+}
@@ -18,6 +18,7 @@ import (
 	"free5gc/src/amf/logger"
 	"free5gc/src/amf/nas"
 	ngap_message "free5gc/src/amf/ngap/message"
+	"free5gc/src/amf/producer/callback"
 )
 
 func HandleNGSetupRequest(ran *context.AmfRan, message *ngapType.NGAPPDU) {
@@ -143,13 +144,62 @@ func HandleNGSetupRequest(ran *context.AmfRan, message *ngapType.NGAPPDU) {
 		}
 	}
 
+	var timeToWait *ngapType.TimeToWait
+	if cause.Present == ngapType.CausePresentNothing {
+		amfSelf := context.AMF_Self()
+		switch result, reason := amfSelf.AdmitRan(ran); result {
+		case context.RanNotAllowed:
+			logger.NgapLog.Warnf("NG-Setup failure: %s", reason)
+			cause.Present = ngapType.CausePresentMisc
+			cause.Misc = &ngapType.CauseMisc{
+				Value: ngapType.CauseMiscPresentOmIntervention,
+			}
+		case context.RanAtCapacity:
+			logger.NgapLog.Warnf("NG-Setup failure: %s", reason)
+			cause.Present = ngapType.CausePresentMisc
+			cause.Misc = &ngapType.CauseMisc{
+				Value: ngapType.CauseMiscPresentControlProcessingOverload,
+			}
+			timeToWait = buildTimeToWait(amfSelf.RanAdmissionPolicy.TimeToWait)
+		}
+	}
+
 	if cause.Present == ngapType.CausePresentNothing {
 		ngap_message.SendNGSetupResponse(ran)
+		sendOverloadStartIfOverloaded(ran)
 	} else {
-		ngap_message.SendNGSetupFailure(ran, cause)
+		ngap_message.SendNGSetupFailure(ran, cause, timeToWait, nil)
+		// the RAN is removed, a later NG Setup on the connection starts with a new RAN context
+		ran.Admitted = false
+		releaseRanUes(ran)
+		context.AMF_Self().DeleteAmfRan(ran.Conn)
 	}
 }
 
+// buildTimeToWait returns the shortest Time To Wait value not less than seconds,
+// or nil if seconds is not positive
+func buildTimeToWait(seconds int) *ngapType.TimeToWait {
+	if seconds <= 0 {
+		return nil
+	}
+	timeToWait := new(ngapType.TimeToWait)
+	switch {
+	case seconds <= 1:
+		timeToWait.Value = ngapType.TimeToWaitPresentV1s
+	case seconds <= 2:
+		timeToWait.Value = ngapType.TimeToWaitPresentV2s
+	case seconds <= 5:
+		timeToWait.Value = ngapType.TimeToWaitPresentV5s
+	case seconds <= 10:
+		timeToWait.Value = ngapType.TimeToWaitPresentV10s
+	case seconds <= 20:
+		timeToWait.Value = ngapType.TimeToWaitPresentV20s
+	default:
+		timeToWait.Value = ngapType.TimeToWaitPresentV60s
+	}
+	return timeToWait
+}
+
 func HandleUplinkNasTransport(ran *context.AmfRan, message *ngapType.NGAPPDU) {
 
 	var aMFUENGAPID *ngapType.AMFUENGAPID
@@ -292,7 +342,11 @@ func HandleNGReset(ran *context.AmfRan, message *ngapType.NGAPPDU) {
 	switch resetType.Present {
 	case ngapType.ResetTypePresentNGInterface:
 		logger.NgapLog.Trace("ResetType Present: NG Interface")
-		ran.RemoveAllUeInRan()
+		// the UEs are removed by their workers, after the messages already queued there and before
+		// the RAN reuses their RAN UE NGAP IDs
+		for _, ranUe := range ran.RanUeListSnapshot() {
+			removeRanUe(ranUe)
+		}
 		ngap_message.SendNGResetAcknowledge(ran, nil, nil)
 	case ngapType.ResetTypePresentPartOfNGInterface:
 		logger.NgapLog.Trace("ResetType Present: Part of NG Interface")
@@ -308,12 +362,7 @@ func HandleNGReset(ran *context.AmfRan, message *ngapType.NGAPPDU) {
 		for _, ueAssociatedLogicalNGConnectionItem := range partOfNGInterface.List {
 			if ueAssociatedLogicalNGConnectionItem.AMFUENGAPID != nil {
 				logger.NgapLog.Tracef("AmfUeNgapID[%d]", ueAssociatedLogicalNGConnectionItem.AMFUENGAPID.Value)
-				for _, ue := range ran.RanUeList {
-					if ue.AmfUeNgapId == ueAssociatedLogicalNGConnectionItem.AMFUENGAPID.Value {
-						ranUe = ue
-						break
-					}
-				}
+				ranUe = ran.RanUeFindByAmfUeNgapID(ueAssociatedLogicalNGConnectionItem.AMFUENGAPID.Value)
 			} else if ueAssociatedLogicalNGConnectionItem.RANUENGAPID != nil {
 				logger.NgapLog.Tracef("RanUeNgapID[%d]", ueAssociatedLogicalNGConnectionItem.RANUENGAPID.Value)
 				ranUe = ran.RanUeFindByRanUeNgapID(ueAssociatedLogicalNGConnectionItem.RANUENGAPID.Value)
@@ -327,12 +376,9 @@ func HandleNGReset(ran *context.AmfRan, message *ngapType.NGAPPDU) {
 				if ueAssociatedLogicalNGConnectionItem.RANUENGAPID != nil {
 					logger.NgapLog.Warnf("RanUeNgapID[%d]", ueAssociatedLogicalNGConnectionItem.RANUENGAPID.Value)
 				}
+				continue
 			}
-
-			err := ranUe.Remove()
-			if err != nil {
-				logger.NgapLog.Error(err.Error())
-			}
+			removeRanUe(ranUe)
 		}
 		ngap_message.SendNGResetAcknowledge(ran, partOfNGInterface, nil)
 	default:
@@ -543,9 +589,12 @@ func HandleUEContextReleaseComplete(ran *context.AmfRan, message *ngapType.NGAPP
 
 	// for each pduSessionID invoke Nsmf_PDUSession_UpdateSMContext Request
 	var cause context.CauseAll
-	if tmp, exist := amfUe.ReleaseCause[ran.AnType]; exist {
+	if tmp, exist := amfUe.ReleaseCause[ran.AnType]; exist && tmp != nil {
 		cause = *tmp
 	}
+	if ranUe.ReleaseRequestCause != nil {
+		cause.NgapCause = ranUe.ReleaseRequestCause
+	}
 	if amfUe.State[ran.AnType].Is(context.Registered) {
 		Ngaplog.Info("[NGAP] Rel Ue Context in GMM-Registered")
 		if pDUSessionResourceList != nil {
@@ -561,6 +610,10 @@ func HandleUEContextReleaseComplete(ran *context.AmfRan, message *ngapType.NGAPP
 		}
 	}
 
+	if ranUe.ReleaseAction != context.UeContextReleaseHandover && context.AbnormalRelease(cause) {
+		amfUe.ReportCommunicationFailure(cause)
+	}
+
 	// Remove UE N2 Connection
 	amfUe.ReleaseCause[ran.AnType] = nil
 	switch ranUe.ReleaseAction {
@@ -839,6 +892,8 @@ func HandleLocationReportingFailureIndication(ran *context.AmfRan, message *ngap
 		logger.NgapLog.Errorf("No UE Context[RanUeNgapID: %d]", rANUENGAPID.Value)
 		return
 	}
+	// the location reportings are requested again to the next NG-RAN node serving the UE
+	ranUe.ClearLocationReporting(0, 0, true)
 }
 
 func HandleInitialUEMessage(ran *context.AmfRan, message *ngapType.NGAPPDU) {
@@ -972,6 +1027,9 @@ func HandleInitialUEMessage(ran *context.AmfRan, message *ngapType.NGAPPDU) {
 				Ngaplog.Warnf("Unknown UE [GUTI: %s]", guti)
 			} else {
 				Ngaplog.Tracef("find AmfUe [GUTI: %s]", guti)
+				// the N2 connection is new, so the dispatcher could not lock the UE
+				amfUe.Lock()
+				defer amfUe.Unlock()
 
 				if amfUe.CmConnect(ran.AnType) {
 					Ngaplog.Debug("Implicit Deregistration")
@@ -1740,6 +1798,9 @@ func HandleInitialContextSetupResponse(ran *context.AmfRan, message *ngapType.NG
 		ngap_message.SendDownlinkNasTransport(ranUe, amfUe.RegistrationAcceptForNon3GPPAccess, nil)
 	}
 
+	// the UE context exists in the NG-RAN node, which can report the location of the UE
+	ngap_message.RearmLocationReporting(ranUe)
+
 	if criticalityDiagnostics != nil {
 		printCriticalityDiagnostics(criticalityDiagnostics)
 	}
@@ -1956,6 +2017,10 @@ func HandleUEContextReleaseRequest(ran *context.AmfRan, message *ngapType.NGAPPD
 	causeValue := ngapType.CauseRadioNetworkPresentUnspecified
 	if cause != nil {
 		causeGroup, causeValue = printAndGetCause(cause)
+		ranUe.ReleaseRequestCause = &models.NgApCause{
+			Group: int32(causeGroup),
+			Value: int32(causeValue),
+		}
 	}
 
 	amfUe := ranUe.AmfUe
@@ -2358,6 +2423,7 @@ func HandleHandoverNotify(ran *context.AmfRan, message *ngapType.NGAPPDU) {
 			}
 		}
 		amfUe.AttachRanUe(targetUe)
+		ngap_message.RearmLocationReporting(targetUe)
 		ngap_message.SendUEContextReleaseCommand(sourceUe, context.UeContextReleaseHandover, ngapType.CausePresentNas,
 			ngapType.CauseNasPresentNormalRelease)
 
@@ -2550,6 +2616,9 @@ func HandlePathSwitchRequest(ran *context.AmfRan, message *ngapType.NGAPPDU) {
 		}
 		ngap_message.SendPathSwitchRequestAcknowledge(ranUe, pduSessionResourceSwitchedList,
 			pduSessionResourceReleasedListPSAck, false, nil, nil, nil)
+		// the location reportings were requested to the source NG-RAN node
+		ranUe.ClearLocationReporting(0, 0, true)
+		ngap_message.RearmLocationReporting(ranUe)
 	} else if len(pduSessionResourceReleasedListPSFail.List) > 0 {
 		ngap_message.SendPathSwitchRequestFailure(ran, sourceAMFUENGAPID.Value, rANUENGAPID.Value,
 			&pduSessionResourceReleasedListPSFail, nil)
@@ -3271,7 +3340,15 @@ func HandleNasNonDeliveryIndication(ran *context.AmfRan, message *ngapType.NGAPP
 
 	Ngaplog.Tracef("RanUeNgapID[%d] AmfUeNgapID[%d]", ranUe.RanUeNgapId, ranUe.AmfUeNgapId)
 
-	printAndGetCause(cause)
+	causeGroup, causeValue := printAndGetCause(cause)
+	if ranUe.AmfUe != nil {
+		ranUe.AmfUe.ReportCommunicationFailure(context.CauseAll{
+			NgapCause: &models.NgApCause{
+				Group: int32(causeGroup),
+				Value: int32(causeValue),
+			},
+		})
+	}
 
 	nas.HandleNAS(ranUe, ngapType.ProcedureCodeNASNonDeliveryIndication, nASPDU.Value)
 }
@@ -3526,7 +3603,13 @@ func HandleUplinkUEAssociatedNRPPATransport(ran *context.AmfRan, message *ngapTy
 
 	ranUe.RoutingID = hex.EncodeToString(routingID.Value)
 
-	// TODO: Forward NRPPaPDU to LMF
+	amfUe := ranUe.AmfUe
+	if amfUe == nil {
+		Ngaplog.Errorf("No AmfUe of RanUe[RanUeNgapID: %d]", ranUe.RanUeNgapId)
+		return
+	}
+	// TS 23.502 4.13.5.5: the NRPPa PDU is forwarded to the LMF identified by the Routing ID
+	callback.SendNrppaInfoNotify(amfUe, context.LmfIdOfRoutingID(routingID.Value), nRPPaPDU.Value)
 }
 
 func HandleUplinkNonUEAssociatedNRPPATransport(ran *context.AmfRan, message *ngapType.NGAPPDU) {
@@ -3579,7 +3662,22 @@ func HandleUplinkNonUEAssociatedNRPPATransport(ran *context.AmfRan, message *nga
 		logger.NgapLog.Error("NRPPaPDU is nil")
 		return
 	}
-	// TODO: Forward NRPPaPDU to LMF
+
+	printRanInfo(ran)
+
+	lmfId := context.LmfIdOfRoutingID(routingID.Value)
+	n2InfoContainer := models.N2InfoContainer{
+		N2InformationClass: models.N2InformationClass_NRP_PA,
+		NrppaInfo: &models.NrppaInformation{
+			NfId: lmfId,
+			NrppaPdu: &models.N2InfoContent{
+				NgapData: &models.RefToBinaryData{
+					ContentId: "n2Info",
+				},
+			},
+		},
+	}
+	callback.SendNonUeN2InfoNotify(n2InfoContainer, ran.RanId, nRPPaPDU.Value)
 }
 
 func HandleLocationReport(ran *context.AmfRan, message *ngapType.NGAPPDU) {
@@ -3653,7 +3751,15 @@ func HandleLocationReport(ran *context.AmfRan, message *ngapType.NGAPPDU) {
 		return
 	}
 
-	ranUe.UpdateLocation(userLocationInformation)
+	changed := ranUe.UpdateLocation(userLocationInformation)
+	if ranUe.AmfUe != nil {
+		// a location requested by the AMF is reported to the subscribers even if the UE did not move
+		if !changed && locationReportingRequestType != nil &&
+			locationReportingRequestType.EventType.Value == ngapType.EventTypePresentDirect {
+			ranUe.AmfUe.NotifyEvent(models.AmfEventType_LOCATION_REPORT)
+		}
+		ranUe.AmfUe.LocationReported(ranUe)
+	}
 
 	Ngaplog.Tracef("Report Area[%d]", locationReportingRequestType.ReportArea.Value)
 
@@ -3680,17 +3786,18 @@ func HandleLocationReport(ran *context.AmfRan, message *ngapType.NGAPPDU) {
 	case ngapType.EventTypePresentStopChangeOfServeCell:
 		Ngaplog.Trace("To stop reporting at change of serving cell")
 		ngap_message.SendLocationReportingControl(ranUe, nil, 0, locationReportingRequestType.EventType)
-		// TODO: Clear location report
+		ranUe.ClearLocationReporting(context.LocationReportingChangeOfServeCell, 0, false)
 
 	case ngapType.EventTypePresentStopUePresenceInAreaOfInterest:
 		Ngaplog.Trace("To stop reporting UE presence in the area of interest")
 		Ngaplog.Tracef("ReferenceID To Be Cancelled[%d]",
 			locationReportingRequestType.LocationReportingReferenceIDToBeCancelled.Value)
-		// TODO: Clear location report
+		ranUe.ClearLocationReporting(context.LocationReportingAreaOfInterest,
+			locationReportingRequestType.LocationReportingReferenceIDToBeCancelled.Value, false)
 
 	case ngapType.EventTypePresentCancelLocationReportingForTheUe:
 		Ngaplog.Trace("To cancel location reporting for the UE")
-		// TODO: Clear location report
+		ranUe.ClearLocationReporting(0, 0, true)
 	}
 }
 
@@ -4222,3 +4329,166 @@ func printRanInfo(ran *context.AmfRan) {
 		Ngaplog.Tracef("IP[%s] N3IwfId[%s]", ran.Conn.RemoteAddr().String(), ran.RanId.N3IwfId)
 	}
 }
+
+func HandleWriteReplaceWarningResponse(ran *context.AmfRan, message *ngapType.NGAPPDU) {
+	var messageIdentifier *ngapType.MessageIdentifier
+	var serialNumber *ngapType.SerialNumber
+
+	if ran == nil {
+		logger.NgapLog.Error("ran is nil")
+		return
+	}
+	if message == nil {
+		logger.NgapLog.Error("NGAP Message is nil")
+		return
+	}
+	successfulOutcome := message.SuccessfulOutcome
+	if successfulOutcome == nil {
+		logger.NgapLog.Error("SuccessfulOutcome is nil")
+		return
+	}
+	writeReplaceWarningResponse := successfulOutcome.Value.WriteReplaceWarningResponse
+	if writeReplaceWarningResponse == nil {
+		logger.NgapLog.Error("WriteReplaceWarningResponse is nil")
+		return
+	}
+
+	logger.NgapLog.Info("[AMF] Write Replace Warning Response")
+
+	for _, ie := range writeReplaceWarningResponse.ProtocolIEs.List {
+		switch ie.Id.Value {
+		case ngapType.ProtocolIEIDMessageIdentifier:
+			messageIdentifier = ie.Value.MessageIdentifier
+			logger.NgapLog.Trace("[NGAP] Decode IE MessageIdentifier")
+		case ngapType.ProtocolIEIDSerialNumber:
+			serialNumber = ie.Value.SerialNumber
+			logger.NgapLog.Trace("[NGAP] Decode IE SerialNumber")
+		}
+	}
+
+	key := context.NewPwsTransactionKey(ngapType.ProcedureCodeWriteReplaceWarning, messageIdentifier, serialNumber)
+	if transaction, ok := context.AMF_Self().PwsTransactionFind(key); ok {
+		transaction.AddResponse(ran, message)
+	} else {
+		logger.NgapLog.Warnf("No Write-Replace Warning with message identifier[%d] serial number[%d]",
+			key.MessageIdentifier, key.SerialNumber)
+	}
+}
+
+func HandlePWSCancelResponse(ran *context.AmfRan, message *ngapType.NGAPPDU) {
+	var messageIdentifier *ngapType.MessageIdentifier
+	var serialNumber *ngapType.SerialNumber
+
+	if ran == nil {
+		logger.NgapLog.Error("ran is nil")
+		return
+	}
+	if message == nil {
+		logger.NgapLog.Error("NGAP Message is nil")
+		return
+	}
+	successfulOutcome := message.SuccessfulOutcome
+	if successfulOutcome == nil {
+		logger.NgapLog.Error("SuccessfulOutcome is nil")
+		return
+	}
+	pWSCancelResponse := successfulOutcome.Value.PWSCancelResponse
+	if pWSCancelResponse == nil {
+		logger.NgapLog.Error("PWSCancelResponse is nil")
+		return
+	}
+
+	logger.NgapLog.Info("[AMF] PWS Cancel Response")
+
+	for _, ie := range pWSCancelResponse.ProtocolIEs.List {
+		switch ie.Id.Value {
+		case ngapType.ProtocolIEIDMessageIdentifier:
+			messageIdentifier = ie.Value.MessageIdentifier
+			logger.NgapLog.Trace("[NGAP] Decode IE MessageIdentifier")
+		case ngapType.ProtocolIEIDSerialNumber:
+			serialNumber = ie.Value.SerialNumber
+			logger.NgapLog.Trace("[NGAP] Decode IE SerialNumber")
+		}
+	}
+
+	key := context.NewPwsTransactionKey(ngapType.ProcedureCodePWSCancel, messageIdentifier, serialNumber)
+	if transaction, ok := context.AMF_Self().PwsTransactionFind(key); ok {
+		transaction.AddResponse(ran, message)
+	} else {
+		logger.NgapLog.Warnf("No PWS Cancel with message identifier[%d] serial number[%d]",
+			key.MessageIdentifier, key.SerialNumber)
+	}
+}
+
+func HandlePWSRestartIndication(ran *context.AmfRan, message *ngapType.NGAPPDU) {
+	if ran == nil {
+		logger.NgapLog.Error("ran is nil")
+		return
+	}
+	if message == nil {
+		logger.NgapLog.Error("NGAP Message is nil")
+		return
+	}
+	initiatingMessage := message.InitiatingMessage
+	if initiatingMessage == nil {
+		logger.NgapLog.Error("Initiating Message is nil")
+		return
+	}
+	if initiatingMessage.Value.PWSRestartIndication == nil {
+		logger.NgapLog.Error("PWSRestartIndication is nil")
+		return
+	}
+
+	logger.NgapLog.Info("[AMF] PWS Restart Indication")
+	printRanInfo(ran)
+
+	// TS 23.041 9.1.3.5: the indication is forwarded to the CBCF, which may rebroadcast the warnings
+	forwardPwsIndication(ran, message)
+}
+
+func HandlePWSFailureIndication(ran *context.AmfRan, message *ngapType.NGAPPDU) {
+	if ran == nil {
+		logger.NgapLog.Error("ran is nil")
+		return
+	}
+	if message == nil {
+		logger.NgapLog.Error("NGAP Message is nil")
+		return
+	}
+	initiatingMessage := message.InitiatingMessage
+	if initiatingMessage == nil {
+		logger.NgapLog.Error("Initiating Message is nil")
+		return
+	}
+	if initiatingMessage.Value.PWSFailureIndication == nil {
+		logger.NgapLog.Error("PWSFailureIndication is nil")
+		return
+	}
+
+	logger.NgapLog.Info("[AMF] PWS Failure Indication")
+	printRanInfo(ran)
+
+	forwardPwsIndication(ran, message)
+}
+
+// forwardPwsIndication notifies the PWS-RF subscribers of a PWS Restart or Failure Indication
+func forwardPwsIndication(ran *context.AmfRan, message *ngapType.NGAPPDU) {
+	n2Info, err := libngap.Encoder(*message)
+	if err != nil {
+		logger.NgapLog.Errorf("libngap Encoder Error: %+v", err)
+		return
+	}
+
+	n2InfoContainer := models.N2InfoContainer{
+		N2InformationClass: models.N2InformationClass_PWS_RF,
+		PwsInfo: &models.PwsInformation{
+			PwsContainer: &models.N2InfoContent{
+				NgapMessageType: int32(message.InitiatingMessage.ProcedureCode.Value),
+				NgapData: &models.RefToBinaryData{
+					ContentId: "n2Info",
+				},
+			},
+		},
+	}
+	callback.SendNonUeN2InfoNotify(n2InfoContainer, ran.RanId, n2Info)
+}
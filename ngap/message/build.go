@@ -132,7 +132,7 @@ func BuildNGSetupResponse() ([]byte, error) {
 	ie.Value.Present = ngapType.NGSetupResponseIEsPresentRelativeAMFCapacity
 	ie.Value.RelativeAMFCapacity = new(ngapType.RelativeAMFCapacity)
 	relativeAMFCapacity := ie.Value.RelativeAMFCapacity
-	relativeAMFCapacity.Value = amfSelf.RelativeCapacity
+	relativeAMFCapacity.Value = amfSelf.GetRelativeCapacity()
 
 	nGSetupResponseIEs.List = append(nGSetupResponseIEs.List, ie)
 
@@ -160,7 +160,9 @@ func BuildNGSetupResponse() ([]byte, error) {
 	return ngap.Encoder(pdu)
 }
 
-func BuildNGSetupFailure(cause ngapType.Cause) ([]byte, error) {
+// timeToWait and criticalityDiagnostics are optional, set them to nil if not needed
+func BuildNGSetupFailure(cause ngapType.Cause, timeToWait *ngapType.TimeToWait,
+	criticalityDiagnostics *ngapType.CriticalityDiagnostics) ([]byte, error) {
 	var pdu ngapType.NGAPPDU
 	pdu.Present = ngapType.NGAPPDUPresentUnsuccessfulOutcome
 	pdu.UnsuccessfulOutcome = new(ngapType.UnsuccessfulOutcome)
@@ -183,6 +185,28 @@ func BuildNGSetupFailure(cause ngapType.Cause) ([]byte, error) {
 
 	nGSetupFailureIEs.List = append(nGSetupFailureIEs.List, ie)
 
+	// Time To Wait (optional)
+	if timeToWait != nil {
+		ie = ngapType.NGSetupFailureIEs{}
+		ie.Id.Value = ngapType.ProtocolIEIDTimeToWait
+		ie.Criticality.Value = ngapType.CriticalityPresentIgnore
+		ie.Value.Present = ngapType.NGSetupFailureIEsPresentTimeToWait
+		ie.Value.TimeToWait = timeToWait
+
+		nGSetupFailureIEs.List = append(nGSetupFailureIEs.List, ie)
+	}
+
+	// Criticality Diagnostics (optional)
+	if criticalityDiagnostics != nil {
+		ie = ngapType.NGSetupFailureIEs{}
+		ie.Id.Value = ngapType.ProtocolIEIDCriticalityDiagnostics
+		ie.Criticality.Value = ngapType.CriticalityPresentIgnore
+		ie.Value.Present = ngapType.NGSetupFailureIEsPresentCriticalityDiagnostics
+		ie.Value.CriticalityDiagnostics = criticalityDiagnostics
+
+		nGSetupFailureIEs.List = append(nGSetupFailureIEs.List, ie)
+	}
+
 	return ngap.Encoder(pdu)
 }
 
@@ -2600,7 +2624,7 @@ func BuildDownlinkRanConfigurationTransfer(
 }
 
 func BuildDownlinkNonUEAssociatedNRPPATransport(
-	ue *context.RanUe, nRPPaPDU ngapType.NRPPaPDU) ([]byte, error) {
+	routingID string, nRPPaPDU ngapType.NRPPaPDU) ([]byte, error) {
 	//NRPPa PDU is by pass
 	//NRPPa PDU is from LMF define in 4.13.5.6
 
@@ -2628,11 +2652,10 @@ func BuildDownlinkNonUEAssociatedNRPPATransport(
 	ie.Value.RoutingID = new(ngapType.RoutingID)
 
 	var err error
-	routingID := ie.Value.RoutingID
-	routingID.Value, err = hex.DecodeString(ue.RoutingID)
+	ie.Value.RoutingID.Value, err = hex.DecodeString(routingID)
 	if err != nil {
 		logger.NgapLog.Errorf(
-			"[Build Error] DecodeString ue.RoutingID error: %+v", err)
+			"[Build Error] DecodeString RoutingID error: %+v", err)
 	}
 
 	downlinkNonUEAssociatedNRPPaTransportIEs.List = append(downlinkNonUEAssociatedNRPPaTransportIEs.List, ie)
@@ -2934,7 +2957,7 @@ func BuildAMFConfigurationUpdate(tNLassociationUsage ngapType.TNLAssociationUsag
 	ie.Value.Present = ngapType.NGSetupResponseIEsPresentRelativeAMFCapacity
 	ie.Value.RelativeAMFCapacity = new(ngapType.RelativeAMFCapacity)
 	relativeAMFCapacity := ie.Value.RelativeAMFCapacity
-	relativeAMFCapacity.Value = amfSelf.RelativeCapacity
+	relativeAMFCapacity.Value = amfSelf.GetRelativeCapacity()
 
 	aMFConfigurationUpdateIEs.List = append(aMFConfigurationUpdateIEs.List, ie)
 
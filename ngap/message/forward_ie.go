@@ -158,3 +158,55 @@ func BuildUnavailableGUAMIList(guamiList []models.Guami) (unavailableGUAMIList n
 	}
 	return
 }
+
+// BuildIEAreaOfInterest builds the area of interest of a presence reporting area from its TAIs and cells;
+// the area cannot be built when it has no TAI nor cell
+func BuildIEAreaOfInterest(area models.PresenceInfo) (*ngapType.AreaOfInterest, bool) {
+	areaOfInterest := new(ngapType.AreaOfInterest)
+	for _, tai := range area.TrackingAreaList {
+		tacBytes, err := hex.DecodeString(tai.Tac)
+		if err != nil || tai.PlmnId == nil {
+			logger.NgapLog.Errorf("Invalid TAI in area of interest: %+v", tai)
+			return nil, false
+		}
+		if areaOfInterest.AreaOfInterestTAIList == nil {
+			areaOfInterest.AreaOfInterestTAIList = new(ngapType.AreaOfInterestTAIList)
+		}
+		item := ngapType.AreaOfInterestTAIItem{}
+		item.TAI.PLMNIdentity = ngapConvert.PlmnIdToNgap(*tai.PlmnId)
+		item.TAI.TAC.Value = tacBytes
+		areaOfInterest.AreaOfInterestTAIList.List = append(areaOfInterest.AreaOfInterestTAIList.List, item)
+	}
+	for _, ncgi := range area.NcgiList {
+		if ncgi.PlmnId == nil {
+			continue
+		}
+		if areaOfInterest.AreaOfInterestCellList == nil {
+			areaOfInterest.AreaOfInterestCellList = new(ngapType.AreaOfInterestCellList)
+		}
+		item := ngapType.AreaOfInterestCellItem{}
+		item.NGRANCGI.Present = ngapType.NGRANCGIPresentNRCGI
+		item.NGRANCGI.NRCGI = new(ngapType.NRCGI)
+		item.NGRANCGI.NRCGI.PLMNIdentity = ngapConvert.PlmnIdToNgap(*ncgi.PlmnId)
+		item.NGRANCGI.NRCGI.NRCellIdentity.Value = ngapConvert.HexToBitString(ncgi.NrCellId, 36)
+		areaOfInterest.AreaOfInterestCellList.List = append(areaOfInterest.AreaOfInterestCellList.List, item)
+	}
+	for _, ecgi := range area.EcgiList {
+		if ecgi.PlmnId == nil {
+			continue
+		}
+		if areaOfInterest.AreaOfInterestCellList == nil {
+			areaOfInterest.AreaOfInterestCellList = new(ngapType.AreaOfInterestCellList)
+		}
+		item := ngapType.AreaOfInterestCellItem{}
+		item.NGRANCGI.Present = ngapType.NGRANCGIPresentEUTRACGI
+		item.NGRANCGI.EUTRACGI = new(ngapType.EUTRACGI)
+		item.NGRANCGI.EUTRACGI.PLMNIdentity = ngapConvert.PlmnIdToNgap(*ecgi.PlmnId)
+		item.NGRANCGI.EUTRACGI.EUTRACellIdentity.Value = ngapConvert.HexToBitString(ecgi.EutraCellId, 28)
+		areaOfInterest.AreaOfInterestCellList.List = append(areaOfInterest.AreaOfInterestCellList.List, item)
+	}
+	if areaOfInterest.AreaOfInterestTAIList == nil && areaOfInterest.AreaOfInterestCellList == nil {
+		return nil, false
+	}
+	return areaOfInterest, true
+}
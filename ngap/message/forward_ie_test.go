@@ -0,0 +1,103 @@
+package message
+
+import (
+	"free5gc/lib/ngap/ngapConvert"
+	"free5gc/lib/ngap/ngapType"
+	"free5gc/lib/openapi/models"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildIEAreaOfInterest(t *testing.T) {
+	plmnId := models.PlmnId{Mcc: "208", Mnc: "93"}
+	tai := models.Tai{PlmnId: &plmnId, Tac: "000001"}
+	ncgi := models.Ncgi{PlmnId: &plmnId, NrCellId: "000000010"}
+	ecgi := models.Ecgi{PlmnId: &plmnId, EutraCellId: "0000001"}
+
+	testCases := []struct {
+		name         string
+		area         models.PresenceInfo
+		ok           bool
+		numberOfTais int
+		cellTypes    []int
+	}{
+		{
+			name: "TAIs and cells",
+			area: models.PresenceInfo{
+				TrackingAreaList: []models.Tai{tai},
+				NcgiList:         []models.Ncgi{ncgi},
+				EcgiList:         []models.Ecgi{ecgi},
+			},
+			ok:           true,
+			numberOfTais: 1,
+			cellTypes:    []int{ngapType.NGRANCGIPresentNRCGI, ngapType.NGRANCGIPresentEUTRACGI},
+		},
+		{
+			name:         "TAIs only",
+			area:         models.PresenceInfo{TrackingAreaList: []models.Tai{tai, tai}},
+			ok:           true,
+			numberOfTais: 2,
+		},
+		{
+			name:      "cells without PLMN are skipped",
+			area:      models.PresenceInfo{NcgiList: []models.Ncgi{{NrCellId: "000000020"}, ncgi}},
+			ok:        true,
+			cellTypes: []int{ngapType.NGRANCGIPresentNRCGI},
+		},
+		{
+			name: "invalid TAC",
+			area: models.PresenceInfo{TrackingAreaList: []models.Tai{{PlmnId: &plmnId, Tac: "invalid"}}},
+			ok:   false,
+		},
+		{
+			name: "TAI without PLMN",
+			area: models.PresenceInfo{TrackingAreaList: []models.Tai{{Tac: "000001"}}},
+			ok:   false,
+		},
+		{
+			name: "no TAI nor cell",
+			area: models.PresenceInfo{PraId: "1"},
+			ok:   false,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			areaOfInterest, ok := BuildIEAreaOfInterest(tc.area)
+			require.Equal(t, tc.ok, ok)
+			if !ok {
+				assert.Nil(t, areaOfInterest)
+				return
+			}
+
+			if tc.numberOfTais == 0 {
+				assert.Nil(t, areaOfInterest.AreaOfInterestTAIList)
+			} else if assert.NotNil(t, areaOfInterest.AreaOfInterestTAIList) {
+				require.Len(t, areaOfInterest.AreaOfInterestTAIList.List, tc.numberOfTais)
+				item := areaOfInterest.AreaOfInterestTAIList.List[0]
+				assert.Equal(t, ngapConvert.PlmnIdToNgap(plmnId), item.TAI.PLMNIdentity)
+				assert.Equal(t, []byte{0x00, 0x00, 0x01}, []byte(item.TAI.TAC.Value))
+			}
+
+			if len(tc.cellTypes) == 0 {
+				assert.Nil(t, areaOfInterest.AreaOfInterestCellList)
+				return
+			}
+			require.NotNil(t, areaOfInterest.AreaOfInterestCellList)
+			require.Len(t, areaOfInterest.AreaOfInterestCellList.List, len(tc.cellTypes))
+			for i, cellType := range tc.cellTypes {
+				cgi := areaOfInterest.AreaOfInterestCellList.List[i].NGRANCGI
+				assert.Equal(t, cellType, cgi.Present)
+				switch cellType {
+				case ngapType.NGRANCGIPresentNRCGI:
+					assert.Equal(t, ngapConvert.HexToBitString(ncgi.NrCellId, 36), cgi.NRCGI.NRCellIdentity.Value)
+				case ngapType.NGRANCGIPresentEUTRACGI:
+					assert.Equal(t, ngapConvert.HexToBitString(ecgi.EutraCellId, 28),
+						cgi.EUTRACGI.EUTRACellIdentity.Value)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,123 @@
+package message
+
+import (
+	"free5gc/lib/ngap/ngapType"
+	"free5gc/lib/openapi/models"
+	"free5gc/src/amf/context"
+	"time"
+)
+
+// StartLocationReporting records the location reporting id of the UE and requests it to the
+// NG-RAN node serving the UE, or to the next one if the UE is CM-IDLE
+func StartLocationReporting(ue *context.AmfUe, id string, reporting *context.LocationReporting) bool {
+	if !ue.AddLocationReporting(id, reporting) {
+		ngaplog.Errorf("UE[%s] has already %d areas of interest", ue.Supi, context.MaxLocationReportingReferenceID)
+		return false
+	}
+	if ranUe := ue.RanUe[models.AccessType__3_GPP_ACCESS]; ranUe != nil {
+		armLocationReporting(ranUe, id, reporting)
+	}
+	if reporting.Type == context.LocationReportingPeriodic && reporting.Period > 0 {
+		go runPeriodicLocationReporting(ue, reporting)
+	}
+	return true
+}
+
+// StopLocationReporting stops the location reporting id of the UE, and cancels it in the
+// NG-RAN node serving the UE
+func StopLocationReporting(ue *context.AmfUe, id string) {
+	reporting, ok := ue.RemoveLocationReporting(id)
+	if !ok {
+		return
+	}
+	ranUe := ue.RanUe[models.AccessType__3_GPP_ACCESS]
+	if ranUe == nil {
+		return
+	}
+	if _, armed := ranUe.LocationReportings.Load(id); !armed {
+		return
+	}
+	ranUe.LocationReportings.Delete(id)
+
+	switch reporting.Type {
+	case context.LocationReportingChangeOfServeCell:
+		// the NG-RAN node reports the changes once for all the reportings
+		inUse := false
+		ranUe.LocationReportings.Range(func(key, value interface{}) bool {
+			if value.(*context.LocationReporting).Type == context.LocationReportingChangeOfServeCell {
+				inUse = true
+				return false
+			}
+			return true
+		})
+		if !inUse {
+			SendLocationReportingControl(ranUe, nil, 0, ngapType.EventType{
+				Value: ngapType.EventTypePresentStopChangeOfServeCell,
+			})
+		}
+	case context.LocationReportingAreaOfInterest:
+		SendLocationReportingControl(ranUe, nil, reporting.ReferenceID, ngapType.EventType{
+			Value: ngapType.EventTypePresentStopUePresenceInAreaOfInterest,
+		})
+	}
+}
+
+// RearmLocationReporting requests the location reportings of the UE to the NG-RAN node which
+// serves it after a handover or a transition to CM-CONNECTED
+func RearmLocationReporting(ranUe *context.RanUe) {
+	ue := ranUe.AmfUe
+	if ue == nil || ranUe.Ran == nil || ranUe.Ran.AnType != models.AccessType__3_GPP_ACCESS {
+		return
+	}
+	ue.LocationReportings.Range(func(key, value interface{}) bool {
+		id := key.(string)
+		if _, armed := ranUe.LocationReportings.Load(id); !armed {
+			armLocationReporting(ranUe, id, value.(*context.LocationReporting))
+		}
+		return true
+	})
+}
+
+func armLocationReporting(ranUe *context.RanUe, id string, reporting *context.LocationReporting) {
+	switch reporting.Type {
+	case context.LocationReportingDirect, context.LocationReportingDeferred, context.LocationReportingPeriodic:
+		SendLocationReportingControl(ranUe, nil, 0, ngapType.EventType{Value: ngapType.EventTypePresentDirect})
+	case context.LocationReportingChangeOfServeCell:
+		SendLocationReportingControl(ranUe, nil, 0, ngapType.EventType{
+			Value: ngapType.EventTypePresentChangeOfServeCell,
+		})
+	case context.LocationReportingAreaOfInterest:
+		if reporting.AreaOfInterest == nil {
+			return
+		}
+		aOIList := ngapType.AreaOfInterestList{
+			List: []ngapType.AreaOfInterestItem{
+				{
+					AreaOfInterest:               *reporting.AreaOfInterest,
+					LocationReportingReferenceID: ngapType.LocationReportingReferenceID{Value: reporting.ReferenceID},
+				},
+			},
+		}
+		SendLocationReportingControl(ranUe, &aOIList, 0, ngapType.EventType{
+			Value: ngapType.EventTypePresentUePresenceInAreaOfInterest,
+		})
+	}
+	ranUe.LocationReportings.Store(id, reporting)
+}
+
+// runPeriodicLocationReporting requests a report to the NG-RAN node serving the UE every period
+// until the reporting is stopped
+func runPeriodicLocationReporting(ue *context.AmfUe, reporting *context.LocationReporting) {
+	ticker := time.NewTicker(reporting.Period)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if ranUe := ue.RanUe[models.AccessType__3_GPP_ACCESS]; ranUe != nil {
+				SendLocationReportingControl(ranUe, nil, 0, ngapType.EventType{Value: ngapType.EventTypePresentDirect})
+			}
+		case <-reporting.Stopped():
+			return
+		}
+	}
+}
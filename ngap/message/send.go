@@ -1,6 +1,7 @@
 package message
 
 import (
+	"fmt"
 	"free5gc/lib/aper"
 	"free5gc/lib/ngap/ngapType"
 	"free5gc/lib/openapi/models"
@@ -19,47 +20,53 @@ func init() {
 	ngaplog = logger.NgapLog
 }
 
-func SendToRan(ran *context.AmfRan, packet []byte) {
+// SendToRan queues a non-UE-associated message to the RAN, on stream 0. The message
+// is written by the sender of the RAN; an error means it was dropped.
+func SendToRan(ran *context.AmfRan, packet []byte) error {
+	return sendToRanOnStream(ran, packet, 0)
+}
+
+func sendToRanOnStream(ran *context.AmfRan, packet []byte, stream uint16) error {
 
 	if ran == nil {
 		ngaplog.Error("Ran is nil")
-		return
+		return fmt.Errorf("Ran is nil")
 	}
 
 	if len(packet) == 0 {
 		ngaplog.Error("packet len is 0")
-		return
+		return fmt.Errorf("packet len is 0")
 	}
 
-	ngaplog.Debugf("[NGAP] Send To Ran [IP: %s]", ran.Conn.RemoteAddr().String())
+	ngaplog.Debugf("[NGAP] Send To Ran [IP: %s, Stream: %d]", ran.Conn.RemoteAddr().String(), stream)
 
-	if n, err := ran.Conn.Write(packet); err != nil {
+	if err := ran.SendNgap(packet, stream, nil); err != nil {
 		ngaplog.Errorf("Send error: %+v", err)
-		return
-	} else {
-		ngaplog.Debugf("Write %d bytes", n)
+		return err
 	}
+	return nil
 }
 
-func SendToRanUe(ue *context.RanUe, packet []byte) {
+// SendToRanUe queues a UE-associated message to the RAN of the UE, on the stream of the UE
+func SendToRanUe(ue *context.RanUe, packet []byte) error {
 
 	var ran *context.AmfRan
 
 	if ue == nil {
 		ngaplog.Error("RanUe is nil")
-		return
+		return fmt.Errorf("RanUe is nil")
 	}
 
 	if ran = ue.Ran; ran == nil {
 		ngaplog.Error("Ran is nil")
-		return
+		return fmt.Errorf("Ran is nil")
 	}
 
 	if ue.AmfUe == nil {
 		ngaplog.Warn("AmfUe is nil")
 	}
 
-	SendToRan(ran, packet)
+	return sendToRanOnStream(ran, packet, ue.Stream)
 }
 
 func NasSendToRan(ue *context.AmfUe, accessType models.AccessType, packet []byte) {
@@ -90,7 +97,9 @@ func SendNGSetupResponse(ran *context.AmfRan) {
 	SendToRan(ran, pkt)
 }
 
-func SendNGSetupFailure(ran *context.AmfRan, cause ngapType.Cause) {
+// timeToWait and criticalityDiagnostics are optional, set them to nil if not needed
+func SendNGSetupFailure(ran *context.AmfRan, cause ngapType.Cause, timeToWait *ngapType.TimeToWait,
+	criticalityDiagnostics *ngapType.CriticalityDiagnostics) {
 
 	ngaplog.Info("[AMF] Send NG-Setup failure")
 
@@ -99,7 +108,7 @@ func SendNGSetupFailure(ran *context.AmfRan, cause ngapType.Cause) {
 		return
 	}
 
-	pkt, err := BuildNGSetupFailure(cause)
+	pkt, err := BuildNGSetupFailure(cause, timeToWait, criticalityDiagnostics)
 	if err != nil {
 		ngaplog.Errorf("Build NGSetupFailure failed : %s", err.Error())
 		return
@@ -195,12 +204,17 @@ func SendUEContextReleaseCommand(ue *context.RanUe, action context.RelAction, ca
 	}
 	ue.ReleaseAction = action
 	if ue.AmfUe != nil && ue.Ran != nil {
-		ue.AmfUe.ReleaseCause[ue.Ran.AnType] = &context.CauseAll{
+		releaseCause := &context.CauseAll{
 			NgapCause: &models.NgApCause{
 				Group: int32(causePresent),
 				Value: int32(cause),
 			},
 		}
+		// keep the 5GMM cause of the NAS procedure which failed
+		if nasCause := ue.AmfUe.ReleaseCause[ue.Ran.AnType]; nasCause != nil {
+			releaseCause.Var5GmmCause = nasCause.Var5GmmCause
+		}
+		ue.AmfUe.ReleaseCause[ue.Ran.AnType] = releaseCause
 	}
 	SendToRanUe(ue, pkt)
 }
@@ -220,7 +234,12 @@ func SendErrorIndication(ran *context.AmfRan, amfUeNgapId, ranUeNgapId *int64, c
 		ngaplog.Errorf("Build ErrorIndication failed : %s", err.Error())
 		return
 	}
-	SendToRan(ran, pkt)
+	if amfUeNgapId != nil {
+		// UE-associated error indication
+		sendToRanOnStream(ran, pkt, ran.UeStream(*amfUeNgapId))
+	} else {
+		SendToRan(ran, pkt)
+	}
 }
 
 func SendUERadioCapabilityCheckRequest(ue *context.RanUe) {
@@ -590,7 +609,7 @@ func SendPathSwitchRequestFailure(
 		ngaplog.Errorf("Build PathSwitchRequestFailure failed : %s", err.Error())
 		return
 	}
-	SendToRan(ran, pkt)
+	sendToRanOnStream(ran, pkt, ran.UeStream(amfUeNgapId))
 }
 
 //RanStatusTransferTransparentContainer from Uplink Ran Configuration Transfer
@@ -643,18 +662,9 @@ func SendPaging(ue *context.AmfUe, ngapBuf []byte) {
 	// 	ngaplog.Errorf("Build Paging failed : %s", err.Error())
 	// }
 	taiList := ue.RegistrationArea[models.AccessType__3_GPP_ACCESS]
-	context.AMF_Self().AmfRanPool.Range(func(key, value interface{}) bool {
-		ran := value.(*context.AmfRan)
-		for _, item := range ran.SupportedTAList {
-			if context.InTaiList(item.Tai, taiList) {
-				ngaplog.Infof("[AMF] Send Paging to TAI(%+v, Tac:%+v) for Ue[%s]",
-					item.Tai.PlmnId, item.Tai.Tac, ue.Supi)
-				SendToRan(ran, ngapBuf)
-				break
-			}
-		}
-		return true
-	})
+	if sendPagingToRans(ue, taiList, ngapBuf) == 0 {
+		ngaplog.Warnf("[AMF] Paging for Ue[%s] is not sent to any RAN, retry at T3513 expiry", ue.Supi)
+	}
 
 	ue.T3513RetryTimes = 0
 	ue.T3513 = time.AfterFunc(context.TimeT3513, func() {
@@ -663,26 +673,46 @@ func SendPaging(ue *context.AmfUe, ngapBuf []byte) {
 			logger.GmmLog.Warnf("UE[%s] T3513 expires %d times, abort paging procedure", ue.Supi, ue.T3513RetryTimes)
 			if ue.OnGoing[models.AccessType__3_GPP_ACCESS].Procedure != context.OnGoingProcedureN2Handover {
 				callback.SendN1N2TransferFailureNotification(ue, models.N1N2MessageTransferCause_UE_NOT_RESPONDING)
+				for _, message := range ue.TakePagedN1N2Messages() {
+					callback.SendHeldN1N2TransferFailureNotification(message,
+						models.N1N2MessageTransferCause_UE_NOT_RESPONDING)
+				}
 			}
 			util.StopT3513(ue)
+			ue.SetReachability(models.UeReachability_UNREACHABLE)
+			ue.EndPaging()
 		} else {
 			logger.NgapLog.Warnf("[NGAP] T3513 expires, retransmit Paging (UE: [%s], retry: %d)",
 				ue.Supi, ue.T3513RetryTimes)
-			context.AMF_Self().AmfRanPool.Range(func(key, value interface{}) bool {
-				ran := value.(*context.AmfRan)
-				for _, item := range ran.SupportedTAList {
-					if context.InTaiList(item.Tai, taiList) {
-						SendToRan(ran, ngapBuf)
-						break
-					}
-				}
-				return true
-			})
+			sendPagingToRans(ue, taiList, ngapBuf)
 			ue.T3513.Reset(context.TimeT3513)
 		}
 	})
 }
 
+// sendPagingToRans sends the paging to the RANs which serve a TAI of taiList, and
+// returns the number of RANs which accepted it in their send queue
+func sendPagingToRans(ue *context.AmfUe, taiList []models.Tai, ngapBuf []byte) int {
+	numOfRans := 0
+	context.AMF_Self().AmfRanPool.Range(func(key, value interface{}) bool {
+		ran := value.(*context.AmfRan)
+		for _, item := range ran.SupportedTAList {
+			if context.InTaiList(item.Tai, taiList) {
+				ngaplog.Infof("[AMF] Send Paging to TAI(%+v, Tac:%+v) for Ue[%s]",
+					item.Tai.PlmnId, item.Tai.Tac, ue.Supi)
+				if err := SendToRan(ran, ngapBuf); err != nil {
+					ngaplog.Warnf("[AMF] Paging for Ue[%s] dropped by RAN[Name: %s]: %+v", ue.Supi, ran.Name, err)
+				} else {
+					numOfRans++
+				}
+				break
+			}
+		}
+		return true
+	})
+	return numOfRans
+}
+
 // TS 23.502 4.2.2.2.3
 // anType: indicate amfUe send this msg for which accessType
 // amfUeNgapID: initial AMF get it from target AMF
@@ -853,12 +883,13 @@ func SendDownlinkRanConfigurationTransfer(ran *context.AmfRan, transfer *ngapTyp
 
 //NRPPa PDU is by pass
 //NRPPa PDU is from LMF define in 4.13.5.6
-func SendDownlinkNonUEAssociatedNRPPATransport(ue *context.RanUe, nRPPaPDU ngapType.NRPPaPDU) {
+//Routing ID identifies the LMF in the RAN, it is the hex string stored in RanUe.RoutingID
+func SendDownlinkNonUEAssociatedNRPPATransport(ran *context.AmfRan, routingID string, nRPPaPDU ngapType.NRPPaPDU) {
 
 	ngaplog.Info("[AMF] Send Downlink Non UE Associated NRPPA Transport")
 
-	if ue == nil {
-		ngaplog.Error("RanUe is nil")
+	if ran == nil {
+		ngaplog.Error("Ran is nil")
 		return
 	}
 
@@ -867,12 +898,12 @@ func SendDownlinkNonUEAssociatedNRPPATransport(ue *context.RanUe, nRPPaPDU ngapT
 		return
 	}
 
-	pkt, err := BuildDownlinkNonUEAssociatedNRPPATransport(ue, nRPPaPDU)
+	pkt, err := BuildDownlinkNonUEAssociatedNRPPATransport(routingID, nRPPaPDU)
 	if err != nil {
 		ngaplog.Errorf("Build DownlinkNonUEAssociatedNRPPATransport failed : %s", err.Error())
 		return
 	}
-	SendToRanUe(ue, pkt)
+	SendToRan(ran, pkt)
 }
 
 func SendDeactivateTrace(amfUe *context.AmfUe, anType models.AccessType) {
@@ -0,0 +1,277 @@
+package ngap
+
+import (
+	"free5gc/lib/ngap/ngapConvert"
+	"free5gc/lib/ngap/ngapType"
+	"free5gc/lib/openapi/models"
+	"free5gc/src/amf/consumer"
+	"free5gc/src/amf/context"
+	ngap_message "free5gc/src/amf/ngap/message"
+	"io/ioutil"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// overloadController measures the AMF load periodically and, with hysteresis, starts the
+// overload in the RANs (TS 23.501 5.19.5.2) and lowers the capacity advertised to the NRF
+type overloadController struct {
+	mutex      sync.Mutex
+	stop       chan struct{}
+	overloaded bool
+	// relative capacity restored when the overload stops
+	normalCapacity int64
+
+	// process CPU time and wall time of the last CPU sample
+	cpuTime    time.Duration
+	sampleTime time.Time
+}
+
+var amfOverload overloadController
+
+// StartOverloadControl starts measuring the AMF load if the overload control is enabled
+func StartOverloadControl() {
+	config := context.AMF_Self().OverloadControl
+	if !config.Enable {
+		return
+	}
+
+	c := &amfOverload
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.stop != nil {
+		return
+	}
+	c.stop = make(chan struct{})
+	c.cpuTime, _ = processCpuTime()
+	c.sampleTime = time.Now()
+	go c.run(time.Duration(config.Interval)*time.Millisecond, c.stop)
+}
+
+// StopOverloadControl stops measuring the AMF load; an ongoing overload is not stopped in the RANs
+func StopOverloadControl() {
+	c := &amfOverload
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.stop != nil {
+		close(c.stop)
+		c.stop = nil
+	}
+}
+
+func (c *overloadController) run(interval time.Duration, stop chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			c.check()
+		case <-stop:
+			return
+		}
+	}
+}
+
+func (c *overloadController) check() {
+	amfSelf := context.AMF_Self()
+	config := amfSelf.OverloadControl
+	load := c.load(config)
+
+	// the NF profile is updated by this goroutine only, after the RANs are notified
+	var capacity int64
+	c.mutex.Lock()
+	switch {
+	case !c.overloaded && load >= config.StartThreshold:
+		Ngaplog.Warnf("AMF load %d%% reaches %d%%, start the overload", load, config.StartThreshold)
+		capacity = c.start()
+	case c.overloaded && load <= config.StopThreshold:
+		Ngaplog.Infof("AMF load %d%% falls to %d%%, stop the overload", load, config.StopThreshold)
+		c.overloaded = false
+		amfSelf.SetRelativeCapacity(c.normalCapacity)
+		amfSelf.AmfRanPool.Range(func(key, value interface{}) bool {
+			if ran := value.(*context.AmfRan); ran.Admitted {
+				ngap_message.SendOverloadStop(ran)
+			}
+			return true
+		})
+		capacity = c.normalCapacity
+	default:
+		c.mutex.Unlock()
+		return
+	}
+	c.mutex.Unlock()
+	updateNrfCapacity(capacity)
+}
+
+// start starts the overload in the RANs and returns the relative capacity to advertise;
+// c.mutex is held by the caller
+func (c *overloadController) start() int64 {
+	amfSelf := context.AMF_Self()
+	config := amfSelf.OverloadControl
+	c.overloaded = true
+	c.normalCapacity = amfSelf.GetRelativeCapacity()
+	amfSelf.SetRelativeCapacity(config.RelativeCapacity)
+	amfSelf.AmfRanPool.Range(func(key, value interface{}) bool {
+		if ran := value.(*context.AmfRan); ran.Admitted {
+			sendOverloadStart(ran)
+		}
+		return true
+	})
+	return config.RelativeCapacity
+}
+
+// startOverloadOnCongestion starts the overload when an NGAP message is rejected because its
+// worker queue is full; the load measurement stops it once the load falls
+func startOverloadOnCongestion() {
+	c := &amfOverload
+	c.mutex.Lock()
+	if c.stop == nil || c.overloaded {
+		c.mutex.Unlock()
+		return
+	}
+	Ngaplog.Warnf("NGAP worker queue is full, start the overload")
+	capacity := c.start()
+	c.mutex.Unlock()
+	go updateNrfCapacity(capacity)
+}
+
+// load returns the AMF load in percent, which is the highest usage of the configured limits
+func (c *overloadController) load(config context.OverloadControl) (load int) {
+	usage := func(value, limit int) {
+		if limit > 0 && value*100/limit > load {
+			load = value * 100 / limit
+		}
+	}
+	usage(int(GetDispatcherStatistics().QueuedMessages), config.MaxQueuedMessages)
+	usage(int(context.SbiRequestsInFlight()), config.MaxSbiRequests)
+	if config.UeCapacity > 0 {
+		usage(context.AMF_Self().NumOfUes(), config.UeCapacity)
+	}
+	if config.MaxCpuLoad > 0 {
+		if cpuLoad, ok := c.cpuLoad(); ok {
+			usage(cpuLoad, config.MaxCpuLoad)
+		}
+	}
+	return load
+}
+
+// cpuLoad returns the CPU usage of the AMF since the last sample, in percent of all the CPUs
+func (c *overloadController) cpuLoad() (int, bool) {
+	cpuTime, err := processCpuTime()
+	if err != nil {
+		Ngaplog.Debugf("CPU load is not available: %+v", err)
+		return 0, false
+	}
+	now := time.Now()
+	elapsed := now.Sub(c.sampleTime)
+	used := cpuTime - c.cpuTime
+	c.cpuTime, c.sampleTime = cpuTime, now
+	if elapsed <= 0 {
+		return 0, false
+	}
+	return int(used * 100 / elapsed / time.Duration(runtime.NumCPU())), true
+}
+
+// processCpuTime returns the user and system CPU time of the AMF process, read from
+// /proc/self/stat where the times are counted in ticks of 1/100 second
+func processCpuTime() (time.Duration, error) {
+	stat, err := ioutil.ReadFile("/proc/self/stat")
+	if err != nil {
+		return 0, err
+	}
+	// the fields following the command name, which is in parentheses
+	fields := strings.Fields(string(stat[strings.LastIndexByte(string(stat), ')')+1:]))
+	if len(fields) < 13 {
+		return 0, strconv.ErrSyntax
+	}
+	utime, err := strconv.ParseInt(fields[11], 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	stime, err := strconv.ParseInt(fields[12], 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(utime+stime) * 10 * time.Millisecond, nil
+}
+
+// sendOverloadStartIfOverloaded sends Overload Start to a RAN which completed NG Setup
+// while the AMF is overloaded
+func sendOverloadStartIfOverloaded(ran *context.AmfRan) {
+	c := &amfOverload
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.overloaded {
+		sendOverloadStart(ran)
+	}
+}
+
+func sendOverloadStart(ran *context.AmfRan) {
+	config := context.AMF_Self().OverloadControl
+	overloadResponse := buildOverloadResponse(config.OverloadAction)
+
+	if len(config.SNssaiList) > 0 {
+		item := ngapType.OverloadStartNSSAIItem{}
+		for _, snssai := range config.SNssaiList {
+			item.SliceOverloadList.List = append(item.SliceOverloadList.List, ngapType.SliceOverloadItem{
+				SNSSAI: ngapConvert.SNssaiToNgap(snssai),
+			})
+		}
+		item.SliceOverloadResponse = overloadResponse
+		if config.TrafficLoadReduction != 0 {
+			item.SliceTrafficLoadReductionIndication = &ngapType.TrafficLoadReductionIndication{
+				Value: config.TrafficLoadReduction,
+			}
+		}
+		overloadStartNSSAIList := &ngapType.OverloadStartNSSAIList{
+			List: []ngapType.OverloadStartNSSAIItem{item},
+		}
+		// the overload applies to the listed slices only
+		ngap_message.SendOverloadStart(ran, nil, 0, overloadStartNSSAIList)
+		return
+	}
+	ngap_message.SendOverloadStart(ran, overloadResponse, config.TrafficLoadReduction, nil)
+}
+
+// buildOverloadResponse returns the Overload Response of an overload action named as in
+// TS 38.413 9.3.1.105, or nil if no action is configured
+func buildOverloadResponse(action string) *ngapType.OverloadResponse {
+	overloadAction := new(ngapType.OverloadAction)
+	switch action {
+	case "":
+		return nil
+	case "rejectNonEmergencyMoDt":
+		overloadAction.Value = ngapType.OverloadActionPresentRejectNonEmergencyMoDt
+	case "rejectRrcCrSignalling":
+		overloadAction.Value = ngapType.OverloadActionPresentRejectRrcCrSignalling
+	case "permitEmergencySessionsAndMobileTerminatedServicesOnly":
+		overloadAction.Value = ngapType.OverloadActionPresentPermitEmergencySessionsAndMobileTerminatedServicesOnly
+	case "permitHighPrioritySessionsAndMobileTerminatedServicesOnly":
+		overloadAction.Value = ngapType.OverloadActionPresentPermitHighPrioritySessionsAndMobileTerminatedServicesOnly
+	default:
+		Ngaplog.Errorf("Unknown overload action: %s", action)
+		return nil
+	}
+	return &ngapType.OverloadResponse{
+		Present:        ngapType.OverloadResponsePresentOverloadAction,
+		OverloadAction: overloadAction,
+	}
+}
+
+// updateNrfCapacity advertises the relative capacity of the AMF in its NF profile
+func updateNrfCapacity(capacity int64) {
+	patchItem := []models.PatchItem{
+		{
+			Op:    models.PatchOperation_REPLACE,
+			Path:  "/capacity",
+			Value: capacity,
+		},
+	}
+	if _, problemDetails, err := consumer.SendUpdateNFInstance(patchItem); err != nil {
+		Ngaplog.Errorf("Update NF Instance capacity error: %+v", err)
+	} else if problemDetails != nil {
+		Ngaplog.Errorf("Update NF Instance capacity failed: %+v", problemDetails)
+	}
+}
@@ -0,0 +1,92 @@
+package service
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+)
+
+// pipeListeners holds the listening pipe transports, keyed by "address:port"
+var pipeListeners sync.Map
+
+type pipeTransport struct{}
+
+func (t *pipeTransport) Listen(addresses []string, port int) (Listener, error) {
+	if len(addresses) == 0 {
+		addresses = []string{""}
+	}
+
+	l := &pipeListener{
+		conns:  make(chan net.Conn),
+		closed: make(chan struct{}),
+	}
+	for _, address := range addresses {
+		key := net.JoinHostPort(address, strconv.Itoa(port))
+		if _, loaded := pipeListeners.LoadOrStore(key, l); loaded {
+			l.Close()
+			return nil, fmt.Errorf("Pipe address %s already in use", key)
+		}
+		l.keys = append(l.keys, key)
+	}
+	return l, nil
+}
+
+// DialPipe connects to an AMF which runs NGAP over the in-memory pipe transport
+// in the same process; it is meant for tests
+func DialPipe(address string, port int) (Conn, error) {
+	key := net.JoinHostPort(address, strconv.Itoa(port))
+	value, ok := pipeListeners.Load(key)
+	if !ok {
+		return nil, fmt.Errorf("No pipe listener on %s", key)
+	}
+	l := value.(*pipeListener)
+
+	client, server := net.Pipe()
+	select {
+	case l.conns <- server:
+		return newFramedConn(client), nil
+	case <-l.closed:
+		client.Close()
+		server.Close()
+		return nil, fmt.Errorf("Pipe listener on %s closed", key)
+	}
+}
+
+type pipeListener struct {
+	keys      []string
+	conns     chan net.Conn
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func (l *pipeListener) Accept() (Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return newFramedConn(conn), nil
+	case <-l.closed:
+		return nil, fmt.Errorf("Listener closed")
+	}
+}
+
+func (l *pipeListener) Close() error {
+	l.closeOnce.Do(func() {
+		close(l.closed)
+		for _, key := range l.keys {
+			pipeListeners.Delete(key)
+		}
+	})
+	return nil
+}
+
+func (l *pipeListener) Addr() net.Addr {
+	if len(l.keys) == 0 {
+		return pipeAddr("")
+	}
+	return pipeAddr(l.keys[0])
+}
+
+type pipeAddr string
+
+func (a pipeAddr) Network() string { return TransportPipe }
+func (a pipeAddr) String() string  { return string(a) }
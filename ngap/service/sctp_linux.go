@@ -0,0 +1,345 @@
+//+build linux
+
+package service
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"free5gc/src/amf/logger"
+	"io"
+	"net"
+	"sync/atomic"
+	"syscall"
+	"time"
+	"unsafe"
+
+	"github.com/ishidawataru/sctp"
+)
+
+const sctpEvents = sctp.SCTP_EVENT_DATA_IO | sctp.SCTP_EVENT_ASSOCIATION | sctp.SCTP_EVENT_ADDRESS |
+	sctp.SCTP_EVENT_SHUTDOWN
+
+var errSctpWriteTimeout = errors.New("SCTP write timeout")
+
+// SCTP notifications and ancillary data are in host byte order
+var nativeEndian binary.ByteOrder
+
+func init() {
+	i := uint16(1)
+	if *(*byte)(unsafe.Pointer(&i)) == 0 {
+		nativeEndian = binary.BigEndian
+	} else {
+		nativeEndian = binary.LittleEndian
+	}
+}
+
+type sctpTransport struct {
+	options TransportOptions
+}
+
+func (t *sctpTransport) Listen(addresses []string, port int) (Listener, error) {
+	ips := []net.IPAddr{}
+	ipNetwork, sctpNetwork := "ip", "sctp"
+	if t.options.Ipv6 {
+		ipNetwork, sctpNetwork = "ip6", "sctp6"
+	}
+
+	for _, addr := range addresses {
+		if netAddr, err := net.ResolveIPAddr(ipNetwork, addr); err != nil {
+			logger.NgapLog.Errorf("Error resolving address '%s': %v\n", addr, err)
+		} else {
+			logger.NgapLog.Debugf("Resolved address '%s' to %s\n", addr, netAddr)
+			ips = append(ips, *netAddr)
+		}
+	}
+
+	addr := &sctp.SCTPAddr{
+		IPAddrs: ips,
+		Port:    port,
+	}
+
+	listenFd := -1
+	config := sctp.SocketConfig{
+		InitMsg: sctp.InitMsg{
+			NumOstreams:    t.options.NumOutStreams,
+			MaxInstreams:   t.options.MaxInStreams,
+			MaxAttempts:    t.options.MaxAttempts,
+			MaxInitTimeout: t.options.MaxInitTimeout,
+		},
+		// The listening socket is accepted from directly so that the received message
+		// flags (notifications) are visible; event subscriptions and parameters set
+		// here are inherited by the accepted associations, which makes COMM_UP observable
+		Control: func(network, address string, c syscall.RawConn) error {
+			var err error
+			if errControl := c.Control(func(fd uintptr) {
+				listenFd = int(fd)
+				if err = sctp.NewSCTPConn(listenFd, nil).SubscribeEvents(sctpEvents); err != nil {
+					return
+				}
+				err = t.setSocketOptions(listenFd)
+			}); errControl != nil {
+				return errControl
+			}
+			return err
+		},
+	}
+
+	listener, err := config.Listen(sctpNetwork, addr)
+	if err != nil {
+		return nil, err
+	}
+	return &sctpListener{SCTPListener: listener, fd: listenFd}, nil
+}
+
+// setSocketOptions sets the RTO and path supervision parameters of the endpoint
+func (t *sctpTransport) setSocketOptions(fd int) error {
+	options := t.options
+	if options.RtoInitial != 0 || options.RtoMin != 0 || options.RtoMax != 0 {
+		// struct sctp_rtoinfo
+		rtoInfo := make([]byte, 16)
+		nativeEndian.PutUint32(rtoInfo[4:8], options.RtoInitial)
+		nativeEndian.PutUint32(rtoInfo[8:12], options.RtoMax)
+		nativeEndian.PutUint32(rtoInfo[12:16], options.RtoMin)
+		if err := setSctpSockopt(fd, sctp.SCTP_RTOINFO, rtoInfo); err != nil {
+			return fmt.Errorf("Set SCTP_RTOINFO error: %+v", err)
+		}
+	}
+
+	if options.HeartbeatInterval != 0 || options.PathMaxRetrans != 0 {
+		// struct sctp_paddrparams, which is packed: the sockaddr_storage address
+		// (all zeros, for every address) follows the association id
+		paddrParams := make([]byte, 156)
+		nativeEndian.PutUint32(paddrParams[132:136], options.HeartbeatInterval)
+		nativeEndian.PutUint16(paddrParams[136:138], options.PathMaxRetrans)
+		if options.HeartbeatInterval != 0 {
+			nativeEndian.PutUint32(paddrParams[146:150], sctpSppHbEnable)
+		}
+		if err := setSctpSockopt(fd, sctp.SCTP_PEER_ADDR_PARAMS, paddrParams); err != nil {
+			return fmt.Errorf("Set SCTP_PEER_ADDR_PARAMS error: %+v", err)
+		}
+	}
+	return nil
+}
+
+// SPP_HB_ENABLE of spp_flags
+const sctpSppHbEnable uint32 = 1
+
+func setSctpSockopt(fd, opt int, b []byte) error {
+	_, _, errno := syscall.Syscall6(syscall.SYS_SETSOCKOPT, uintptr(fd), sctp.SOL_SCTP, uintptr(opt),
+		uintptr(unsafe.Pointer(&b[0])), uintptr(len(b)), 0)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+type sctpListener struct {
+	*sctp.SCTPListener
+	fd int
+}
+
+func (l *sctpListener) Accept() (Conn, error) {
+	fd, _, err := syscall.Accept4(l.fd, syscall.SOCK_CLOEXEC)
+	if err != nil {
+		return nil, err
+	}
+	conn := &sctpConn{SCTPConn: sctp.NewSCTPConn(fd, nil), fd: int32(fd)}
+
+	if err := conn.setup(); err != nil {
+		if errClose := conn.Close(); errClose != nil {
+			logger.NgapLog.Errorf("Close error: %+v", errClose)
+		}
+		return nil, err
+	}
+	return conn, nil
+}
+
+type sctpConn struct {
+	*sctp.SCTPConn
+	fd         int32
+	remoteAddr net.Addr // kept since the address cannot be queried once the association is gone
+}
+
+func (c *sctpConn) setup() error {
+	info, err := c.GetDefaultSentParam()
+	if err != nil {
+		return fmt.Errorf("Get default sent param error: %+v", err)
+	}
+
+	info.PPID = NGAP_PPID
+	if err := c.SetDefaultSentParam(info); err != nil {
+		return fmt.Errorf("Set default sent param error: %+v", err)
+	}
+	logger.NgapLog.Debugf("Set default sent param[value: %+v] successfully", info)
+
+	if err := c.SubscribeEvents(sctpEvents); err != nil {
+		return fmt.Errorf("Subscribe SCTP events error: %+v", err)
+	}
+	logger.NgapLog.Debugln("Subscribe SCTP events DATA_IO, ASSOCIATION, ADDRESS and SHUTDOWN successfully")
+
+	if err := c.SetReadBuffer(int(readBufSize)); err != nil {
+		return fmt.Errorf("Set read buffer error: %+v", err)
+	}
+	logger.NgapLog.Debugf("Set read buffer to %d bytes", readBufSize)
+
+	c.remoteAddr = c.SCTPConn.RemoteAddr()
+	return nil
+}
+
+func (c *sctpConn) RemoteAddr() net.Addr {
+	if c.remoteAddr != nil {
+		return c.remoteAddr
+	}
+	return c.SCTPConn.RemoteAddr()
+}
+
+func (c *sctpConn) Close() error {
+	atomic.StoreInt32(&c.fd, -1)
+	return c.SCTPConn.Close()
+}
+
+func (c *sctpConn) ReadMsg(b []byte) (int, *StreamInfo, *Event, error) {
+	oob := make([]byte, 256)
+	for {
+		fd := int(atomic.LoadInt32(&c.fd))
+		if fd < 0 {
+			return 0, nil, nil, syscall.EBADF
+		}
+
+		n, oobn, recvflags, _, err := syscall.Recvmsg(fd, b, oob, 0)
+		if err != nil {
+			if err == syscall.EINTR {
+				continue
+			}
+			return 0, nil, nil, err
+		}
+		if n == 0 && oobn == 0 {
+			return 0, nil, nil, io.EOF
+		}
+
+		if recvflags&sctp.MSG_NOTIFICATION != 0 {
+			if event := parseSctpNotification(b[:n]); event != nil {
+				return 0, nil, event, nil
+			}
+			continue
+		}
+		info := parseSctpSndRcvInfo(oob[:oobn])
+		if info != nil {
+			// without MSG_EOR the message did not fit in b, or is delivered partially by the stack
+			info.EndOfRecord = recvflags&syscall.MSG_EOR != 0
+		}
+		return n, info, nil, nil
+	}
+}
+
+func (c *sctpConn) WriteMsg(b []byte, info *StreamInfo) (int, error) {
+	sndRcvInfo := &sctp.SndRcvInfo{PPID: NGAP_PPID}
+	if info != nil {
+		sndRcvInfo.Stream = info.Stream
+	}
+	n, err := c.SCTPWrite(b, sndRcvInfo)
+	if err == syscall.EAGAIN {
+		// SO_SNDTIMEO expired
+		err = errSctpWriteTimeout
+	}
+	return n, err
+}
+
+// SetWriteDeadline is implemented with SO_SNDTIMEO, since the SCTP socket is in blocking mode
+func (c *sctpConn) SetWriteDeadline(t time.Time) error {
+	fd := int(atomic.LoadInt32(&c.fd))
+	if fd < 0 {
+		return syscall.EBADF
+	}
+
+	var timeout time.Duration
+	if !t.IsZero() {
+		if timeout = time.Until(t); timeout <= 0 {
+			// a zero SO_SNDTIMEO means no timeout
+			timeout = time.Microsecond
+		}
+	}
+	tv := syscall.NsecToTimeval(timeout.Nanoseconds())
+	return syscall.SetsockoptTimeval(fd, syscall.SOL_SOCKET, syscall.SO_SNDTIMEO, &tv)
+}
+
+// parseSctpSndRcvInfo parses the struct sctp_sndrcvinfo ancillary data of a received message
+func parseSctpSndRcvInfo(oob []byte) *StreamInfo {
+	msgs, err := syscall.ParseSocketControlMessage(oob)
+	if err != nil {
+		return nil
+	}
+	for _, m := range msgs {
+		if m.Header.Level == syscall.IPPROTO_SCTP && m.Header.Type == sctp.SCTP_CMSG_SNDRCV && len(m.Data) >= 12 {
+			return &StreamInfo{
+				Stream: nativeEndian.Uint16(m.Data[0:2]),
+				PPID:   nativeEndian.Uint32(m.Data[8:12]),
+			}
+		}
+	}
+	return nil
+}
+
+var sctpPeerAddressStates = map[int32]string{
+	0: "available",
+	1: "unreachable",
+	2: "removed",
+	3: "added",
+	4: "made primary",
+	5: "confirmed",
+	6: "potentially failed",
+}
+
+// parseSctpNotification converts the SCTP notifications the AMF subscribes to
+// into association events; other notifications are ignored
+func parseSctpNotification(b []byte) *Event {
+	if len(b) < 8 {
+		return nil
+	}
+
+	switch sctp.SCTPNotificationType(nativeEndian.Uint16(b[0:2])) {
+	case sctp.SCTP_ASSOC_CHANGE:
+		// struct sctp_assoc_change
+		if len(b) < 16 {
+			return nil
+		}
+		state := sctp.SCTPState(nativeEndian.Uint16(b[8:10]))
+		outStreams := nativeEndian.Uint16(b[12:14])
+		inStreams := nativeEndian.Uint16(b[14:16])
+		switch state {
+		case sctp.SCTP_COMM_UP:
+			return &Event{Type: EventAssociationUp, InboundStreams: inStreams, OutboundStreams: outStreams}
+		case sctp.SCTP_RESTART:
+			return &Event{Type: EventAssociationRestart, InboundStreams: inStreams, OutboundStreams: outStreams}
+		case sctp.SCTP_COMM_LOST:
+			return &Event{Type: EventAssociationLost, Cause: "SCTP_COMM_LOST"}
+		case sctp.SCTP_SHUTDOWN_COMP:
+			return &Event{Type: EventAssociationLost, Cause: "SCTP_SHUTDOWN_COMP"}
+		case sctp.SCTP_CANT_STR_ASSOC:
+			return &Event{Type: EventAssociationLost, Cause: "SCTP_CANT_STR_ASSOC"}
+		}
+	case sctp.SCTP_SHUTDOWN_EVENT:
+		return &Event{Type: EventAssociationLost, Cause: "SCTP_SHUTDOWN_EVENT"}
+	case sctp.SCTP_PEER_ADDR_CHANGE:
+		// struct sctp_paddr_change: the sockaddr_storage starts at offset 8 and is followed by the state
+		if len(b) < 140 {
+			return nil
+		}
+		event := &Event{Type: EventPeerAddressChange}
+		switch nativeEndian.Uint16(b[8:10]) {
+		case syscall.AF_INET:
+			event.PeerAddress = net.IP(append([]byte{}, b[12:16]...))
+		case syscall.AF_INET6:
+			event.PeerAddress = net.IP(append([]byte{}, b[16:32]...))
+		}
+		state := int32(nativeEndian.Uint32(b[136:140]))
+		if stateStr, ok := sctpPeerAddressStates[state]; ok {
+			event.PeerAddressState = stateStr
+		} else {
+			event.PeerAddressState = fmt.Sprintf("state %d", state)
+		}
+		return event
+	}
+	return nil
+}
@@ -0,0 +1,13 @@
+//+build !linux
+
+package service
+
+import "fmt"
+
+type sctpTransport struct {
+	options TransportOptions
+}
+
+func (t *sctpTransport) Listen(addresses []string, port int) (Listener, error) {
+	return nil, fmt.Errorf("SCTP transport is not supported on this platform, use tcp or pipe")
+}
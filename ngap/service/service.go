@@ -2,109 +2,79 @@ package service
 
 import (
 	"encoding/hex"
+	"free5gc/src/amf/capture"
 	"free5gc/src/amf/logger"
 	"io"
 	"net"
 	"sync"
-
-	"github.com/ishidawataru/sctp"
+	"sync/atomic"
 )
 
-type Handler func(conn net.Conn, msg []byte)
+// Handler holds the callbacks of the NGAP server: HandleMessage receives every
+// NGAP message and HandleEvent the association events, including the loss of
+// the association when its connection ends. A message larger than the maximum
+// message size is discarded and HandleOversizedMessage gets its first part.
+type Handler struct {
+	HandleMessage          func(conn net.Conn, msg []byte)
+	HandleEvent            func(conn net.Conn, event *Event)
+	HandleOversizedMessage func(conn net.Conn, head []byte, size int)
+}
 
 const NGAP_PPID uint32 = 0x3c000000
 const readBufSize uint32 = 8192
 
-var sctpListener *sctp.SCTPListener
-var connections sync.Map
-
-func Run(addresses []string, port int, msgHandler Handler) {
-	ips := []net.IPAddr{}
+// maxMessageSize is the largest NGAP message which is reassembled and handled
+var maxMessageSize int = 65536
 
-	for _, addr := range addresses {
-		if netAddr, err := net.ResolveIPAddr("ip", addr); err != nil {
-			logger.NgapLog.Errorf("Error resolving address '%s': %v\n", addr, err)
+var listeners []Listener
+var connections sync.Map
+var stopped int32
+
+// Run starts one listener per address set; the addresses of a set are the local
+// addresses of one multi-homed SCTP endpoint. A set which cannot be listened on is
+// skipped, so that the other listeners still serve.
+func Run(transport Transport, addressSets [][]string, port int, handler Handler) {
+	atomic.StoreInt32(&stopped, 0)
+
+	listeners = nil
+	for _, addresses := range addressSets {
+		if l, err := transport.Listen(addresses, port); err != nil {
+			logger.NgapLog.Errorf("Failed to listen on %v port %d: %+v", addresses, port, err)
 		} else {
-			logger.NgapLog.Debugf("Resolved address '%s' to %s\n", addr, netAddr)
-			ips = append(ips, *netAddr)
+			listeners = append(listeners, l)
+			go listenAndServe(l, handler)
 		}
 	}
-
-	addr := &sctp.SCTPAddr{
-		IPAddrs: ips,
-		Port:    port,
-	}
-
-	go listenAndServe(addr, msgHandler)
 }
 
-func listenAndServe(addr *sctp.SCTPAddr, msgHandler Handler) {
-	initMsg := sctp.InitMsg{NumOstreams: 3, MaxInstreams: 5, MaxAttempts: 4, MaxInitTimeout: 8}
-
-	if listener, err := sctp.ListenSCTPExt("sctp", addr, initMsg); err != nil {
-		logger.NgapLog.Errorf("Failed to listen: %+v", err)
-		return
-	} else {
-		sctpListener = listener
+// SetMaxMessageSize sets the largest NGAP message the AMF accepts; a non-positive size keeps the current one
+func SetMaxMessageSize(size int) {
+	if size > 0 {
+		maxMessageSize = size
 	}
+}
 
-	logger.NgapLog.Infof("Listen on %s", sctpListener.Addr())
+func listenAndServe(listener Listener, handler Handler) {
+	logger.NgapLog.Infof("Listen on %s", listener.Addr())
 
 	for {
-		var conn *sctp.SCTPConn
-		if newConn, err := sctpListener.AcceptSCTP(); err != nil {
-			logger.NgapLog.Errorf("Failed to accept: %+v", err)
-			continue
-		} else {
-			conn = newConn
-		}
-
-		var info *sctp.SndRcvInfo
-		if infoTmp, err := conn.GetDefaultSentParam(); err != nil {
-			logger.NgapLog.Errorf("Failed to accept: %+v", err)
-			if err = conn.Close(); err != nil {
-				logger.NgapLog.Errorf("Close error: %+v", err)
-			}
-		} else {
-			info = infoTmp
-		}
-
-		info.PPID = NGAP_PPID
-		if err := conn.SetDefaultSentParam(info); err != nil {
-			logger.NgapLog.Errorf("Failed to accept: %+v", err)
-			if err = conn.Close(); err != nil {
-				logger.NgapLog.Errorf("Close error: %+v", err)
+		var conn Conn
+		if newConn, err := listener.Accept(); err != nil {
+			if atomic.LoadInt32(&stopped) == 1 {
+				return
 			}
-			continue
-		} else {
-			logger.NgapLog.Debugf("Set default sent param[value: %+v] successfully", info)
-		}
-
-		if err := conn.SubscribeEvents(sctp.SCTP_EVENT_DATA_IO); err != nil {
 			logger.NgapLog.Errorf("Failed to accept: %+v", err)
-			if err = conn.Close(); err != nil {
-				logger.NgapLog.Errorf("Close error: %+v", err)
-			}
 			continue
 		} else {
-			logger.NgapLog.Debugln("Subscribe SCTP event DATA_IO successfully")
-		}
-
-		if err := conn.SetReadBuffer(int(readBufSize)); err != nil {
-			logger.NgapLog.Errorf("Failed to accept: %+v", err)
-			if err = conn.Close(); err != nil {
-				logger.NgapLog.Errorf("Close error: %+v", err)
-			}
-			continue
-		} else {
-			logger.NgapLog.Debugf("Set read buffer to %d bytes", readBufSize)
+			conn = newConn
 		}
 
-		logger.NgapLog.Infof("[AMF] SCTP Accept from: %s", conn.RemoteAddr().String())
+		logger.NgapLog.Infof("[AMF] NGAP Accept from: %s", conn.RemoteAddr().String())
 
 		connections.Store(conn, conn)
 		go func() {
-			if err := handleConnection(conn, readBufSize, msgHandler); err != nil {
+			lostEvent, err := handleConnection(conn, readBufSize, handler)
+			if err != nil {
 				logger.NgapLog.Errorf("Handle connection[addr: %+v] error: %+v", conn.RemoteAddr(), err)
 			}
 			// if AMF call Stop(), then conn.Close() will return "bad file descriptor" error
@@ -113,15 +83,33 @@ func listenAndServe(addr *sctp.SCTPAddr, msgHandler Handler) {
 				logger.NgapLog.Errorf("close connection error: %+v", err)
 			}
 			connections.Delete(conn)
+
+			// the RANs are not cleaned up one by one when the whole AMF stops
+			if atomic.LoadInt32(&stopped) == 1 {
+				return
+			}
+			if lostEvent == nil {
+				lostEvent = &Event{Type: EventAssociationLost, Cause: "connection closed"}
+				if err != nil {
+					lostEvent.Cause = err.Error()
+				}
+			}
+			logger.NgapLog.Warnf("[AMF] NGAP association with %s lost: %s", conn.RemoteAddr(), lostEvent.Cause)
+			if handler.HandleEvent != nil {
+				handler.HandleEvent(conn, lostEvent)
+			}
 		}()
 	}
 }
 
 func Stop() {
-	logger.NgapLog.Infof("Close SCTP server...")
-	if err := sctpListener.Close(); err != nil {
-		logger.NgapLog.Error(err)
-		logger.NgapLog.Infof("SCTP server may not close normally.")
+	logger.NgapLog.Infof("Close NGAP server...")
+	atomic.StoreInt32(&stopped, 1)
+	for _, listener := range listeners {
+		if err := listener.Close(); err != nil {
+			logger.NgapLog.Error(err)
+			logger.NgapLog.Infof("NGAP server may not close normally.")
+		}
 	}
 
 	connections.Range(func(key, value interface{}) bool {
@@ -132,32 +120,71 @@ func Stop() {
 		return true
 	})
 
-	logger.NgapLog.Infof("SCTP server closed")
+	logger.NgapLog.Infof("NGAP server closed")
 }
 
-func handleConnection(conn *sctp.SCTPConn, bufsize uint32, msgHandler Handler) error {
-	for {
-		buf := make([]byte, bufsize)
+// handleConnection reads the association until it ends; the returned event is
+// the association loss reported by the transport, if any. Messages delivered in
+// several reads are reassembled up to maxMessageSize.
+func handleConnection(conn Conn, bufsize uint32, handler Handler) (*Event, error) {
+	buf := make([]byte, bufsize)
+	var msg []byte
+	msgSize := 0 // the size of the message being read, including the parts discarded once it is too large
 
-		n, info, err := conn.SCTPRead(buf)
+	for {
+		n, info, event, err := conn.ReadMsg(buf)
 		if err != nil {
 			if err == io.EOF || err == io.ErrUnexpectedEOF {
 				logger.NgapLog.Debugln("Read EOF from client")
-				return nil
+				return nil, nil
 			} else {
-				return err
+				return nil, err
 			}
 		}
 
+		if event != nil {
+			logger.NgapLog.Infof("[AMF] NGAP association with %s: %s", conn.RemoteAddr(), event)
+			if event.Type == EventAssociationLost {
+				return event, nil
+			}
+			if handler.HandleEvent != nil {
+				handler.HandleEvent(conn, event)
+			}
+			continue
+		}
+
 		if info == nil || info.PPID != NGAP_PPID {
 			logger.NgapLog.Warnln("Received SCTP PPID != 60, discard this packet")
 			continue
 		}
 
 		logger.NgapLog.Tracef("Read %d bytes", n)
-		logger.NgapLog.Tracef("Packet content:\n%+v", hex.Dump(buf[:n]))
 
-		// TODO: concurrent on per-UE message
-		msgHandler(conn, buf[:n])
+		msgSize += n
+		if len(msg)+n > maxMessageSize {
+			// only the first part of a message which is too large is kept, to report it
+			n = maxMessageSize - len(msg)
+		}
+		msg = append(msg, buf[:n]...)
+		if !info.EndOfRecord {
+			continue
+		}
+
+		if msgSize > maxMessageSize {
+			logger.NgapLog.Warnf("Discard NGAP message of %d bytes from %s: larger than %d bytes", msgSize,
+				conn.RemoteAddr(), maxMessageSize)
+			if handler.HandleOversizedMessage != nil {
+				handler.HandleOversizedMessage(conn, msg, msgSize)
+			}
+		} else {
+			logger.NgapLog.Tracef("Packet content:\n%+v", hex.Dump(msg))
+			if capture.Enabled() {
+				capture.Ngap(conn.LocalAddr(), conn.RemoteAddr(), true, info.Stream, msg)
+			}
+			// HandleMessage only decodes the message and queues it to the worker of its UE or RAN
+			handler.HandleMessage(conn, msg)
+		}
+		msg = nil
+		msgSize = 0
 	}
 }
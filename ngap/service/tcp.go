@@ -0,0 +1,177 @@
+package service
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+)
+
+// frameHeaderLen is the length of the header which prefixes every NGAP message
+// on stream transports: message length (4 bytes), stream (2 bytes), reserved (2 bytes)
+const frameHeaderLen = 8
+
+type tcpTransport struct {
+	options TransportOptions
+}
+
+func (t *tcpTransport) Listen(addresses []string, port int) (Listener, error) {
+	if len(addresses) == 0 {
+		addresses = []string{""}
+	}
+	network := "tcp"
+	if t.options.Ipv6 {
+		network = "tcp6"
+	}
+
+	var listeners []net.Listener
+	for _, address := range addresses {
+		listener, err := net.Listen(network, net.JoinHostPort(address, strconv.Itoa(port)))
+		if err != nil {
+			for _, l := range listeners {
+				l.Close()
+			}
+			return nil, err
+		}
+		listeners = append(listeners, listener)
+	}
+	return newStreamListener(listeners), nil
+}
+
+// DialTcp connects to an AMF using the length-prefixed TCP transport
+func DialTcp(address string) (Conn, error) {
+	conn, err := net.Dial("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	return newFramedConn(conn), nil
+}
+
+// streamListener merges the connections accepted by several stream listeners
+type streamListener struct {
+	listeners []net.Listener
+	conns     chan net.Conn
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func newStreamListener(listeners []net.Listener) *streamListener {
+	l := &streamListener{
+		listeners: listeners,
+		conns:     make(chan net.Conn),
+		closed:    make(chan struct{}),
+	}
+	for _, listener := range listeners {
+		go l.acceptLoop(listener)
+	}
+	return l
+}
+
+func (l *streamListener) acceptLoop(listener net.Listener) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		select {
+		case l.conns <- conn:
+		case <-l.closed:
+			conn.Close()
+			return
+		}
+	}
+}
+
+func (l *streamListener) Accept() (Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return newFramedConn(conn), nil
+	case <-l.closed:
+		return nil, fmt.Errorf("Listener closed")
+	}
+}
+
+func (l *streamListener) Close() (err error) {
+	l.closeOnce.Do(func() {
+		close(l.closed)
+		for _, listener := range l.listeners {
+			if errClose := listener.Close(); errClose != nil {
+				err = errClose
+			}
+		}
+	})
+	return err
+}
+
+func (l *streamListener) Addr() net.Addr {
+	return l.listeners[0].Addr()
+}
+
+// framedConn carries NGAP messages over a stream-oriented net.Conn by prefixing
+// each message with its length and the stream it would be sent on with SCTP
+type framedConn struct {
+	net.Conn
+	readMutex  sync.Mutex
+	writeMutex sync.Mutex
+	remaining  uint32 // bytes of the current message not read yet
+	stream     uint16 // stream of the current message
+}
+
+func newFramedConn(conn net.Conn) *framedConn {
+	return &framedConn{Conn: conn}
+}
+
+func (c *framedConn) ReadMsg(b []byte) (int, *StreamInfo, *Event, error) {
+	c.readMutex.Lock()
+	defer c.readMutex.Unlock()
+
+	// zero-length messages are skipped since an empty read means a closed association
+	for c.remaining == 0 {
+		var header [frameHeaderLen]byte
+		if _, err := io.ReadFull(c.Conn, header[:]); err != nil {
+			return 0, nil, nil, err
+		}
+		c.remaining = binary.BigEndian.Uint32(header[0:4])
+		c.stream = binary.BigEndian.Uint16(header[4:6])
+	}
+
+	n := len(b)
+	if uint32(n) > c.remaining {
+		n = int(c.remaining)
+	}
+	if _, err := io.ReadFull(c.Conn, b[:n]); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return 0, nil, nil, err
+	}
+	c.remaining -= uint32(n)
+	return n, &StreamInfo{Stream: c.stream, PPID: NGAP_PPID, EndOfRecord: c.remaining == 0}, nil, nil
+}
+
+func (c *framedConn) WriteMsg(b []byte, info *StreamInfo) (int, error) {
+	frame := make([]byte, frameHeaderLen+len(b))
+	binary.BigEndian.PutUint32(frame[0:4], uint32(len(b)))
+	if info != nil {
+		binary.BigEndian.PutUint16(frame[4:6], info.Stream)
+	}
+	copy(frame[frameHeaderLen:], b)
+
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+	if _, err := c.Conn.Write(frame); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+func (c *framedConn) Read(b []byte) (int, error) {
+	n, _, _, err := c.ReadMsg(b)
+	return n, err
+}
+
+func (c *framedConn) Write(b []byte) (int, error) {
+	return c.WriteMsg(b, nil)
+}
@@ -0,0 +1,111 @@
+package service
+
+import (
+	"fmt"
+	"net"
+)
+
+const (
+	TransportSctp = "sctp"
+	TransportTcp  = "tcp"
+	TransportPipe = "pipe"
+)
+
+// StreamInfo is the per-message information an NGAP transport delivers along with the payload
+type StreamInfo struct {
+	Stream      uint16 // SCTP stream identifier
+	PPID        uint32 // payload protocol identifier, NGAP_PPID for NGAP
+	EndOfRecord bool   // the read completes the message (MSG_EOR)
+}
+
+// EventType is the type of an association event
+type EventType int
+
+const (
+	EventAssociationUp EventType = iota
+	EventAssociationRestart
+	EventAssociationLost
+	EventPeerAddressChange
+)
+
+// Event is an association state change reported by the transport, e.g. an SCTP notification
+type Event struct {
+	Type  EventType
+	Cause string
+	// EventAssociationUp and EventAssociationRestart
+	InboundStreams  uint16
+	OutboundStreams uint16
+	// EventPeerAddressChange
+	PeerAddress      net.IP
+	PeerAddressState string
+}
+
+func (e *Event) String() string {
+	switch e.Type {
+	case EventAssociationUp:
+		return fmt.Sprintf("association up (in streams: %d, out streams: %d)", e.InboundStreams, e.OutboundStreams)
+	case EventAssociationRestart:
+		return fmt.Sprintf("association restart (in streams: %d, out streams: %d)", e.InboundStreams, e.OutboundStreams)
+	case EventAssociationLost:
+		return fmt.Sprintf("association lost (%s)", e.Cause)
+	case EventPeerAddressChange:
+		return fmt.Sprintf("peer address %s %s", e.PeerAddress, e.PeerAddressState)
+	default:
+		return fmt.Sprintf("unknown event %d", e.Type)
+	}
+}
+
+// Conn is one NGAP association. Read and Write of the embedded net.Conn carry one
+// NGAP message on stream 0; ReadMsg and WriteMsg expose the stream information.
+type Conn interface {
+	net.Conn
+	// ReadMsg reads the next message, or the next part of it if b is too small;
+	// when the transport reports an association event instead, n is 0 and event is set
+	ReadMsg(b []byte) (n int, info *StreamInfo, event *Event, err error)
+	// WriteMsg sends b as one message; a nil info sends it on stream 0
+	WriteMsg(b []byte, info *StreamInfo) (n int, err error)
+}
+
+// Listener accepts NGAP associations from NG-RAN nodes
+type Listener interface {
+	Accept() (Conn, error)
+	Close() error
+	Addr() net.Addr
+}
+
+// Transport creates NGAP listeners; SCTP is used in production, while the TCP
+// and in-memory pipe transports let NGAP run where SCTP is not available
+type Transport interface {
+	Listen(addresses []string, port int) (Listener, error)
+}
+
+// TransportOptions are the association parameters requested by the AMF. Except
+// Ipv6, they only apply to SCTP, and a zero value keeps the default of the system.
+type TransportOptions struct {
+	Ipv6           bool   // listen on IPv6 only, host names are resolved to IPv6 addresses
+	NumOutStreams  uint16 // outbound streams requested in INIT
+	MaxInStreams   uint16 // inbound streams accepted from the peer
+	MaxAttempts    uint16 // INIT retransmissions
+	MaxInitTimeout uint16 // largest INIT retransmission timeout, unit is millisecond
+	// retransmission timeout, unit is millisecond
+	RtoInitial uint32
+	RtoMin     uint32
+	RtoMax     uint32
+	// path supervision
+	HeartbeatInterval uint32 // unit is millisecond
+	PathMaxRetrans    uint16 // retransmissions before a peer address is unreachable
+}
+
+// NewTransport returns the NGAP transport with the given name; an empty name selects SCTP
+func NewTransport(name string, options TransportOptions) (Transport, error) {
+	switch name {
+	case "", TransportSctp:
+		return &sctpTransport{options: options}, nil
+	case TransportTcp:
+		return &tcpTransport{options: options}, nil
+	case TransportPipe:
+		return &pipeTransport{}, nil
+	default:
+		return nil, fmt.Errorf("Unknown NGAP transport: %s", name)
+	}
+}
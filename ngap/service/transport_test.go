@@ -0,0 +1,154 @@
+package service_test
+
+import (
+	"free5gc/src/amf/ngap/service"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStreamTransports(t *testing.T) {
+	testCases := []struct {
+		name string
+		dial func() (service.Conn, error)
+	}{
+		{service.TransportPipe, func() (service.Conn, error) { return service.DialPipe("127.0.0.1", 38412) }},
+		{service.TransportTcp, func() (service.Conn, error) { return service.DialTcp("127.0.0.1:38413") }},
+	}
+	ports := map[string]int{service.TransportPipe: 38412, service.TransportTcp: 38413}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			transport, err := service.NewTransport(tc.name, service.TransportOptions{})
+			require.NoError(t, err)
+
+			received := make(chan []byte, 1)
+			events := make(chan *service.Event, 1)
+			service.Run(transport, [][]string{{"127.0.0.1"}}, ports[tc.name], service.Handler{
+				HandleMessage: func(conn net.Conn, msg []byte) {
+					received <- append([]byte{}, msg...)
+					_, err := conn.(service.Conn).WriteMsg(msg, &service.StreamInfo{Stream: 1})
+					assert.NoError(t, err)
+				},
+				HandleEvent: func(conn net.Conn, event *service.Event) {
+					events <- event
+				},
+			})
+			defer service.Stop()
+
+			conn, err := tc.dial()
+			require.NoError(t, err)
+
+			msg := []byte{0x00, 0x15, 0x00, 0x01, 0x02}
+			_, err = conn.Write(msg)
+			require.NoError(t, err)
+
+			select {
+			case got := <-received:
+				assert.Equal(t, msg, got)
+			case <-time.After(time.Second):
+				t.Fatal("message not delivered to the handler")
+			}
+
+			buf := make([]byte, 64)
+			n, info, _, err := conn.ReadMsg(buf)
+			require.NoError(t, err)
+			assert.Equal(t, msg, buf[:n])
+			assert.Equal(t, uint16(1), info.Stream)
+			assert.Equal(t, service.NGAP_PPID, info.PPID)
+
+			require.NoError(t, conn.Close())
+			select {
+			case event := <-events:
+				assert.Equal(t, service.EventAssociationLost, event.Type)
+			case <-time.After(time.Second):
+				t.Fatal("association loss not reported to the handler")
+			}
+		})
+	}
+}
+
+func TestMessageReassembly(t *testing.T) {
+	transport, err := service.NewTransport(service.TransportPipe, service.TransportOptions{})
+	require.NoError(t, err)
+
+	received := make(chan []byte, 1)
+	oversized := make(chan int, 1)
+	service.Run(transport, [][]string{{"127.0.0.1"}}, 38414, service.Handler{
+		HandleMessage: func(conn net.Conn, msg []byte) {
+			received <- msg
+		},
+		HandleOversizedMessage: func(conn net.Conn, head []byte, size int) {
+			assert.Len(t, head, 16384)
+			oversized <- size
+		},
+	})
+	defer service.Stop()
+
+	conn, err := service.DialPipe("127.0.0.1", 38414)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	// larger than the read buffer of the server
+	msg := make([]byte, 20000)
+	for i := range msg {
+		msg[i] = byte(i)
+	}
+	_, err = conn.Write(msg)
+	require.NoError(t, err)
+
+	select {
+	case got := <-received:
+		assert.Equal(t, msg, got)
+	case <-time.After(time.Second):
+		t.Fatal("message not delivered to the handler")
+	}
+
+	service.SetMaxMessageSize(16384)
+	defer service.SetMaxMessageSize(65536)
+
+	_, err = conn.Write(msg)
+	require.NoError(t, err)
+
+	select {
+	case size := <-oversized:
+		assert.Equal(t, len(msg), size)
+	case <-received:
+		t.Fatal("oversized message delivered to the handler")
+	case <-time.After(time.Second):
+		t.Fatal("oversized message not reported")
+	}
+}
+
+func TestMultipleListeners(t *testing.T) {
+	transport, err := service.NewTransport(service.TransportPipe, service.TransportOptions{})
+	require.NoError(t, err)
+
+	received := make(chan []byte, 2)
+	service.Run(transport, [][]string{{"10.0.0.1", "10.0.1.1"}, {"::1"}}, 38415, service.Handler{
+		HandleMessage: func(conn net.Conn, msg []byte) {
+			received <- append([]byte{}, msg...)
+		},
+	})
+	defer service.Stop()
+
+	for _, address := range []string{"10.0.1.1", "::1"} {
+		conn, err := service.DialPipe(address, 38415)
+		require.NoError(t, err)
+
+		msg := []byte(address)
+		_, err = conn.Write(msg)
+		require.NoError(t, err)
+
+		select {
+		case got := <-received:
+			assert.Equal(t, msg, got)
+		case <-time.After(time.Second):
+			t.Fatalf("message to %s not delivered to the handler", address)
+		}
+		require.NoError(t, conn.Close())
+	}
+}
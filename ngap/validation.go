@@ -0,0 +1,443 @@
+package ngap
+
+import (
+	"free5gc/lib/aper"
+	"free5gc/lib/ngap/ngapType"
+	"free5gc/src/amf/context"
+	ngap_message "free5gc/src/amf/ngap/message"
+	"reflect"
+)
+
+const (
+	reject          = ngapType.CriticalityPresentReject
+	ignore          = ngapType.CriticalityPresentIgnore
+	ignoreAndNotify = ngapType.CriticalityPresentIgnoreAndNotify
+)
+
+// ieSpec is a mandatory IE of a message with its criticality, TS 38.413 clause 9.2
+type ieSpec struct {
+	id          int64
+	criticality aper.Enumerated
+}
+
+type messageKey struct {
+	present       int
+	procedureCode int64
+}
+
+// mandatoryIEs lists the mandatory IEs of the messages the AMF receives; the messages whose IEs are all
+// optional, e.g. RAN Configuration Update or Error Indication, are not listed
+var mandatoryIEs = map[messageKey][]ieSpec{
+	// initiating messages
+	{ngapType.NGAPPDUPresentInitiatingMessage, ngapType.ProcedureCodeNGSetup}: {
+		{ngapType.ProtocolIEIDGlobalRANNodeID, reject},
+		{ngapType.ProtocolIEIDSupportedTAList, reject},
+		{ngapType.ProtocolIEIDDefaultPagingDRX, ignore},
+	},
+	{ngapType.NGAPPDUPresentInitiatingMessage, ngapType.ProcedureCodeInitialUEMessage}: {
+		{ngapType.ProtocolIEIDRANUENGAPID, reject},
+		{ngapType.ProtocolIEIDNASPDU, reject},
+		{ngapType.ProtocolIEIDUserLocationInformation, reject},
+		{ngapType.ProtocolIEIDRRCEstablishmentCause, ignore},
+	},
+	{ngapType.NGAPPDUPresentInitiatingMessage, ngapType.ProcedureCodeUplinkNASTransport}: {
+		{ngapType.ProtocolIEIDAMFUENGAPID, reject},
+		{ngapType.ProtocolIEIDRANUENGAPID, reject},
+		{ngapType.ProtocolIEIDNASPDU, reject},
+		{ngapType.ProtocolIEIDUserLocationInformation, ignore},
+	},
+	{ngapType.NGAPPDUPresentInitiatingMessage, ngapType.ProcedureCodeNGReset}: {
+		{ngapType.ProtocolIEIDCause, ignore},
+		{ngapType.ProtocolIEIDResetType, reject},
+	},
+	{ngapType.NGAPPDUPresentInitiatingMessage, ngapType.ProcedureCodeHandoverCancel}: {
+		{ngapType.ProtocolIEIDAMFUENGAPID, reject},
+		{ngapType.ProtocolIEIDRANUENGAPID, reject},
+		{ngapType.ProtocolIEIDCause, ignore},
+	},
+	{ngapType.NGAPPDUPresentInitiatingMessage, ngapType.ProcedureCodeUEContextReleaseRequest}: {
+		{ngapType.ProtocolIEIDAMFUENGAPID, reject},
+		{ngapType.ProtocolIEIDRANUENGAPID, reject},
+		{ngapType.ProtocolIEIDCause, ignore},
+	},
+	{ngapType.NGAPPDUPresentInitiatingMessage, ngapType.ProcedureCodeNASNonDeliveryIndication}: {
+		{ngapType.ProtocolIEIDAMFUENGAPID, reject},
+		{ngapType.ProtocolIEIDRANUENGAPID, reject},
+		{ngapType.ProtocolIEIDNASPDU, ignore},
+		{ngapType.ProtocolIEIDCause, ignore},
+	},
+	{ngapType.NGAPPDUPresentInitiatingMessage, ngapType.ProcedureCodeLocationReportingFailureIndication}: {
+		{ngapType.ProtocolIEIDAMFUENGAPID, reject},
+		{ngapType.ProtocolIEIDRANUENGAPID, reject},
+		{ngapType.ProtocolIEIDCause, ignore},
+	},
+	{ngapType.NGAPPDUPresentInitiatingMessage, ngapType.ProcedureCodeUERadioCapabilityInfoIndication}: {
+		{ngapType.ProtocolIEIDAMFUENGAPID, reject},
+		{ngapType.ProtocolIEIDRANUENGAPID, reject},
+		{ngapType.ProtocolIEIDUERadioCapability, ignore},
+	},
+	{ngapType.NGAPPDUPresentInitiatingMessage, ngapType.ProcedureCodeHandoverNotification}: {
+		{ngapType.ProtocolIEIDAMFUENGAPID, reject},
+		{ngapType.ProtocolIEIDRANUENGAPID, reject},
+		{ngapType.ProtocolIEIDUserLocationInformation, ignore},
+	},
+	{ngapType.NGAPPDUPresentInitiatingMessage, ngapType.ProcedureCodeHandoverPreparation}: {
+		{ngapType.ProtocolIEIDAMFUENGAPID, reject},
+		{ngapType.ProtocolIEIDRANUENGAPID, reject},
+		{ngapType.ProtocolIEIDHandoverType, reject},
+		{ngapType.ProtocolIEIDCause, ignore},
+		{ngapType.ProtocolIEIDTargetID, reject},
+		{ngapType.ProtocolIEIDPDUSessionResourceListHORqd, reject},
+		{ngapType.ProtocolIEIDSourceToTargetTransparentContainer, reject},
+	},
+	{ngapType.NGAPPDUPresentInitiatingMessage, ngapType.ProcedureCodeRRCInactiveTransitionReport}: {
+		{ngapType.ProtocolIEIDAMFUENGAPID, reject},
+		{ngapType.ProtocolIEIDRANUENGAPID, reject},
+		{ngapType.ProtocolIEIDRRCState, ignore},
+		{ngapType.ProtocolIEIDUserLocationInformation, ignore},
+	},
+	{ngapType.NGAPPDUPresentInitiatingMessage, ngapType.ProcedureCodePDUSessionResourceNotify}: {
+		{ngapType.ProtocolIEIDAMFUENGAPID, reject},
+		{ngapType.ProtocolIEIDRANUENGAPID, reject},
+	},
+	{ngapType.NGAPPDUPresentInitiatingMessage, ngapType.ProcedureCodePathSwitchRequest}: {
+		{ngapType.ProtocolIEIDRANUENGAPID, reject},
+		{ngapType.ProtocolIEIDSourceAMFUENGAPID, reject},
+		{ngapType.ProtocolIEIDUserLocationInformation, ignore},
+		{ngapType.ProtocolIEIDUESecurityCapabilities, ignore},
+		{ngapType.ProtocolIEIDPDUSessionResourceToBeSwitchedDLList, reject},
+	},
+	{ngapType.NGAPPDUPresentInitiatingMessage, ngapType.ProcedureCodeLocationReport}: {
+		{ngapType.ProtocolIEIDAMFUENGAPID, reject},
+		{ngapType.ProtocolIEIDRANUENGAPID, reject},
+		{ngapType.ProtocolIEIDUserLocationInformation, ignore},
+		{ngapType.ProtocolIEIDLocationReportingRequestType, ignore},
+	},
+	{ngapType.NGAPPDUPresentInitiatingMessage, ngapType.ProcedureCodeUplinkUEAssociatedNRPPaTransport}: {
+		{ngapType.ProtocolIEIDAMFUENGAPID, reject},
+		{ngapType.ProtocolIEIDRANUENGAPID, reject},
+		{ngapType.ProtocolIEIDRoutingID, reject},
+		{ngapType.ProtocolIEIDNRPPaPDU, reject},
+	},
+	{ngapType.NGAPPDUPresentInitiatingMessage, ngapType.ProcedureCodePDUSessionResourceModifyIndication}: {
+		{ngapType.ProtocolIEIDAMFUENGAPID, reject},
+		{ngapType.ProtocolIEIDRANUENGAPID, reject},
+		{ngapType.ProtocolIEIDPDUSessionResourceModifyListModInd, reject},
+	},
+	{ngapType.NGAPPDUPresentInitiatingMessage, ngapType.ProcedureCodeCellTrafficTrace}: {
+		{ngapType.ProtocolIEIDAMFUENGAPID, reject},
+		{ngapType.ProtocolIEIDRANUENGAPID, reject},
+		{ngapType.ProtocolIEIDNGRANTraceID, ignore},
+		{ngapType.ProtocolIEIDNGRANCGI, ignore},
+		{ngapType.ProtocolIEIDTraceCollectionEntityIPAddress, ignore},
+	},
+	{ngapType.NGAPPDUPresentInitiatingMessage, ngapType.ProcedureCodeUplinkRANStatusTransfer}: {
+		{ngapType.ProtocolIEIDAMFUENGAPID, reject},
+		{ngapType.ProtocolIEIDRANUENGAPID, reject},
+		{ngapType.ProtocolIEIDRANStatusTransferTransparentContainer, reject},
+	},
+	{ngapType.NGAPPDUPresentInitiatingMessage, ngapType.ProcedureCodeUplinkNonUEAssociatedNRPPaTransport}: {
+		{ngapType.ProtocolIEIDRoutingID, reject},
+		{ngapType.ProtocolIEIDNRPPaPDU, reject},
+	},
+	{ngapType.NGAPPDUPresentInitiatingMessage, ngapType.ProcedureCodePWSRestartIndication}: {
+		{ngapType.ProtocolIEIDCellIDListForRestart, reject},
+		{ngapType.ProtocolIEIDGlobalRANNodeID, reject},
+		{ngapType.ProtocolIEIDTAIListForRestart, reject},
+	},
+	{ngapType.NGAPPDUPresentInitiatingMessage, ngapType.ProcedureCodePWSFailureIndication}: {
+		{ngapType.ProtocolIEIDPWSFailedCellIDList, reject},
+		{ngapType.ProtocolIEIDGlobalRANNodeID, reject},
+	},
+	{ngapType.NGAPPDUPresentInitiatingMessage, ngapType.ProcedureCodeSecondaryRATDataUsageReport}: {
+		{ngapType.ProtocolIEIDAMFUENGAPID, reject},
+		{ngapType.ProtocolIEIDRANUENGAPID, reject},
+		{ngapType.ProtocolIEIDPDUSessionResourceSecondaryRATUsageList, ignore},
+	},
+	{ngapType.NGAPPDUPresentInitiatingMessage, ngapType.ProcedureCodeTraceFailureIndication}: {
+		{ngapType.ProtocolIEIDAMFUENGAPID, reject},
+		{ngapType.ProtocolIEIDRANUENGAPID, reject},
+		{ngapType.ProtocolIEIDNGRANTraceID, ignore},
+		{ngapType.ProtocolIEIDCause, ignore},
+	},
+	// successful outcomes
+	{ngapType.NGAPPDUPresentSuccessfulOutcome, ngapType.ProcedureCodeUEContextRelease}: {
+		{ngapType.ProtocolIEIDAMFUENGAPID, ignore},
+		{ngapType.ProtocolIEIDRANUENGAPID, ignore},
+	},
+	{ngapType.NGAPPDUPresentSuccessfulOutcome, ngapType.ProcedureCodePDUSessionResourceRelease}: {
+		{ngapType.ProtocolIEIDAMFUENGAPID, ignore},
+		{ngapType.ProtocolIEIDRANUENGAPID, ignore},
+		{ngapType.ProtocolIEIDPDUSessionResourceReleasedListRelRes, ignore},
+	},
+	{ngapType.NGAPPDUPresentSuccessfulOutcome, ngapType.ProcedureCodeUERadioCapabilityCheck}: {
+		{ngapType.ProtocolIEIDAMFUENGAPID, ignore},
+		{ngapType.ProtocolIEIDRANUENGAPID, ignore},
+		{ngapType.ProtocolIEIDIMSVoiceSupportIndicator, reject},
+	},
+	{ngapType.NGAPPDUPresentSuccessfulOutcome, ngapType.ProcedureCodeInitialContextSetup}: {
+		{ngapType.ProtocolIEIDAMFUENGAPID, ignore},
+		{ngapType.ProtocolIEIDRANUENGAPID, ignore},
+	},
+	{ngapType.NGAPPDUPresentSuccessfulOutcome, ngapType.ProcedureCodeUEContextModification}: {
+		{ngapType.ProtocolIEIDAMFUENGAPID, ignore},
+		{ngapType.ProtocolIEIDRANUENGAPID, ignore},
+	},
+	{ngapType.NGAPPDUPresentSuccessfulOutcome, ngapType.ProcedureCodePDUSessionResourceSetup}: {
+		{ngapType.ProtocolIEIDAMFUENGAPID, ignore},
+		{ngapType.ProtocolIEIDRANUENGAPID, ignore},
+	},
+	{ngapType.NGAPPDUPresentSuccessfulOutcome, ngapType.ProcedureCodePDUSessionResourceModify}: {
+		{ngapType.ProtocolIEIDAMFUENGAPID, ignore},
+		{ngapType.ProtocolIEIDRANUENGAPID, ignore},
+	},
+	{ngapType.NGAPPDUPresentSuccessfulOutcome, ngapType.ProcedureCodeHandoverResourceAllocation}: {
+		{ngapType.ProtocolIEIDAMFUENGAPID, ignore},
+		{ngapType.ProtocolIEIDRANUENGAPID, ignore},
+		{ngapType.ProtocolIEIDPDUSessionResourceAdmittedList, ignore},
+		{ngapType.ProtocolIEIDTargetToSourceTransparentContainer, reject},
+	},
+	{ngapType.NGAPPDUPresentSuccessfulOutcome, ngapType.ProcedureCodeWriteReplaceWarning}: {
+		{ngapType.ProtocolIEIDMessageIdentifier, reject},
+		{ngapType.ProtocolIEIDSerialNumber, reject},
+	},
+	{ngapType.NGAPPDUPresentSuccessfulOutcome, ngapType.ProcedureCodePWSCancel}: {
+		{ngapType.ProtocolIEIDMessageIdentifier, reject},
+		{ngapType.ProtocolIEIDSerialNumber, reject},
+	},
+	// unsuccessful outcomes
+	{ngapType.NGAPPDUPresentUnsuccessfulOutcome, ngapType.ProcedureCodeAMFConfigurationUpdate}: {
+		{ngapType.ProtocolIEIDCause, ignore},
+	},
+	{ngapType.NGAPPDUPresentUnsuccessfulOutcome, ngapType.ProcedureCodeInitialContextSetup}: {
+		{ngapType.ProtocolIEIDAMFUENGAPID, ignore},
+		{ngapType.ProtocolIEIDRANUENGAPID, ignore},
+		{ngapType.ProtocolIEIDCause, ignore},
+	},
+	{ngapType.NGAPPDUPresentUnsuccessfulOutcome, ngapType.ProcedureCodeUEContextModification}: {
+		{ngapType.ProtocolIEIDAMFUENGAPID, ignore},
+		{ngapType.ProtocolIEIDRANUENGAPID, ignore},
+		{ngapType.ProtocolIEIDCause, ignore},
+	},
+	// Handover Failure, which has no RAN UE NGAP ID since the target NG-RAN node did not allocate one
+	{ngapType.NGAPPDUPresentUnsuccessfulOutcome, ngapType.ProcedureCodeHandoverResourceAllocation}: {
+		{ngapType.ProtocolIEIDAMFUENGAPID, ignore},
+		{ngapType.ProtocolIEIDCause, ignore},
+	},
+}
+
+// receivedIE is an IE of a received message; an IE the decoder could not map to
+// a value is not comprehended
+type receivedIE struct {
+	id           int64
+	criticality  aper.Enumerated
+	comprehended bool
+}
+
+// validatePdu applies the abstract syntax error handling of TS 38.413 clause 10 to the
+// IEs of a received message, so that the handlers get the mandatory IEs they reject
+// the message without. It returns false if the message must not be handled, after
+// the unsuccessful outcome or the Error Indication required by the IE criticalities is sent.
+func validatePdu(ran *context.AmfRan, pdu *ngapType.NGAPPDU) bool {
+	var procedureCode int64
+	var procedureCriticality, triggeringMessage aper.Enumerated
+	var messageValue reflect.Value
+	switch pdu.Present {
+	case ngapType.NGAPPDUPresentInitiatingMessage:
+		if pdu.InitiatingMessage == nil {
+			return true
+		}
+		procedureCode = pdu.InitiatingMessage.ProcedureCode.Value
+		procedureCriticality = pdu.InitiatingMessage.Criticality.Value
+		triggeringMessage = ngapType.TriggeringMessagePresentInitiatingMessage
+		messageValue = reflect.ValueOf(pdu.InitiatingMessage.Value)
+	case ngapType.NGAPPDUPresentSuccessfulOutcome:
+		if pdu.SuccessfulOutcome == nil {
+			return true
+		}
+		procedureCode = pdu.SuccessfulOutcome.ProcedureCode.Value
+		procedureCriticality = pdu.SuccessfulOutcome.Criticality.Value
+		triggeringMessage = ngapType.TriggeringMessagePresentSuccessfulOutcome
+		messageValue = reflect.ValueOf(pdu.SuccessfulOutcome.Value)
+	case ngapType.NGAPPDUPresentUnsuccessfulOutcome:
+		if pdu.UnsuccessfulOutcome == nil {
+			return true
+		}
+		procedureCode = pdu.UnsuccessfulOutcome.ProcedureCode.Value
+		procedureCriticality = pdu.UnsuccessfulOutcome.Criticality.Value
+		triggeringMessage = ngapType.TriggeringMessagePresentUnsuccessfullOutcome
+		messageValue = reflect.ValueOf(pdu.UnsuccessfulOutcome.Value)
+	default:
+		return true
+	}
+
+	ies, ok := receivedIEsOf(messageValue)
+	if !ok {
+		return true
+	}
+
+	var rejected, notified []ngapType.CriticalityDiagnosticsIEItem
+	report := func(criticality aper.Enumerated, id int64, typeOfError aper.Enumerated) {
+		item := buildCriticalityDiagnosticsIEItem(criticality, id, typeOfError)
+		switch criticality {
+		case reject:
+			rejected = append(rejected, item)
+		case ignoreAndNotify:
+			notified = append(notified, item)
+		}
+	}
+
+	// TS 38.413 10.3.4.2 Not comprehended IE
+	for _, ie := range ies {
+		if !ie.comprehended {
+			Ngaplog.Warnf("Procedure[%d] IE[%d] is not comprehended", procedureCode, ie.id)
+			report(ie.criticality, ie.id, ngapType.TypeOfErrorPresentNotUnderstood)
+		}
+	}
+	// TS 38.413 10.3.5 Missing IE
+	for _, spec := range mandatoryIEs[messageKey{pdu.Present, procedureCode}] {
+		found := false
+		for _, ie := range ies {
+			if ie.id == spec.id {
+				found = true
+				break
+			}
+		}
+		if !found {
+			Ngaplog.Warnf("Procedure[%d] mandatory IE[%d] is missing", procedureCode, spec.id)
+			report(spec.criticality, spec.id, ngapType.TypeOfErrorPresentMissing)
+		}
+	}
+
+	if len(rejected) == 0 && len(notified) == 0 {
+		return true
+	}
+	criticalityDiagnostics := buildCriticalityDiagnostics(&procedureCode, &triggeringMessage, &procedureCriticality,
+		&ngapType.CriticalityDiagnosticsIEList{List: append(rejected, notified...)})
+	amfUeNgapID, ranUeNgapID := ueNgapIDsOf(messageValue)
+
+	if len(rejected) == 0 {
+		// ignore the IEs and notify the sender, the message is handled
+		cause := protocolCause(ngapType.CauseProtocolPresentAbstractSyntaxErrorIgnoreAndNotify)
+		ngap_message.SendErrorIndication(ran, amfUeNgapID, ranUeNgapID, &cause, &criticalityDiagnostics)
+		return true
+	}
+
+	if pdu.Present != ngapType.NGAPPDUPresentInitiatingMessage {
+		// the procedure is considered as unsuccessfully terminated, local error handling is logging it
+		Ngaplog.Errorf("Procedure[%d] is terminated for the response with abstract syntax error", procedureCode)
+		return false
+	}
+	cause := protocolCause(ngapType.CauseProtocolPresentAbstractSyntaxErrorReject)
+	rejectProcedure(ran, procedureCode, messageValue, cause, &criticalityDiagnostics)
+	return false
+}
+
+// rejectProcedure rejects a procedure initiated by the RAN with its unsuccessful outcome,
+// or with an Error Indication if the procedure has no unsuccessful outcome
+func rejectProcedure(ran *context.AmfRan, procedureCode int64, messageValue reflect.Value, cause ngapType.Cause,
+	criticalityDiagnostics *ngapType.CriticalityDiagnostics) {
+	Ngaplog.Errorf("Reject procedure[%d] for abstract syntax error", procedureCode)
+
+	amfUeNgapID, ranUeNgapID := ueNgapIDsOf(messageValue)
+	switch procedureCode {
+	case ngapType.ProcedureCodeNGSetup:
+		ngap_message.SendNGSetupFailure(ran, cause, nil, criticalityDiagnostics)
+		return
+	case ngapType.ProcedureCodeRANConfigurationUpdate:
+		ngap_message.SendRanConfigurationUpdateFailure(ran, cause, criticalityDiagnostics)
+		return
+	case ngapType.ProcedureCodePathSwitchRequest:
+		// the AMF UE NGAP ID is received in the Source AMF UE NGAP ID IE
+		if sourceAmfUeNgapID := sourceAmfUeNgapIDOf(messageValue); sourceAmfUeNgapID != nil && ranUeNgapID != nil {
+			ngap_message.SendPathSwitchRequestFailure(ran, *sourceAmfUeNgapID, *ranUeNgapID, nil,
+				criticalityDiagnostics)
+			return
+		}
+	case ngapType.ProcedureCodeHandoverPreparation:
+		if ranUeNgapID != nil {
+			if ranUe := ran.RanUeFindByRanUeNgapID(*ranUeNgapID); ranUe != nil && ranUe.AmfUe != nil {
+				ngap_message.SendHandoverPreparationFailure(ranUe, cause, criticalityDiagnostics)
+				return
+			}
+		}
+	}
+	ngap_message.SendErrorIndication(ran, amfUeNgapID, ranUeNgapID, &cause, criticalityDiagnostics)
+}
+
+// handleUnknownProcedure applies TS 38.413 10.3.4.1 to an initiating message of a
+// procedure the AMF does not comprehend
+func handleUnknownProcedure(ran *context.AmfRan, initiatingMessage *ngapType.InitiatingMessage) {
+	procedureCriticality := initiatingMessage.Criticality.Value
+	if procedureCriticality == ignore {
+		return
+	}
+	procedureCode := initiatingMessage.ProcedureCode.Value
+	triggeringMessage := ngapType.TriggeringMessagePresentInitiatingMessage
+	criticalityDiagnostics := buildCriticalityDiagnostics(&procedureCode, &triggeringMessage, &procedureCriticality,
+		nil)
+	cause := protocolCause(ngapType.CauseProtocolPresentAbstractSyntaxErrorIgnoreAndNotify)
+	if procedureCriticality == reject {
+		cause = protocolCause(ngapType.CauseProtocolPresentAbstractSyntaxErrorReject)
+	}
+	amfUeNgapID, ranUeNgapID := ueNgapIDsOf(reflect.ValueOf(initiatingMessage.Value))
+	ngap_message.SendErrorIndication(ran, amfUeNgapID, ranUeNgapID, &cause, &criticalityDiagnostics)
+}
+
+func protocolCause(value aper.Enumerated) ngapType.Cause {
+	return ngapType.Cause{
+		Present: ngapType.CausePresentProtocol,
+		Protocol: &ngapType.CauseProtocol{
+			Value: value,
+		},
+	}
+}
+
+// receivedIEsOf returns the IEs of the message held by an InitiatingMessageValue,
+// SuccessfulOutcomeValue or UnsuccessfulOutcomeValue
+func receivedIEsOf(messageValue reflect.Value) (ies []receivedIE, ok bool) {
+	list, ok := protocolIEListOf(messageValue)
+	if !ok {
+		return nil, false
+	}
+
+	for i := 0; i < list.Len(); i++ {
+		ie := list.Index(i)
+		id, criticality, value := ie.FieldByName("Id"), ie.FieldByName("Criticality"), ie.FieldByName("Value")
+		if !id.IsValid() || !criticality.IsValid() || !value.IsValid() {
+			continue
+		}
+		receivedIE := receivedIE{
+			id:          id.FieldByName("Value").Int(),
+			criticality: aper.Enumerated(criticality.FieldByName("Value").Uint()),
+		}
+		if present := value.FieldByName("Present"); present.IsValid() && present.Int() != 0 {
+			for j := 0; j < value.NumField(); j++ {
+				if field := value.Field(j); field.Kind() == reflect.Ptr && !field.IsNil() {
+					receivedIE.comprehended = true
+					break
+				}
+			}
+		}
+		ies = append(ies, receivedIE)
+	}
+	return ies, true
+}
+
+func sourceAmfUeNgapIDOf(messageValue reflect.Value) *int64 {
+	list, ok := protocolIEListOf(messageValue)
+	if !ok {
+		return nil
+	}
+	for i := 0; i < list.Len(); i++ {
+		ieValue := list.Index(i).FieldByName("Value")
+		if !ieValue.IsValid() {
+			continue
+		}
+		if id := ieValue.FieldByName("SourceAMFUENGAPID"); id.IsValid() && !id.IsNil() {
+			value := id.Elem().FieldByName("Value").Int()
+			return &value
+		}
+	}
+	return nil
+}
@@ -0,0 +1,256 @@
+package ngap
+
+import (
+	"free5gc/lib/aper"
+	libngap "free5gc/lib/ngap"
+	"free5gc/lib/ngap/ngapType"
+	"free5gc/src/amf/context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestRan returns a RAN whose NGAP messages are written to the returned connection
+func newTestRan() (*context.AmfRan, net.Conn) {
+	amfConn, ranConn := net.Pipe()
+	return &context.AmfRan{Name: "test", Conn: amfConn}, ranConn
+}
+
+// readPdu returns the next NGAP message written to the RAN, or nil if there is none
+func readPdu(t *testing.T, ranConn net.Conn) *ngapType.NGAPPDU {
+	require.NoError(t, ranConn.SetReadDeadline(time.Now().Add(100*time.Millisecond)))
+	buf := make([]byte, 4096)
+	n, err := ranConn.Read(buf)
+	if err != nil {
+		return nil
+	}
+	pdu, err := libngap.Decoder(buf[:n])
+	require.NoError(t, err)
+	return pdu
+}
+
+func ueContextReleaseRequestIE(id int64, criticality aper.Enumerated) ngapType.UEContextReleaseRequestIEs {
+	ie := ngapType.UEContextReleaseRequestIEs{}
+	ie.Id.Value = id
+	ie.Criticality.Value = criticality
+	switch id {
+	case ngapType.ProtocolIEIDAMFUENGAPID:
+		ie.Value.Present = ngapType.UEContextReleaseRequestIEsPresentAMFUENGAPID
+		ie.Value.AMFUENGAPID = &ngapType.AMFUENGAPID{Value: 1}
+	case ngapType.ProtocolIEIDRANUENGAPID:
+		ie.Value.Present = ngapType.UEContextReleaseRequestIEsPresentRANUENGAPID
+		ie.Value.RANUENGAPID = &ngapType.RANUENGAPID{Value: 2}
+	case ngapType.ProtocolIEIDCause:
+		ie.Value.Present = ngapType.UEContextReleaseRequestIEsPresentCause
+		ie.Value.Cause = &ngapType.Cause{
+			Present:      ngapType.CausePresentRadioNetwork,
+			RadioNetwork: &ngapType.CauseRadioNetwork{Value: ngapType.CauseRadioNetworkPresentUserInactivity},
+		}
+	}
+	// the value of any other IE is not comprehended
+	return ie
+}
+
+func ueContextReleaseRequest(ies ...ngapType.UEContextReleaseRequestIEs) *ngapType.NGAPPDU {
+	pdu := &ngapType.NGAPPDU{
+		Present:           ngapType.NGAPPDUPresentInitiatingMessage,
+		InitiatingMessage: new(ngapType.InitiatingMessage),
+	}
+	initiatingMessage := pdu.InitiatingMessage
+	initiatingMessage.ProcedureCode.Value = ngapType.ProcedureCodeUEContextReleaseRequest
+	initiatingMessage.Criticality.Value = ignore
+	initiatingMessage.Value.Present = ngapType.InitiatingMessagePresentUEContextReleaseRequest
+	initiatingMessage.Value.UEContextReleaseRequest = new(ngapType.UEContextReleaseRequest)
+	initiatingMessage.Value.UEContextReleaseRequest.ProtocolIEs.List = ies
+	return pdu
+}
+
+func handoverFailure(ids ...int64) *ngapType.NGAPPDU {
+	pdu := &ngapType.NGAPPDU{
+		Present:             ngapType.NGAPPDUPresentUnsuccessfulOutcome,
+		UnsuccessfulOutcome: new(ngapType.UnsuccessfulOutcome),
+	}
+	unsuccessfulOutcome := pdu.UnsuccessfulOutcome
+	unsuccessfulOutcome.ProcedureCode.Value = ngapType.ProcedureCodeHandoverResourceAllocation
+	unsuccessfulOutcome.Criticality.Value = reject
+	unsuccessfulOutcome.Value.Present = ngapType.UnsuccessfulOutcomePresentHandoverFailure
+	unsuccessfulOutcome.Value.HandoverFailure = new(ngapType.HandoverFailure)
+	for _, id := range ids {
+		ie := ngapType.HandoverFailureIEs{}
+		ie.Id.Value = id
+		ie.Criticality.Value = ignore
+		switch id {
+		case ngapType.ProtocolIEIDAMFUENGAPID:
+			ie.Value.Present = ngapType.HandoverFailureIEsPresentAMFUENGAPID
+			ie.Value.AMFUENGAPID = &ngapType.AMFUENGAPID{Value: 1}
+		case ngapType.ProtocolIEIDCause:
+			ie.Value.Present = ngapType.HandoverFailureIEsPresentCause
+			ie.Value.Cause = &ngapType.Cause{
+				Present:      ngapType.CausePresentRadioNetwork,
+				RadioNetwork: &ngapType.CauseRadioNetwork{Value: ngapType.CauseRadioNetworkPresentUnspecified},
+			}
+		}
+		unsuccessfulOutcome.Value.HandoverFailure.ProtocolIEs.List = append(
+			unsuccessfulOutcome.Value.HandoverFailure.ProtocolIEs.List, ie)
+	}
+	return pdu
+}
+
+func TestValidatePdu(t *testing.T) {
+	amfUeNgapID := ueContextReleaseRequestIE(ngapType.ProtocolIEIDAMFUENGAPID, reject)
+	ranUeNgapID := ueContextReleaseRequestIE(ngapType.ProtocolIEIDRANUENGAPID, reject)
+	cause := ueContextReleaseRequestIE(ngapType.ProtocolIEIDCause, ignore)
+
+	testCases := []struct {
+		name    string
+		pdu     *ngapType.NGAPPDU
+		handled bool
+		// the Error Indication sent with its protocol cause, and the IE reported in its criticality diagnostics
+		errorIndication bool
+		errorCause      aper.Enumerated
+		reportedIE      int64
+		typeOfError     aper.Enumerated
+	}{
+		{
+			name:    "all mandatory IEs",
+			pdu:     ueContextReleaseRequest(amfUeNgapID, ranUeNgapID, cause),
+			handled: true,
+		},
+		{
+			name:    "missing IE with ignore criticality",
+			pdu:     ueContextReleaseRequest(amfUeNgapID, ranUeNgapID),
+			handled: true,
+		},
+		{
+			name:            "missing IE with reject criticality",
+			pdu:             ueContextReleaseRequest(amfUeNgapID, cause),
+			handled:         false,
+			errorIndication: true,
+			errorCause:      ngapType.CauseProtocolPresentAbstractSyntaxErrorReject,
+			reportedIE:      ngapType.ProtocolIEIDRANUENGAPID,
+			typeOfError:     ngapType.TypeOfErrorPresentMissing,
+		},
+		{
+			name: "not comprehended IE with ignore and notify criticality",
+			pdu: ueContextReleaseRequest(amfUeNgapID, ranUeNgapID, cause,
+				ueContextReleaseRequestIE(ngapType.ProtocolIEIDUserLocationInformation, ignoreAndNotify)),
+			handled:         true,
+			errorIndication: true,
+			errorCause:      ngapType.CauseProtocolPresentAbstractSyntaxErrorIgnoreAndNotify,
+			reportedIE:      ngapType.ProtocolIEIDUserLocationInformation,
+			typeOfError:     ngapType.TypeOfErrorPresentNotUnderstood,
+		},
+		{
+			name: "not comprehended IE with ignore criticality",
+			pdu: ueContextReleaseRequest(amfUeNgapID, ranUeNgapID, cause,
+				ueContextReleaseRequestIE(ngapType.ProtocolIEIDUserLocationInformation, ignore)),
+			handled: true,
+		},
+		{
+			name: "not comprehended IE with reject criticality",
+			pdu: ueContextReleaseRequest(amfUeNgapID, ranUeNgapID, cause,
+				ueContextReleaseRequestIE(ngapType.ProtocolIEIDUserLocationInformation, reject)),
+			handled:         false,
+			errorIndication: true,
+			errorCause:      ngapType.CauseProtocolPresentAbstractSyntaxErrorReject,
+			reportedIE:      ngapType.ProtocolIEIDUserLocationInformation,
+			typeOfError:     ngapType.TypeOfErrorPresentNotUnderstood,
+		},
+		{
+			name:    "handover failure with all mandatory IEs",
+			pdu:     handoverFailure(ngapType.ProtocolIEIDAMFUENGAPID, ngapType.ProtocolIEIDCause),
+			handled: true,
+		},
+		{
+			name:    "handover failure without cause",
+			pdu:     handoverFailure(ngapType.ProtocolIEIDAMFUENGAPID),
+			handled: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ran, ranConn := newTestRan()
+			defer ranConn.Close()
+			defer ran.Conn.Close()
+			assert.Equal(t, tc.handled, validatePdu(ran, tc.pdu))
+
+			pdu := readPdu(t, ranConn)
+			if !tc.errorIndication {
+				assert.Nil(t, pdu)
+				return
+			}
+			require.NotNil(t, pdu)
+			require.Equal(t, ngapType.NGAPPDUPresentInitiatingMessage, pdu.Present)
+			errorIndication := pdu.InitiatingMessage.Value.ErrorIndication
+			require.NotNil(t, errorIndication)
+
+			var errorCause *ngapType.Cause
+			var criticalityDiagnostics *ngapType.CriticalityDiagnostics
+			for _, ie := range errorIndication.ProtocolIEs.List {
+				switch ie.Id.Value {
+				case ngapType.ProtocolIEIDCause:
+					errorCause = ie.Value.Cause
+				case ngapType.ProtocolIEIDCriticalityDiagnostics:
+					criticalityDiagnostics = ie.Value.CriticalityDiagnostics
+				}
+			}
+			require.NotNil(t, errorCause)
+			require.Equal(t, ngapType.CausePresentProtocol, errorCause.Present)
+			assert.Equal(t, tc.errorCause, errorCause.Protocol.Value)
+			require.NotNil(t, criticalityDiagnostics)
+			require.NotNil(t, criticalityDiagnostics.IEsCriticalityDiagnostics)
+			items := criticalityDiagnostics.IEsCriticalityDiagnostics.List
+			require.Len(t, items, 1)
+			assert.Equal(t, tc.reportedIE, items[0].IEID.Value)
+			assert.Equal(t, tc.typeOfError, items[0].TypeOfError.Value)
+		})
+	}
+}
+
+func TestMandatoryIEsOfReceivedMessages(t *testing.T) {
+	testCases := []struct {
+		name string
+		key  messageKey
+		ies  []ieSpec
+	}{
+		{
+			name: "Secondary RAT Data Usage Report",
+			key: messageKey{ngapType.NGAPPDUPresentInitiatingMessage,
+				ngapType.ProcedureCodeSecondaryRATDataUsageReport},
+			ies: []ieSpec{
+				{ngapType.ProtocolIEIDAMFUENGAPID, reject},
+				{ngapType.ProtocolIEIDRANUENGAPID, reject},
+				{ngapType.ProtocolIEIDPDUSessionResourceSecondaryRATUsageList, ignore},
+			},
+		},
+		{
+			name: "Trace Failure Indication",
+			key:  messageKey{ngapType.NGAPPDUPresentInitiatingMessage, ngapType.ProcedureCodeTraceFailureIndication},
+			ies: []ieSpec{
+				{ngapType.ProtocolIEIDAMFUENGAPID, reject},
+				{ngapType.ProtocolIEIDRANUENGAPID, reject},
+				{ngapType.ProtocolIEIDNGRANTraceID, ignore},
+				{ngapType.ProtocolIEIDCause, ignore},
+			},
+		},
+		{
+			name: "Handover Failure",
+			key: messageKey{ngapType.NGAPPDUPresentUnsuccessfulOutcome,
+				ngapType.ProcedureCodeHandoverResourceAllocation},
+			ies: []ieSpec{
+				{ngapType.ProtocolIEIDAMFUENGAPID, ignore},
+				{ngapType.ProtocolIEIDCause, ignore},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.ies, mandatoryIEs[tc.key])
+		})
+	}
+}
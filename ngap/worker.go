@@ -0,0 +1,409 @@
+package ngap
+
+import (
+	"free5gc/lib/ngap/ngapType"
+	"free5gc/src/amf/context"
+	ngap_message "free5gc/src/amf/ngap/message"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultUeQueueSize  = 64
+	defaultRanQueueSize = 256
+	// how long an NGAP message waits for room in a full worker queue before it is rejected
+	queueWaitTimeout = 2 * time.Second
+)
+
+// DispatcherStatistics is a snapshot of the NGAP dispatcher state
+type DispatcherStatistics struct {
+	UeWorkers         int    `json:"ueWorkers"`
+	RanWorkers        int    `json:"ranWorkers"`
+	QueuedMessages    int64  `json:"queuedMessages"`
+	MaxQueueDepth     int    `json:"maxQueueDepth"`
+	ProcessedMessages uint64 `json:"processedMessages"`
+	RejectedMessages  uint64 `json:"rejectedMessages"`
+}
+
+// ueWorkerKey identifies the worker of a UE-associated logical NG connection.
+// RAN UE NGAP ID is preferred because it is present in every uplink UE-associated
+// message, including Initial UE Message; AMF UE NGAP ID is the fallback.
+type ueWorkerKey struct {
+	ran         *context.AmfRan
+	ranUeNgapID int64
+	amfUeNgapID int64
+}
+
+type ranWorkerKey struct {
+	ran *context.AmfRan
+}
+
+type worker struct {
+	key   interface{}
+	queue chan func()
+	isUe  bool
+	// submitters about to send to the queue; the worker is not retired while there are some
+	pending int
+	// signalled when a submitter is done, so an idle worker checks again whether it may retire
+	wake chan struct{}
+}
+
+// dispatcher runs UE-associated NGAP messages on ordered per-UE workers and
+// non-UE-associated messages on one serial worker per RAN. Workers are started
+// on demand and exit once their queue is drained. A full queue holds the submitter
+// back, which stops reading the NG connection, and a message which still finds the
+// queue full after queueWaitTimeout is rejected.
+type dispatcher struct {
+	mu           sync.Mutex
+	workers      map[interface{}]*worker
+	ueQueueSize  int
+	ranQueueSize int
+
+	queued    int64
+	processed uint64
+	rejected  uint64
+}
+
+var ngapDispatcher = newDispatcher(defaultUeQueueSize, defaultRanQueueSize)
+
+func newDispatcher(ueQueueSize, ranQueueSize int) *dispatcher {
+	return &dispatcher{
+		workers:      make(map[interface{}]*worker),
+		ueQueueSize:  ueQueueSize,
+		ranQueueSize: ranQueueSize,
+	}
+}
+
+// SetDispatcherQueueSize sets the queue length of per-UE and per-RAN workers
+// started from now on; it is meant to be called before the NGAP server starts
+func SetDispatcherQueueSize(ueQueueSize, ranQueueSize int) {
+	ngapDispatcher.mu.Lock()
+	defer ngapDispatcher.mu.Unlock()
+	if ueQueueSize > 0 {
+		ngapDispatcher.ueQueueSize = ueQueueSize
+	}
+	if ranQueueSize > 0 {
+		ngapDispatcher.ranQueueSize = ranQueueSize
+	}
+}
+
+// GetDispatcherStatistics returns the current worker count, queue depth and message counters
+func GetDispatcherStatistics() DispatcherStatistics {
+	return ngapDispatcher.statistics()
+}
+
+func (d *dispatcher) statistics() DispatcherStatistics {
+	stats := DispatcherStatistics{
+		QueuedMessages:    atomic.LoadInt64(&d.queued),
+		ProcessedMessages: atomic.LoadUint64(&d.processed),
+		RejectedMessages:  atomic.LoadUint64(&d.rejected),
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, w := range d.workers {
+		if w.isUe {
+			stats.UeWorkers++
+		} else {
+			stats.RanWorkers++
+		}
+		if depth := len(w.queue); depth > stats.MaxQueueDepth {
+			stats.MaxQueueDepth = depth
+		}
+	}
+	return stats
+}
+
+func (d *dispatcher) enqueue(ran *context.AmfRan, pdu *ngapType.NGAPPDU) {
+	if key, ok := ueWorkerKeyOf(ran, pdu); ok {
+		if !d.submit(key, true, func() { dispatchUePdu(ran, pdu) }, queueWaitTimeout) {
+			d.reject(ran, pdu)
+		}
+	} else {
+		if !d.submit(ranWorkerKey{ran: ran}, false, func() { dispatchPdu(ran, pdu) }, queueWaitTimeout) {
+			d.reject(ran, pdu)
+		}
+	}
+}
+
+// enqueueRanJob runs job on the serial worker of the RAN after the messages already
+// queued there; unlike NGAP messages, the job waits as long as the queue is full
+func (d *dispatcher) enqueueRanJob(ran *context.AmfRan, job func()) {
+	d.submit(ranWorkerKey{ran: ran}, false, job, 0)
+}
+
+// enqueueUeJob runs job on the worker of the N2 connection of ranUe after the messages
+// already queued there, with the AmfUe of ranUe locked; the job waits as long as the queue is full
+func (d *dispatcher) enqueueUeJob(ranUe *context.RanUe, job func()) {
+	key := ueWorkerKey{ran: ranUe.Ran, ranUeNgapID: ranUe.RanUeNgapId}
+	d.submit(key, true, func() {
+		if amfUe := ranUe.AmfUe; amfUe != nil {
+			amfUe.Lock()
+			defer amfUe.Unlock()
+		}
+		job()
+	}, 0)
+}
+
+// removeRanUe removes the N2 connection of a UE on its worker, without signalling towards the RAN
+func removeRanUe(ranUe *context.RanUe) {
+	ngapDispatcher.enqueueUeJob(ranUe, func() {
+		if err := ranUe.Remove(); err != nil {
+			Ngaplog.Errorln(err.Error())
+		}
+	})
+}
+
+// reject answers an NGAP message which found its worker queue full with an Error Indication,
+// and starts the overload in the RANs
+func (d *dispatcher) reject(ran *context.AmfRan, pdu *ngapType.NGAPPDU) {
+	atomic.AddUint64(&d.rejected, 1)
+	Ngaplog.Warnf("NGAP worker queue of RAN[ID: %+v] is full, reject the message", ran.RanId)
+
+	var amfUeNgapID, ranUeNgapID *int64
+	if value, ok := messageValueOf(pdu); ok {
+		amfUeNgapID, ranUeNgapID = ueNgapIDsOf(value)
+	}
+	cause := ngapType.Cause{
+		Present: ngapType.CausePresentMisc,
+		Misc: &ngapType.CauseMisc{
+			Value: ngapType.CauseMiscPresentControlProcessingOverload,
+		},
+	}
+	ngap_message.SendErrorIndication(ran, amfUeNgapID, ranUeNgapID, &cause, nil)
+	startOverloadOnCongestion()
+}
+
+// submit queues job on the worker of key, which is started if needed. When the queue is
+// full, submit waits for room up to timeout, or as long as needed if timeout is 0; it
+// returns false if the job is not queued.
+func (d *dispatcher) submit(key interface{}, isUe bool, job func(), timeout time.Duration) bool {
+	d.mu.Lock()
+	w, ok := d.workers[key]
+	if !ok {
+		queueSize := d.ranQueueSize
+		if isUe {
+			queueSize = d.ueQueueSize
+		}
+		w = &worker{
+			key:   key,
+			queue: make(chan func(), queueSize),
+			isUe:  isUe,
+			wake:  make(chan struct{}, 1),
+		}
+		d.workers[key] = w
+		go d.run(w)
+	}
+	w.pending++
+	d.mu.Unlock()
+
+	atomic.AddInt64(&d.queued, 1)
+	queued := true
+	select {
+	case w.queue <- job:
+	default:
+		if timeout == 0 {
+			w.queue <- job
+			break
+		}
+		timer := time.NewTimer(timeout)
+		select {
+		case w.queue <- job:
+		case <-timer.C:
+			// the queue may have been drained just now, which would leave the worker
+			// waiting for this job
+			select {
+			case w.queue <- job:
+			default:
+				queued = false
+			}
+		}
+		timer.Stop()
+	}
+	if !queued {
+		atomic.AddInt64(&d.queued, -1)
+	}
+
+	d.mu.Lock()
+	w.pending--
+	d.mu.Unlock()
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+	return queued
+}
+
+func (d *dispatcher) run(w *worker) {
+	for {
+		// submit() registers as pending under the same lock before it sends, so a worker
+		// seen idle here cannot receive a job after it is unregistered; a worker which waits
+		// for a pending submitter is woken up once the submitter is done
+		d.mu.Lock()
+		if len(w.queue) == 0 && w.pending == 0 {
+			delete(d.workers, w.key)
+			d.mu.Unlock()
+			return
+		}
+		d.mu.Unlock()
+
+		select {
+		case job := <-w.queue:
+			atomic.AddInt64(&d.queued, -1)
+			job()
+			atomic.AddUint64(&d.processed, 1)
+		case <-w.wake:
+		}
+	}
+}
+
+// dispatchUePdu runs the handler of a UE-associated NGAP PDU with the AmfUe of the PDU locked,
+// as the AmfUe may be handled at the same time by the workers of its other N2 connections
+func dispatchUePdu(ran *context.AmfRan, pdu *ngapType.NGAPPDU) {
+	if amfUe := amfUeOf(ran, pdu); amfUe != nil {
+		amfUe.Lock()
+		defer amfUe.Unlock()
+	}
+	dispatchPdu(ran, pdu)
+}
+
+// amfUeOf returns the AmfUe of the N2 connection of a UE-associated NGAP PDU, if it is known
+// yet. The AMF UE NGAP ID is preferred, as it also identifies the UE in a Path Switch Request
+// sent by the target RAN.
+func amfUeOf(ran *context.AmfRan, pdu *ngapType.NGAPPDU) *context.AmfUe {
+	value, ok := messageValueOf(pdu)
+	if !ok {
+		return nil
+	}
+	amfUeNgapID, ranUeNgapID := ueNgapIDsOf(value)
+	var ranUe *context.RanUe
+	if amfUeNgapID != nil {
+		ranUe = context.AMF_Self().RanUeFindByAmfUeNgapID(*amfUeNgapID)
+	}
+	if ranUe == nil && ranUeNgapID != nil {
+		ranUe = ran.RanUeFindByRanUeNgapID(*ranUeNgapID)
+	}
+	if ranUe == nil {
+		return nil
+	}
+	return ranUe.AmfUe
+}
+
+// messageValueOf returns the InitiatingMessageValue, SuccessfulOutcomeValue or
+// UnsuccessfulOutcomeValue of an NGAP PDU
+func messageValueOf(pdu *ngapType.NGAPPDU) (value reflect.Value, ok bool) {
+	switch pdu.Present {
+	case ngapType.NGAPPDUPresentInitiatingMessage:
+		if pdu.InitiatingMessage == nil {
+			return value, false
+		}
+		return reflect.ValueOf(pdu.InitiatingMessage.Value), true
+	case ngapType.NGAPPDUPresentSuccessfulOutcome:
+		if pdu.SuccessfulOutcome == nil {
+			return value, false
+		}
+		return reflect.ValueOf(pdu.SuccessfulOutcome.Value), true
+	case ngapType.NGAPPDUPresentUnsuccessfulOutcome:
+		if pdu.UnsuccessfulOutcome == nil {
+			return value, false
+		}
+		return reflect.ValueOf(pdu.UnsuccessfulOutcome.Value), true
+	}
+	return value, false
+}
+
+// ueWorkerKeyOf returns the per-UE worker key of a UE-associated NGAP message;
+// ok is false for non-UE-associated procedures, which are serialized per RAN
+func ueWorkerKeyOf(ran *context.AmfRan, pdu *ngapType.NGAPPDU) (key ueWorkerKey, ok bool) {
+	var value reflect.Value
+	switch pdu.Present {
+	case ngapType.NGAPPDUPresentInitiatingMessage:
+		if pdu.InitiatingMessage == nil {
+			return key, false
+		}
+		switch pdu.InitiatingMessage.ProcedureCode.Value {
+		case ngapType.ProcedureCodeNGSetup, ngapType.ProcedureCodeNGReset,
+			ngapType.ProcedureCodeRANConfigurationUpdate:
+			return key, false
+		}
+		value = reflect.ValueOf(pdu.InitiatingMessage.Value)
+	case ngapType.NGAPPDUPresentSuccessfulOutcome:
+		if pdu.SuccessfulOutcome == nil {
+			return key, false
+		}
+		if pdu.SuccessfulOutcome.ProcedureCode.Value == ngapType.ProcedureCodeNGReset {
+			return key, false
+		}
+		value = reflect.ValueOf(pdu.SuccessfulOutcome.Value)
+	case ngapType.NGAPPDUPresentUnsuccessfulOutcome:
+		if pdu.UnsuccessfulOutcome == nil {
+			return key, false
+		}
+		value = reflect.ValueOf(pdu.UnsuccessfulOutcome.Value)
+	default:
+		return key, false
+	}
+
+	amfUeNgapID, ranUeNgapID := ueNgapIDsOf(value)
+	switch {
+	case ranUeNgapID != nil:
+		return ueWorkerKey{ran: ran, ranUeNgapID: *ranUeNgapID}, true
+	case amfUeNgapID != nil:
+		return ueWorkerKey{ran: ran, amfUeNgapID: *amfUeNgapID}, true
+	default:
+		return key, false
+	}
+}
+
+// ueNgapIDsOf looks up the AMF UE NGAP ID and RAN UE NGAP ID IEs of the message
+// held by an InitiatingMessageValue, SuccessfulOutcomeValue or UnsuccessfulOutcomeValue
+func ueNgapIDsOf(messageValue reflect.Value) (amfUeNgapID, ranUeNgapID *int64) {
+	list, ok := protocolIEListOf(messageValue)
+	if !ok {
+		return nil, nil
+	}
+
+	for i := 0; i < list.Len(); i++ {
+		ieValue := list.Index(i).FieldByName("Value")
+		if !ieValue.IsValid() {
+			continue
+		}
+		if id := ieValue.FieldByName("AMFUENGAPID"); id.IsValid() && !id.IsNil() {
+			value := id.Elem().FieldByName("Value").Int()
+			amfUeNgapID = &value
+		}
+		if id := ieValue.FieldByName("RANUENGAPID"); id.IsValid() && !id.IsNil() {
+			value := id.Elem().FieldByName("Value").Int()
+			ranUeNgapID = &value
+		}
+	}
+	return amfUeNgapID, ranUeNgapID
+}
+
+// protocolIEListOf returns the ProtocolIEs.List slice of the message held by an
+// InitiatingMessageValue, SuccessfulOutcomeValue or UnsuccessfulOutcomeValue
+func protocolIEListOf(messageValue reflect.Value) (list reflect.Value, ok bool) {
+	var message reflect.Value
+	for i := 0; i < messageValue.NumField(); i++ {
+		field := messageValue.Field(i)
+		if field.Kind() == reflect.Ptr && !field.IsNil() {
+			message = field.Elem()
+			break
+		}
+	}
+	if !message.IsValid() || message.Kind() != reflect.Struct {
+		return list, false
+	}
+
+	protocolIEs := message.FieldByName("ProtocolIEs")
+	if !protocolIEs.IsValid() {
+		return list, false
+	}
+	list = protocolIEs.FieldByName("List")
+	if !list.IsValid() || list.Kind() != reflect.Slice {
+		return list, false
+	}
+	return list, true
+}
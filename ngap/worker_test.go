@@ -0,0 +1,110 @@
+package ngap
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// waitForRetirement waits until all the workers of d exited
+func waitForRetirement(t *testing.T, d *dispatcher) {
+	for i := 0; i < 100; i++ {
+		d.mu.Lock()
+		numOfWorkers := len(d.workers)
+		d.mu.Unlock()
+		if numOfWorkers == 0 {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("workers are not retired")
+}
+
+func TestDispatcherOrdering(t *testing.T) {
+	d := newDispatcher(4, 4)
+
+	var mutex sync.Mutex
+	handled := make(map[string][]int)
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		for _, key := range []string{"ue1", "ue2"} {
+			i, key := i, key
+			wg.Add(1)
+			require.True(t, d.submit(key, true, func() {
+				defer wg.Done()
+				mutex.Lock()
+				handled[key] = append(handled[key], i)
+				mutex.Unlock()
+			}, 0))
+		}
+	}
+	wg.Wait()
+
+	for _, key := range []string{"ue1", "ue2"} {
+		require.Len(t, handled[key], 100)
+		for i, value := range handled[key] {
+			assert.Equal(t, i, value, "job order of %s", key)
+		}
+	}
+	waitForRetirement(t, d)
+	assert.Equal(t, uint64(200), d.statistics().ProcessedMessages)
+}
+
+func TestDispatcherFullQueue(t *testing.T) {
+	d := newDispatcher(1, 1)
+
+	release := make(chan struct{})
+	started := make(chan struct{})
+	require.True(t, d.submit("ue", true, func() {
+		close(started)
+		<-release
+	}, 0))
+	<-started
+	// the queue holds one job while the worker is busy
+	require.True(t, d.submit("ue", true, func() {}, 0))
+
+	// a message is rejected once it waited for the timeout
+	begin := time.Now()
+	assert.False(t, d.submit("ue", true, func() {}, 50*time.Millisecond))
+	assert.True(t, time.Since(begin) >= 50*time.Millisecond)
+
+	// a job without timeout waits until the worker makes room
+	queued := make(chan bool)
+	go func() {
+		queued <- d.submit("ue", true, func() {}, 0)
+	}()
+	select {
+	case <-queued:
+		t.Fatal("job queued in a full queue")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(release)
+	assert.True(t, <-queued)
+
+	waitForRetirement(t, d)
+	stats := d.statistics()
+	assert.Equal(t, uint64(3), stats.ProcessedMessages)
+	assert.Equal(t, int64(0), stats.QueuedMessages)
+}
+
+func TestDispatcherWorkerRetirement(t *testing.T) {
+	d := newDispatcher(4, 4)
+
+	done := make(chan struct{})
+	require.True(t, d.submit("ran", false, func() { close(done) }, 0))
+	<-done
+	waitForRetirement(t, d)
+
+	// a retired worker is started again for the next job of its key
+	done = make(chan struct{})
+	require.True(t, d.submit("ran", false, func() { close(done) }, 0))
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("job of a retired worker is not handled")
+	}
+	waitForRetirement(t, d)
+}
@@ -0,0 +1,29 @@
+package oam
+
+import (
+	"free5gc/lib/openapi"
+	"free5gc/lib/openapi/models"
+	"free5gc/src/amf/logger"
+	"free5gc/src/amf/ngap"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+func HTTPNgapDispatcherStatistics(c *gin.Context) {
+	setCorsHeader(c)
+
+	stats := ngap.GetDispatcherStatistics()
+
+	responseBody, err := openapi.Serialize(stats, "application/json")
+	if err != nil {
+		logger.NgapLog.Errorln(err)
+		problemDetails := models.ProblemDetails{
+			Status: http.StatusInternalServerError,
+			Cause:  "SYSTEM_FAILURE",
+			Detail: err.Error(),
+		}
+		c.JSON(http.StatusInternalServerError, problemDetails)
+	} else {
+		c.Data(http.StatusOK, "application/json", responseBody)
+	}
+}
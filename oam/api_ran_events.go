@@ -0,0 +1,32 @@
+package oam
+
+import (
+	"free5gc/lib/http_wrapper"
+	"free5gc/lib/openapi"
+	"free5gc/lib/openapi/models"
+	"free5gc/src/amf/logger"
+	"free5gc/src/amf/producer"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+func HTTPRanEvents(c *gin.Context) {
+	setCorsHeader(c)
+
+	req := http_wrapper.NewRequest(c.Request, nil)
+
+	rsp := producer.HandleOAMRanEvents(req)
+
+	responseBody, err := openapi.Serialize(rsp.Body, "application/json")
+	if err != nil {
+		logger.MtLog.Errorln(err)
+		problemDetails := models.ProblemDetails{
+			Status: http.StatusInternalServerError,
+			Cause:  "SYSTEM_FAILURE",
+			Detail: err.Error(),
+		}
+		c.JSON(http.StatusInternalServerError, problemDetails)
+	} else {
+		c.Data(rsp.Status, "application/json", responseBody)
+	}
+}
@@ -80,4 +80,25 @@ var routes = Routes{
 		"/registered-ue-context/:supi",
 		HTTPRegisteredUEContext,
 	},
+
+	{
+		"NGAP Dispatcher Statistics",
+		"GET",
+		"/ngap-dispatcher-statistics",
+		HTTPNgapDispatcherStatistics,
+	},
+
+	{
+		"RAN Events",
+		"GET",
+		"/ran-events",
+		HTTPRanEvents,
+	},
+
+	{
+		"RAN Send Statistics",
+		"GET",
+		"/ran-send-statistics",
+		HTTPRanSendStatistics,
+	},
 }
@@ -14,6 +14,7 @@ import (
 	ngap_message "free5gc/src/amf/ngap/message"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/mohae/deepcopy"
 )
@@ -221,6 +222,49 @@ func AmPolicyControlUpdateNotifyTerminateProcedure(polAssoID string,
 	return nil
 }
 
+// TS 29.525 5.6.2.5
+func HandleUePolicyControlNotifyTerminate(request *http_wrapper.Request) *http_wrapper.Response {
+	logger.ProducerLog.Infoln("Handle UE Policy Control Notify [Request for termination of the policy association]")
+
+	polAssoID := request.Params["polAssoId"]
+	terminationNotification := request.Body.(models.TerminationNotification)
+
+	problemDetails := UePolicyControlNotifyTerminateProcedure(polAssoID, terminationNotification)
+	if problemDetails != nil {
+		return http_wrapper.NewResponse(int(problemDetails.Status), nil, problemDetails)
+	} else {
+		return http_wrapper.NewResponse(http.StatusNoContent, nil, nil)
+	}
+}
+
+func UePolicyControlNotifyTerminateProcedure(polAssoID string,
+	terminationNotification models.TerminationNotification) *models.ProblemDetails {
+	amfSelf := context.AMF_Self()
+
+	ue, ok := amfSelf.AmfUeFindByUePolicyAssociationID(polAssoID)
+	if !ok {
+		problemDetails := &models.ProblemDetails{
+			Status: http.StatusNotFound,
+			Cause:  "CONTEXT_NOT_FOUND",
+			Detail: fmt.Sprintf("UE Policy Association ID[%s] Not Found", polAssoID),
+		}
+		return problemDetails
+	}
+
+	logger.CallbackLog.Infof("Cause of UE Policy termination[%+v]", terminationNotification.Cause)
+
+	// use go routine to write response first to ensure the order of the procedure
+	go func() {
+		problem, err := consumer.UEPolicyControlDelete(ue)
+		if problem != nil {
+			logger.ProducerLog.Errorf("UE Policy Control Delete Failed Problem[%+v]", problem)
+		} else if err != nil {
+			logger.ProducerLog.Errorf("UE Policy Control Delete Error[%v]", err.Error())
+		}
+	}()
+	return nil
+}
+
 // TS 23.502 4.2.2.2.3 Registration with AMF re-allocation
 func HandleN1MessageNotify(request *http_wrapper.Request) *http_wrapper.Response {
 	logger.ProducerLog.Infoln("[AMF] Handle N1 Message Notify")
@@ -240,6 +284,15 @@ func N1MessageNotifyProcedure(n1MessageNotify models.N1MessageNotify) *models.Pr
 
 	amfSelf := context.AMF_Self()
 
+	if n1MessageNotify.JsonData == nil || n1MessageNotify.JsonData.RegistrationCtxtContainer == nil {
+		problemDetails := &models.ProblemDetails{
+			Status: http.StatusBadRequest,
+			Cause:  "MANDATORY_IE_MISSING", // Defined in TS 29.500 5.2.7.2
+			Detail: "Missing IE [RegistrationCtxtContainer] in N1MessageNotify",
+		}
+		return problemDetails
+	}
+
 	registrationCtxtContainer := n1MessageNotify.JsonData.RegistrationCtxtContainer
 	if registrationCtxtContainer.UeContext == nil {
 		problemDetails := &models.ProblemDetails{
@@ -292,3 +345,46 @@ func N1MessageNotifyProcedure(n1MessageNotify models.N1MessageNotify) *models.Pr
 	}()
 	return nil
 }
+
+// TS 29.503 5.2.2.3.2
+func HandleSdmDataChangeNotify(request *http_wrapper.Request) *http_wrapper.Response {
+	logger.ProducerLog.Infoln("[AMF] Handle SDM Data Change Notify")
+
+	supi := request.Params["supi"]
+	modificationNotification := request.Body.(models.ModificationNotification)
+
+	problemDetails := SdmDataChangeNotifyProcedure(supi, modificationNotification)
+	if problemDetails != nil {
+		return http_wrapper.NewResponse(int(problemDetails.Status), nil, problemDetails)
+	} else {
+		return http_wrapper.NewResponse(http.StatusNoContent, nil, nil)
+	}
+}
+
+func SdmDataChangeNotifyProcedure(supi string, modificationNotification models.ModificationNotification) (
+	problemDetails *models.ProblemDetails) {
+	amfSelf := context.AMF_Self()
+
+	ue, ok := amfSelf.AmfUeFindBySupi(supi)
+	if !ok {
+		problemDetails = &models.ProblemDetails{
+			Status: http.StatusNotFound,
+			Cause:  "CONTEXT_NOT_FOUND",
+		}
+		return
+	}
+
+	for _, notifyItem := range modificationNotification.NotifyItems {
+		logger.ProducerLog.Debugf("UE[%s] subscription data changed: %s", supi, notifyItem.ResourceId)
+		if strings.HasSuffix(notifyItem.ResourceId, "/am-data") {
+			problem, err := consumer.SDMGetAmData(ue)
+			if problem != nil {
+				logger.ProducerLog.Errorf("SDM Get AM Data Failed Problem[%+v]", problem)
+			} else if err != nil {
+				logger.ProducerLog.Errorf("SDM Get AM Data Error[%+v]", err)
+			}
+		}
+	}
+	ue.NotifyEvent(models.AmfEventType_SUBSCRIBED_DATA_REPORT)
+	return nil
+}
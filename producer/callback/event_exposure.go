@@ -0,0 +1,123 @@
+package callback
+
+import (
+	"bytes"
+	"context"
+	"free5gc/lib/openapi"
+	"free5gc/lib/openapi/models"
+	"free5gc/src/amf/logger"
+	"free5gc/src/amf/util"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// the reports queued for a notification URI within amfEventNotifyBatchInterval are sent together
+	amfEventNotifyBatchInterval = 100 * time.Millisecond
+	// a notification which fails is sent again after amfEventNotifyRetryInterval, doubled at every retry
+	amfEventNotifyRetryInterval = time.Second
+	amfEventNotifyMaxRetries    = 3
+	amfEventNotifyTimeout       = 10 * time.Second
+)
+
+// amfEventNotifier batches the reports to a notification URI
+type amfEventNotifier struct {
+	mutex     sync.Mutex
+	reports   map[string][]models.AmfEventReport // by notification correlation id
+	scheduled bool
+	// the notifications to the URI are sent in order
+	sendMutex sync.Mutex
+}
+
+var amfEventNotifiers sync.Map // map[notify uri]*amfEventNotifier
+
+// SendAmfEventReport queues a report to the notification URI of its subscription; the reports
+// queued for the URI are sent within amfEventNotifyBatchInterval, in one notification per subscription
+func SendAmfEventReport(uri string, notifyCorrelationId string, report models.AmfEventReport) {
+	value, _ := amfEventNotifiers.LoadOrStore(uri, new(amfEventNotifier))
+	notifier := value.(*amfEventNotifier)
+
+	notifier.mutex.Lock()
+	defer notifier.mutex.Unlock()
+	if notifier.reports == nil {
+		notifier.reports = make(map[string][]models.AmfEventReport)
+	}
+	notifier.reports[notifyCorrelationId] = append(notifier.reports[notifyCorrelationId], report)
+	if !notifier.scheduled {
+		notifier.scheduled = true
+		time.AfterFunc(amfEventNotifyBatchInterval, func() {
+			notifier.flush(uri)
+		})
+	}
+}
+
+func (notifier *amfEventNotifier) flush(uri string) {
+	notifier.sendMutex.Lock()
+	defer notifier.sendMutex.Unlock()
+
+	notifier.mutex.Lock()
+	reports := notifier.reports
+	notifier.reports = nil
+	notifier.scheduled = false
+	notifier.mutex.Unlock()
+
+	for notifyCorrelationId, reportList := range reports {
+		sendAmfEventNotification(uri, models.AmfEventNotification{
+			NotifyCorrelationId: notifyCorrelationId,
+			ReportList:          reportList,
+		})
+	}
+}
+
+// sendAmfEventNotification posts a notification to uri, and retries with a backoff while the
+// subscriber does not answer or fails
+func sendAmfEventNotification(uri string, notification models.AmfEventNotification) {
+	body, err := openapi.Serialize(notification, "application/json")
+	if err != nil {
+		HttpLog.Errorln(err.Error())
+		return
+	}
+
+	logger.ProducerLog.Infof("[AMF] Send Amf Event Notify to %s", uri)
+	retryInterval := amfEventNotifyRetryInterval
+	for retry := 0; ; retry++ {
+		httpResp, err := postAmfEventNotification(uri, body)
+		if err == nil {
+			if httpResp.StatusCode < http.StatusInternalServerError {
+				if httpResp.StatusCode >= http.StatusBadRequest {
+					HttpLog.Errorf("Amf Event Notify to %s rejected: %s", uri, httpResp.Status)
+				}
+				return
+			}
+			err = openapi.ReportError("%s: %s", uri, httpResp.Status)
+		}
+		if retry == amfEventNotifyMaxRetries {
+			HttpLog.Errorf("Amf Event Notify to %s failed: %+v", uri, err)
+			return
+		}
+		HttpLog.Warnf("Amf Event Notify to %s failed, retry in %s: %+v", uri, retryInterval, err)
+		time.Sleep(retryInterval)
+		retryInterval *= 2
+	}
+}
+
+// postAmfEventNotification posts a notification to uri within amfEventNotifyTimeout; there is no
+// generated client for the notification URIs of the Namf_EventExposure subscriptions
+func postAmfEventNotification(uri string, body []byte) (*http.Response, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), amfEventNotifyTimeout)
+	defer cancel()
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, uri, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	httpResp, err := util.SbiClient().Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	httpResp.Body.Close()
+	return httpResp, nil
+}
@@ -6,7 +6,9 @@ import (
 	"free5gc/lib/openapi/models"
 	amf_context "free5gc/src/amf/context"
 	"free5gc/src/amf/logger"
+	"reflect"
 	"strconv"
+	"sync"
 
 	"github.com/sirupsen/logrus"
 )
@@ -21,9 +23,22 @@ func SendN1N2TransferFailureNotification(ue *amf_context.AmfUe, cause models.N1N
 	if ue.N1N2Message == nil {
 		return
 	}
-	n1n2Message := ue.N1N2Message
+	if sendN1N2TransferFailureNotification(ue.N1N2Message, cause) {
+		ue.N1N2Message = nil
+	}
+}
+
+// SendHeldN1N2TransferFailureNotification notifies the failure of a transfer which was held for the UE
+func SendHeldN1N2TransferFailureNotification(n1n2Message *amf_context.N1N2Message,
+	cause models.N1N2MessageTransferCause) {
+	sendN1N2TransferFailureNotification(n1n2Message, cause)
+}
+
+func sendN1N2TransferFailureNotification(n1n2Message *amf_context.N1N2Message,
+	cause models.N1N2MessageTransferCause) bool {
 	uri := n1n2Message.Request.JsonData.N1n2FailureTxfNotifURI
-	if n1n2Message.Status == models.N1N2MessageTransferCause_ATTEMPTING_TO_REACH_UE && uri != "" {
+	if (n1n2Message.Status == models.N1N2MessageTransferCause_ATTEMPTING_TO_REACH_UE ||
+		n1n2Message.Status == models.N1N2MessageTransferCause_WAITING_FOR_ASYNCHRONOUS_TRANSFER) && uri != "" {
 
 		configuration := Namf_Communication.NewConfiguration()
 		client := Namf_Communication.NewAPIClient(configuration)
@@ -43,14 +58,18 @@ func SendN1N2TransferFailureNotification(ue *amf_context.AmfUe, cause models.N1N
 				HttpLog.Errorln(err.Error())
 			}
 		} else {
-			ue.N1N2Message = nil
+			return true
 		}
 
 	}
+	return false
 }
 
+// SendN1MessageNotify notifies the N1 message to the NFs which subscribed to its class, and reports whether any
+// of them was notified
 func SendN1MessageNotify(ue *amf_context.AmfUe, n1class models.N1MessageClass, n1Msg []byte,
-	registerContext *models.RegistrationContextContainer) {
+	registerContext *models.RegistrationContextContainer) bool {
+	notified := false
 	ue.N1N2MessageSubscription.Range(func(key, value interface{}) bool {
 		subscriptionID := key.(int64)
 		subscription := value.(models.UeN1N2InfoSubscriptionCreateData)
@@ -80,10 +99,44 @@ func SendN1MessageNotify(ue *amf_context.AmfUe, n1class models.N1MessageClass, n
 				} else if err.Error() != httpResponse.Status {
 					HttpLog.Errorln(err.Error())
 				}
+			} else {
+				notified = true
 			}
 		}
 		return true
 	})
+	return notified
+}
+
+// SendN1MessageNotifyToDefaultConsumer notifies the N1 message to the default notification subscription of an NF,
+// which consumes the messages of the class without subscribing for the UE
+func SendN1MessageNotifyToDefaultConsumer(n1class models.N1MessageClass, n1Msg []byte, callbackUri string) bool {
+	configuration := Namf_Communication.NewConfiguration()
+	client := Namf_Communication.NewAPIClient(configuration)
+
+	n1MessageNotify := models.N1MessageNotify{
+		JsonData: &models.N1MessageNotification{
+			N1MessageContainer: &models.N1MessageContainer{
+				N1MessageClass: n1class,
+				N1MessageContent: &models.RefToBinaryData{
+					ContentId: "n1Msg",
+				},
+			},
+		},
+		BinaryDataN1Message: n1Msg,
+	}
+
+	httpResp, err := client.N1MessageNotifyCallbackDocumentApiServiceCallbackDocumentApi.
+		N1MessageNotify(context.Background(), callbackUri, n1MessageNotify)
+	if err != nil {
+		if httpResp == nil {
+			HttpLog.Errorln(err.Error())
+		} else if err.Error() != httpResp.Status {
+			HttpLog.Errorln(err.Error())
+		}
+		return false
+	}
+	return true
 }
 
 // TS 29.518 5.2.2.3.5.2
@@ -196,3 +249,138 @@ func SendN2InfoNotify(ue *amf_context.AmfUe, n2class models.N2InformationClass,
 		return true
 	})
 }
+
+// SendNrppaInfoNotify notifies the LMF, which subscribed to the NRPPa N2 information of the UE,
+// of an uplink UE associated NRPPa PDU (TS 23.502 4.13.5.5); the notification is sent asynchronously
+func SendNrppaInfoNotify(ue *amf_context.AmfUe, lmfId string, nrppaPdu []byte) {
+	ue.N1N2MessageSubscription.Range(func(key, value interface{}) bool {
+		subscriptionID := key.(int64)
+		subscription := value.(models.UeN1N2InfoSubscriptionCreateData)
+
+		if subscription.N2NotifyCallbackUri == "" ||
+			subscription.N2InformationClass != models.N2InformationClass_NRP_PA ||
+			(subscription.NfId != "" && subscription.NfId != lmfId) {
+			return true
+		}
+
+		n2InformationNotify := models.N2InfoNotifyRequest{
+			JsonData: &models.N2InformationNotification{
+				N2NotifySubscriptionId: strconv.Itoa(int(subscriptionID)),
+				N2InfoContainer: &models.N2InfoContainer{
+					N2InformationClass: models.N2InformationClass_NRP_PA,
+					NrppaInfo: &models.NrppaInformation{
+						NfId: lmfId,
+						NrppaPdu: &models.N2InfoContent{
+							NgapData: &models.RefToBinaryData{
+								ContentId: "n2Info",
+							},
+						},
+					},
+				},
+			},
+			BinaryDataN2Information: nrppaPdu,
+		}
+		queueN2InfoNotify(subscription.N2NotifyCallbackUri, n2InformationNotify)
+		return true
+	})
+}
+
+// SendNonUeN2InfoNotify notifies the Non UE N2 information subscribers of n2class of the
+// N2 information received from a RAN, e.g. the PWS indications (TS 29.518 5.2.2.4.2); the
+// notifications are sent asynchronously
+func SendNonUeN2InfoNotify(n2InfoContainer models.N2InfoContainer, ranNodeId *models.GlobalRanNodeId,
+	n2Msg []byte) {
+	amf_context.AMF_Self().NonUeN2InfoSubscriptions.Range(func(key, value interface{}) bool {
+		subscriptionID := key.(string)
+		subscription := value.(models.NonUeN2InfoSubscriptionCreateData)
+
+		if subscription.N2NotifyCallbackUri == "" ||
+			subscription.N2InformationClass != n2InfoContainer.N2InformationClass {
+			return true
+		}
+		// NRPPa PDUs are sent to the LMF identified by the Routing ID only
+		if nrppaInfo := n2InfoContainer.NrppaInfo; nrppaInfo != nil &&
+			subscription.NfId != "" && subscription.NfId != nrppaInfo.NfId {
+			return true
+		}
+		if len(subscription.GlobalRanNodeList) > 0 {
+			found := false
+			for _, globalRanNodeId := range subscription.GlobalRanNodeList {
+				if ranNodeId != nil && reflect.DeepEqual(globalRanNodeId, *ranNodeId) {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return true
+			}
+		}
+
+		container := n2InfoContainer
+		n2InformationNotify := models.N2InfoNotifyRequest{
+			JsonData: &models.N2InformationNotification{
+				N2NotifySubscriptionId: subscriptionID,
+				N2InfoContainer:        &container,
+				RanNodeId:              ranNodeId,
+			},
+			BinaryDataN2Information: n2Msg,
+		}
+		queueN2InfoNotify(subscription.N2NotifyCallbackUri, n2InformationNotify)
+		return true
+	})
+}
+
+// n2InfoNotifyQueue holds the N2 information notifications until the notifier goroutine sends them, so
+// that the NGAP workers do not wait for the subscribers
+var n2InfoNotifyQueue struct {
+	mutex         sync.Mutex
+	notifications []n2InfoNotification
+	running       bool
+}
+
+type n2InfoNotification struct {
+	uri     string
+	request models.N2InfoNotifyRequest
+}
+
+// n2InfoNotifyClient is the client of the N2 information notifications, which are sent to the callback
+// URI of each subscription
+var n2InfoNotifyClient = Namf_Communication.NewAPIClient(Namf_Communication.NewConfiguration())
+
+func queueN2InfoNotify(uri string, request models.N2InfoNotifyRequest) {
+	n2InfoNotifyQueue.mutex.Lock()
+	defer n2InfoNotifyQueue.mutex.Unlock()
+	n2InfoNotifyQueue.notifications = append(n2InfoNotifyQueue.notifications,
+		n2InfoNotification{uri: uri, request: request})
+	if !n2InfoNotifyQueue.running {
+		n2InfoNotifyQueue.running = true
+		go runN2InfoNotifier()
+	}
+}
+
+// runN2InfoNotifier sends the queued notifications in order, until the queue is empty
+func runN2InfoNotifier() {
+	for {
+		n2InfoNotifyQueue.mutex.Lock()
+		notifications := n2InfoNotifyQueue.notifications
+		n2InfoNotifyQueue.notifications = nil
+		if len(notifications) == 0 {
+			n2InfoNotifyQueue.running = false
+			n2InfoNotifyQueue.mutex.Unlock()
+			return
+		}
+		n2InfoNotifyQueue.mutex.Unlock()
+
+		for _, notification := range notifications {
+			httpResponse, err := n2InfoNotifyClient.N2InfoNotifyCallbackDocumentApiServiceCallbackDocumentApi.
+				N2InfoNotify(context.Background(), notification.uri, notification.request)
+			if err != nil {
+				if httpResponse == nil {
+					HttpLog.Errorln(err.Error())
+				} else if err.Error() != httpResponse.Status {
+					HttpLog.Errorln(err.Error())
+				}
+			}
+		}
+	}
+}
@@ -5,11 +5,45 @@ import (
 	"free5gc/lib/openapi/models"
 	"free5gc/src/amf/context"
 	"free5gc/src/amf/logger"
+	ngap_message "free5gc/src/amf/ngap/message"
+	"free5gc/src/amf/producer/callback"
+	"hash/fnv"
 	"net/http"
 	"strconv"
+	"sync"
 	"time"
 )
 
+// eventSubscriptionMutex serializes the changes of the event subscriptions and their reports,
+// it is released by unlockEventSubscriptions
+var eventSubscriptionMutex sync.Mutex
+
+// locationReportingChanges are the location reportings started or stopped while the event subscriptions
+// are locked; they are requested to the NG-RAN once the lock is released, in order of locationReportingMutex
+var (
+	locationReportingChanges []func()
+	locationReportingMutex   sync.Mutex
+)
+
+// amfEventQueue holds the events of the UEs until the notifier goroutine reports them, so that the
+// handling of the UEs does not wait for the event subscriptions
+var amfEventQueue struct {
+	mutex   sync.Mutex
+	events  []amfEvent
+	running bool
+}
+
+type amfEvent struct {
+	ue        *context.AmfUe
+	eventType models.AmfEventType
+}
+
+// periodicReports stops the periodic reports of a subscription, map[subscriptionID]chan struct{}
+var periodicReports sync.Map
+
+// maxMutedReports is the number of reports kept for a muted subscription, the oldest are dropped
+const maxMutedReports = 64
+
 func HandleCreateAMFEventSubscription(request *http_wrapper.Request) *http_wrapper.Response {
 	createEventSubscription := request.Body.(models.AmfCreateEventSubscription)
 
@@ -27,18 +61,18 @@ func HandleCreateAMFEventSubscription(request *http_wrapper.Request) *http_wrapp
 	}
 }
 
-// TODO: handle event filter
 func CreateAMFEventSubscriptionProcedure(createEventSubscription models.AmfCreateEventSubscription) (
 	*models.AmfCreatedEventSubscription, *models.ProblemDetails) {
 
 	amfSelf := context.AMF_Self()
 
+	eventSubscriptionMutex.Lock()
+	defer unlockEventSubscriptions()
+
 	createdEventSubscription := &models.AmfCreatedEventSubscription{}
 	subscription := createEventSubscription.Subscription
 	contextEventSubscription := &context.AMFContextEventSubscription{}
 	contextEventSubscription.EventSubscription = *subscription
-	var isImmediate bool
-	var immediateFlags []bool
 	var reportlist []models.AmfEventReport
 
 	id, err := amfSelf.EventSubscriptionIDGenerator.Allocate()
@@ -52,29 +86,25 @@ func CreateAMFEventSubscriptionProcedure(createEventSubscription models.AmfCreat
 	newSubscriptionID := strconv.Itoa(int(id))
 
 	// store subscription in context
-	ueEventSubscription := context.AmfUeEventSubscription{}
+	ueEventSubscription := &contextEventSubscription.UeEventSubscription
 	ueEventSubscription.EventSubscription = &contextEventSubscription.EventSubscription
 	ueEventSubscription.Timestamp = time.Now().UTC()
 
-	if subscription.Options != nil && subscription.Options.Trigger == models.AmfEventTrigger_CONTINUOUS {
+	// the number of reports is not limited when maxReports is absent
+	if subscription.Options != nil && subscription.Options.Trigger != models.AmfEventTrigger_ONE_TIME &&
+		subscription.Options.MaxReports > 0 {
 		ueEventSubscription.RemainReports = new(int32)
 		*ueEventSubscription.RemainReports = subscription.Options.MaxReports
 	}
-	for _, events := range *subscription.EventList {
-		immediateFlags = append(immediateFlags, events.ImmediateFlag)
-		if events.ImmediateFlag {
-			isImmediate = true
-		}
-	}
 
 	if subscription.AnyUE {
 		contextEventSubscription.IsAnyUe = true
 		ueEventSubscription.AnyUe = true
 		amfSelf.UePool.Range(func(key, value interface{}) bool {
 			ue := value.(*context.AmfUe)
-			ue.EventSubscriptionsInfo[newSubscriptionID] = new(context.AmfUeEventSubscription)
-			*ue.EventSubscriptionsInfo[newSubscriptionID] = ueEventSubscription
-			contextEventSubscription.UeSupiList = append(contextEventSubscription.UeSupiList, ue.Supi)
+			if sampled(ue, newSubscriptionID, contextEventSubscription) {
+				addUeEventSubscription(ue, newSubscriptionID, contextEventSubscription)
+			}
 			return true
 		})
 	} else if subscription.GroupId != "" {
@@ -83,24 +113,21 @@ func CreateAMFEventSubscriptionProcedure(createEventSubscription models.AmfCreat
 		amfSelf.UePool.Range(func(key, value interface{}) bool {
 			ue := value.(*context.AmfUe)
 			if ue.GroupID == subscription.GroupId {
-				ue.EventSubscriptionsInfo[newSubscriptionID] = new(context.AmfUeEventSubscription)
-				*ue.EventSubscriptionsInfo[newSubscriptionID] = ueEventSubscription
-				contextEventSubscription.UeSupiList = append(contextEventSubscription.UeSupiList, ue.Supi)
+				addUeEventSubscription(ue, newSubscriptionID, contextEventSubscription)
 			}
 			return true
 		})
 
 	} else {
 		if ue, ok := amfSelf.AmfUeFindBySupi(subscription.Supi); !ok {
+			amfSelf.EventSubscriptionIDGenerator.FreeID(id)
 			problemDetails := &models.ProblemDetails{
 				Status: http.StatusForbidden,
 				Cause:  "UE_NOT_SERVED_BY_AMF",
 			}
 			return nil, problemDetails
 		} else {
-			ue.EventSubscriptionsInfo[newSubscriptionID] = new(context.AmfUeEventSubscription)
-			*ue.EventSubscriptionsInfo[newSubscriptionID] = ueEventSubscription
-			contextEventSubscription.UeSupiList = append(contextEventSubscription.UeSupiList, ue.Supi)
+			addUeEventSubscription(ue, newSubscriptionID, contextEventSubscription)
 		}
 	}
 
@@ -116,75 +143,248 @@ func CreateAMFEventSubscriptionProcedure(createEventSubscription models.AmfCreat
 	createdEventSubscription.SubscriptionId = newSubscriptionID
 
 	// for immediate use
-	if subscription.AnyUE {
-		amfSelf.UePool.Range(func(key, value interface{}) bool {
-			ue := value.(*context.AmfUe)
-			if isImmediate {
-				subReports(ue, newSubscriptionID)
+	active := true
+	for _, supi := range contextEventSubscription.UeSupiList {
+		if ue, ok := amfSelf.AmfUeFindBySupi(supi); ok {
+			reports, ueActive := immediateReports(ue, newSubscriptionID, contextEventSubscription)
+			reportlist = append(reportlist, reports...)
+			active = active && ueActive
+		}
+	}
+	if len(reportlist) > 0 {
+		createdEventSubscription.ReportList = reportlist
+	}
+	// delete subscription
+	if !active {
+		deleteEventSubscription(newSubscriptionID, contextEventSubscription)
+		return createdEventSubscription, nil
+	}
+
+	for _, supi := range contextEventSubscription.UeSupiList {
+		if ue, ok := amfSelf.AmfUeFindBySupi(supi); ok {
+			startLocationReporting(ue, newSubscriptionID, contextEventSubscription)
+		}
+	}
+	startPeriodicReport(newSubscriptionID, contextEventSubscription)
+
+	return createdEventSubscription, nil
+}
+
+// addUeEventSubscription adds a UE to a subscription
+func addUeEventSubscription(ue *context.AmfUe, subscriptionID string, subscription *context.AMFContextEventSubscription) {
+	ueSubscription := subscription.NewUeEventSubscription()
+	ue.EventSubscriptionsInfo[subscriptionID] = ueSubscription
+	subscription.UeSupiList = append(subscription.UeSupiList, ue.Supi)
+	// the UE is counted in the areas from its current location
+	if event := subscribedEventOf(&subscription.EventSubscription, models.AmfEventType_UES_IN_AREA_REPORT); event != nil {
+		ueSubscription.UpdatePresence(ue, event.Type, event.AreaList)
+	}
+}
+
+// sampled tells if a UE is in an any UE subscription, according to its sampling ratio; a UE is
+// sampled or not by a subscription for good, whenever it registers
+func sampled(ue *context.AmfUe, subscriptionID string, subscription *context.AMFContextEventSubscription) bool {
+	options := subscription.EventSubscription.Options
+	if options == nil || options.SampRatio <= 0 || options.SampRatio >= 100 {
+		return true
+	}
+	hash := fnv.New32a()
+	hash.Write([]byte(subscriptionID + "/" + ue.Supi))
+	return int32(hash.Sum32()%100) < options.SampRatio
+}
+
+// addUeToEventSubscriptions adds a UE which registers to the any UE subscriptions, to the
+// subscriptions of its group, and to its own subscriptions reloaded after a restart of the AMF
+func addUeToEventSubscriptions(ue *context.AmfUe) {
+	amfSelf := context.AMF_Self()
+
+	amfSelf.EventSubscriptions.Range(func(key, value interface{}) bool {
+		subscriptionID := key.(string)
+		subscription := value.(*context.AMFContextEventSubscription)
+		if _, ok := ue.EventSubscriptionsInfo[subscriptionID]; ok {
+			return true
+		}
+		if (subscription.IsAnyUe && sampled(ue, subscriptionID, subscription)) ||
+			(subscription.IsGroupUe && ue.GroupID == subscription.EventSubscription.GroupId) ||
+			(!subscription.IsAnyUe && !subscription.IsGroupUe && ue.Supi == subscription.EventSubscription.Supi) {
+			logger.EeLog.Debugf("Add UE[%s] to event subscription[%s]", ue.Supi, subscriptionID)
+			addUeEventSubscription(ue, subscriptionID, subscription)
+			startLocationReporting(ue, subscriptionID, subscription)
+		}
+		return true
+	})
+}
+
+// immediateReports builds the reports of the events of a subscription with the immediate flag for a UE,
+// and tells if the subscription is still active after them
+func immediateReports(ue *context.AmfUe, subscriptionID string, subscription *context.AMFContextEventSubscription) (
+	reports []models.AmfEventReport, active bool) {
+	for i := range *subscription.EventSubscription.EventList {
+		event := &(*subscription.EventSubscription.EventList)[i]
+		if !event.ImmediateFlag || !ue.MatchEventFilter(event) {
+			continue
+		}
+		subReports(ue, subscriptionID)
+		report, ok := NewAmfEventReport(ue, event.Type, subscriptionID)
+		if !ok {
+			break
+		}
+		reports = append(reports, report)
+		if !report.State.Active {
+			return reports, false
+		}
+	}
+	return reports, true
+}
+
+// startLocationReporting requests the NG-RAN to report the location of a UE of a subscription to
+// the LOCATION_REPORT, PRESENCE_IN_AOI_REPORT or UES_IN_AREA_REPORT events
+func startLocationReporting(ue *context.AmfUe, subscriptionID string, subscription *context.AMFContextEventSubscription) {
+	eventSubscription := &subscription.EventSubscription
+	locationEvent := subscribedEventOf(eventSubscription, models.AmfEventType_LOCATION_REPORT)
+	presenceEvent := subscribedEventOf(eventSubscription, models.AmfEventType_PRESENCE_IN_AOI_REPORT)
+	uesInAreaEvent := subscribedEventOf(eventSubscription, models.AmfEventType_UES_IN_AREA_REPORT)
+	if locationEvent == nil && presenceEvent == nil && uesInAreaEvent == nil {
+		return
+	}
+
+	// the location is reported at every change of cell, except that a one time location is reported at
+	// the next report, that the location of a periodic subscription is requested before each periodic
+	// report, and that the NG-RAN reports the presence in a single area of interest itself
+	reporting := context.NewLocationReporting(context.LocationReportingChangeOfServeCell)
+	if presenceEvent == nil && uesInAreaEvent == nil {
+		if options := eventSubscription.Options; options != nil {
+			switch {
+			case options.Trigger == models.AmfEventTrigger_ONE_TIME:
+				reporting.Type = context.LocationReportingDeferred
+			case options.Trigger == models.AmfEventTrigger_PERIODIC && options.RepPeriod > 0:
+				reporting.Type = context.LocationReportingPeriodic
+				reporting.Period = time.Duration(options.RepPeriod) * time.Second
 			}
-			for i, flag := range immediateFlags {
-				if flag {
-					report, ok := NewAmfEventReport(ue, (*subscription.EventList)[i].Type, newSubscriptionID)
-					if ok {
-						reportlist = append(reportlist, report)
-					}
-				}
+		}
+	} else if locationEvent == nil && uesInAreaEvent == nil && len(presenceEvent.AreaList) == 1 &&
+		presenceEvent.AreaList[0].PresenceInfo != nil {
+		if area, ok := context.ResolvePresenceReportingArea(*presenceEvent.AreaList[0].PresenceInfo); ok {
+			if reporting.AreaOfInterest, ok = ngap_message.BuildIEAreaOfInterest(area); ok {
+				reporting.Type = context.LocationReportingAreaOfInterest
 			}
-			// delete subscription
-			if len := len(reportlist); len > 0 && (!reportlist[len-1].State.Active) {
-				delete(ue.EventSubscriptionsInfo, newSubscriptionID)
+		}
+	}
+	locationReportingChanges = append(locationReportingChanges, func() {
+		ngap_message.StartLocationReporting(ue, subscriptionID, reporting)
+	})
+}
+
+// unlockEventSubscriptions releases eventSubscriptionMutex, and then requests the location reporting
+// changes made under it to the NG-RAN
+func unlockEventSubscriptions() {
+	changes := locationReportingChanges
+	locationReportingChanges = nil
+	locationReportingMutex.Lock()
+	defer locationReportingMutex.Unlock()
+	eventSubscriptionMutex.Unlock()
+
+	for _, change := range changes {
+		change()
+	}
+}
+
+// startPeriodicReport reports the events of a periodic subscription every repPeriod
+func startPeriodicReport(subscriptionID string, subscription *context.AMFContextEventSubscription) {
+	options := subscription.EventSubscription.Options
+	if options == nil || options.Trigger != models.AmfEventTrigger_PERIODIC || options.RepPeriod <= 0 {
+		return
+	}
+
+	stop := make(chan struct{})
+	periodicReports.Store(subscriptionID, stop)
+	go func() {
+		ticker := time.NewTicker(time.Duration(options.RepPeriod) * time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				periodicReport(subscriptionID)
+			case <-stop:
+				return
 			}
-			return true
-		})
-	} else if subscription.GroupId != "" {
-		amfSelf.UePool.Range(func(key, value interface{}) bool {
-			ue := value.(*context.AmfUe)
-			if isImmediate {
-				subReports(ue, newSubscriptionID)
+		}
+	}()
+}
+
+func periodicReport(subscriptionID string) {
+	amfSelf := context.AMF_Self()
+
+	eventSubscriptionMutex.Lock()
+	defer unlockEventSubscriptions()
+
+	subscription, ok := amfSelf.FindEventSubscription(subscriptionID)
+	if !ok {
+		return
+	}
+	if subscription.Expiry != nil && time.Now().After(*subscription.Expiry) {
+		logger.EeLog.Infof("Event subscription[%s] expired", subscriptionID)
+		deleteEventSubscription(subscriptionID, subscription)
+		return
+	}
+
+	for _, supi := range subscription.UeSupiList {
+		ue, ok := amfSelf.AmfUeFindBySupi(supi)
+		if !ok {
+			continue
+		}
+		if _, ok := ue.EventSubscriptionsInfo[subscriptionID]; !ok {
+			continue
+		}
+		for i := range *subscription.EventSubscription.EventList {
+			event := &(*subscription.EventSubscription.EventList)[i]
+			if !ue.MatchEventFilter(event) {
+				continue
 			}
-			if ue.GroupID == subscription.GroupId {
-				for i, flag := range immediateFlags {
-					if flag {
-						report, ok := NewAmfEventReport(ue, (*subscription.EventList)[i].Type, newSubscriptionID)
-						if ok {
-							reportlist = append(reportlist, report)
-						}
-					}
-				}
-				// delete subscription
-				if len := len(reportlist); len > 0 && (!reportlist[len-1].State.Active) {
-					delete(ue.EventSubscriptionsInfo, newSubscriptionID)
-				}
+			subReports(ue, subscriptionID)
+			report, ok := NewAmfEventReport(ue, event.Type, subscriptionID)
+			if !ok {
+				continue
 			}
-			return true
-		})
-	} else {
-		ue, _ := amfSelf.AmfUeFindBySupi(subscription.Supi)
-		if isImmediate {
-			subReports(ue, newSubscriptionID)
-		}
-		for i, flag := range immediateFlags {
-			if flag {
-				report, ok := NewAmfEventReport(ue, (*subscription.EventList)[i].Type, newSubscriptionID)
-				if ok {
-					reportlist = append(reportlist, report)
-				}
+			sendEventReport(subscription, report)
+			if !report.State.Active {
+				deleteEventSubscription(subscriptionID, subscription)
+				return
 			}
 		}
-		// delete subscription
-		if len := len(reportlist); len > 0 && (!reportlist[len-1].State.Active) {
-			delete(ue.EventSubscriptionsInfo, newSubscriptionID)
-		}
 	}
-	if len(reportlist) > 0 {
-		createdEventSubscription.ReportList = reportlist
-		// delete subscription
-		if !reportlist[0].State.Active {
-			amfSelf.DeleteEventSubscription(newSubscriptionID)
+}
+
+// sendEventReport notifies a report to a subscription, or keeps it while the notifications are muted
+func sendEventReport(subscription *context.AMFContextEventSubscription, report models.AmfEventReport) {
+	eventSubscription := &subscription.EventSubscription
+	if options := eventSubscription.Options; options != nil && options.NotifFlag == models.NotificationFlag_DEACTIVATE {
+		if len(subscription.MutedReports) >= maxMutedReports {
+			subscription.MutedReports = subscription.MutedReports[1:]
 		}
+		subscription.MutedReports = append(subscription.MutedReports, report)
+		return
 	}
+	callback.SendAmfEventReport(eventSubscription.EventNotifyUri, eventSubscription.NotifyCorrelationId, report)
+}
 
-	return createdEventSubscription, nil
+// muteEventSubscription mutes or unmutes the notifications of a subscription; the reports kept while
+// muted are notified when unmuted, or retrieved
+func muteEventSubscription(subscription *context.AMFContextEventSubscription, notifFlag models.NotificationFlag) {
+	eventSubscription := &subscription.EventSubscription
+	switch notifFlag {
+	case models.NotificationFlag_ACTIVATE, models.NotificationFlag_DEACTIVATE:
+		if eventSubscription.Options == nil {
+			eventSubscription.Options = new(models.AmfEventMode)
+		}
+		eventSubscription.Options.NotifFlag = notifFlag
+	}
+	if notifFlag == models.NotificationFlag_ACTIVATE || notifFlag == models.NotificationFlag_RETRIEVAL {
+		for _, report := range subscription.MutedReports {
+			callback.SendAmfEventReport(eventSubscription.EventNotifyUri, eventSubscription.NotifyCorrelationId, report)
+		}
+		subscription.MutedReports = nil
+	}
 }
 
 func HandleDeleteAMFEventSubscription(request *http_wrapper.Request) *http_wrapper.Response {
@@ -203,6 +403,9 @@ func HandleDeleteAMFEventSubscription(request *http_wrapper.Request) *http_wrapp
 func DeleteAMFEventSubscriptionProcedure(subscriptionID string) *models.ProblemDetails {
 	amfSelf := context.AMF_Self()
 
+	eventSubscriptionMutex.Lock()
+	defer unlockEventSubscriptions()
+
 	subscription, ok := amfSelf.FindEventSubscription(subscriptionID)
 	if !ok {
 		problemDetails := &models.ProblemDetails{
@@ -212,13 +415,27 @@ func DeleteAMFEventSubscriptionProcedure(subscriptionID string) *models.ProblemD
 		return problemDetails
 	}
 
+	deleteEventSubscription(subscriptionID, subscription)
+	return nil
+}
+
+// deleteEventSubscription removes a subscription from the AMF and its UEs
+func deleteEventSubscription(subscriptionID string, subscription *context.AMFContextEventSubscription) {
+	amfSelf := context.AMF_Self()
+
 	for _, supi := range subscription.UeSupiList {
 		if ue, ok := amfSelf.AmfUeFindBySupi(supi); ok {
 			delete(ue.EventSubscriptionsInfo, subscriptionID)
+			locationReportingChanges = append(locationReportingChanges, func() {
+				ngap_message.StopLocationReporting(ue, subscriptionID)
+			})
 		}
 	}
+	if stop, ok := periodicReports.Load(subscriptionID); ok {
+		periodicReports.Delete(subscriptionID)
+		close(stop.(chan struct{}))
+	}
 	amfSelf.DeleteEventSubscription(subscriptionID)
-	return nil
 }
 
 func HandleModifyAMFEventSubscription(request *http_wrapper.Request) *http_wrapper.Response {
@@ -249,6 +466,9 @@ func ModifyAMFEventSubscriptionProcedure(
 
 	amfSelf := context.AMF_Self()
 
+	eventSubscriptionMutex.Lock()
+	defer unlockEventSubscriptions()
+
 	contextSubscription, ok := amfSelf.FindEventSubscription(subscriptionID)
 	if !ok {
 		problemDetails := &models.ProblemDetails{
@@ -258,8 +478,13 @@ func ModifyAMFEventSubscriptionProcedure(
 		return nil, problemDetails
 	}
 
-	if modifySubscriptionRequest.OptionItem != nil {
-		contextSubscription.Expiry = modifySubscriptionRequest.OptionItem.Value
+	if optionItem := modifySubscriptionRequest.OptionItem; optionItem != nil {
+		switch optionItem.Path {
+		case "/options/notifFlag":
+			muteEventSubscription(contextSubscription, optionItem.NotifFlag)
+		default:
+			contextSubscription.Expiry = optionItem.Value
+		}
 	} else if modifySubscriptionRequest.SubscriptionItemInner != nil {
 		subscription := &contextSubscription.EventSubscription
 		if !contextSubscription.IsAnyUe && !contextSubscription.IsGroupUe {
@@ -298,21 +523,151 @@ func ModifyAMFEventSubscriptionProcedure(
 		}
 	}
 
+	amfSelf.SaveEventSubscription(subscriptionID, contextSubscription)
+
 	updatedEventSubscription := &models.AmfUpdatedEventSubscription{
 		Subscription: &contextSubscription.EventSubscription,
 	}
 	return updatedEventSubscription, nil
 }
 
+// NotifyAmfEvent queues an event of the UE, which the notifier goroutine reports to the subscriptions
+// of the UE to the event
+func NotifyAmfEvent(ue *context.AmfUe, eventType models.AmfEventType) {
+	amfEventQueue.mutex.Lock()
+	defer amfEventQueue.mutex.Unlock()
+	amfEventQueue.events = append(amfEventQueue.events, amfEvent{ue: ue, eventType: eventType})
+	if !amfEventQueue.running {
+		amfEventQueue.running = true
+		go runAmfEventNotifier()
+	}
+}
+
+// runAmfEventNotifier reports the queued events in order, until the queue is empty
+func runAmfEventNotifier() {
+	for {
+		amfEventQueue.mutex.Lock()
+		events := amfEventQueue.events
+		amfEventQueue.events = nil
+		if len(events) == 0 {
+			amfEventQueue.running = false
+			amfEventQueue.mutex.Unlock()
+			return
+		}
+		amfEventQueue.mutex.Unlock()
+
+		for _, event := range events {
+			notifyAmfEvent(event.ue, event.eventType)
+		}
+	}
+}
+
+// notifyAmfEvent reports an event of the UE to the subscriptions of the UE to the event; a
+// subscription is removed once expired or after its last report
+func notifyAmfEvent(ue *context.AmfUe, eventType models.AmfEventType) {
+	amfSelf := context.AMF_Self()
+
+	eventSubscriptionMutex.Lock()
+	defer unlockEventSubscriptions()
+
+	if eventType == models.AmfEventType_REGISTRATION_STATE_REPORT &&
+		(ue.State[models.AccessType__3_GPP_ACCESS].Is(context.Registered) ||
+			ue.State[models.AccessType_NON_3_GPP_ACCESS].Is(context.Registered)) {
+		addUeToEventSubscriptions(ue)
+	}
+
+	for subscriptionID := range ue.EventSubscriptionsInfo {
+		subscription, ok := amfSelf.FindEventSubscription(subscriptionID)
+		if !ok {
+			delete(ue.EventSubscriptionsInfo, subscriptionID)
+			continue
+		}
+		reportTypes := reportedEvents(ue, subscriptionID, subscription, eventType)
+		if len(reportTypes) == 0 {
+			continue
+		}
+		if subscription.Expiry != nil && time.Now().After(*subscription.Expiry) {
+			logger.EeLog.Infof("Event subscription[%s] expired", subscriptionID)
+			deleteEventSubscription(subscriptionID, subscription)
+			continue
+		}
+
+		for _, reportType := range reportTypes {
+			subReports(ue, subscriptionID)
+			report, ok := NewAmfEventReport(ue, reportType, subscriptionID)
+			if !ok {
+				break
+			}
+			logger.EeLog.Debugf("Report event %s of UE[%s] to subscription[%s]", reportType, ue.Supi, subscriptionID)
+			sendEventReport(subscription, report)
+			if !report.State.Active {
+				deleteEventSubscription(subscriptionID, subscription)
+				break
+			}
+		}
+	}
+}
+
+// reportedEvents returns the events of a subscription to report after an event of the UE, which
+// matches their filter; the presence of the UE in the areas of interest is evaluated at every change
+// of its location. The events of a periodic subscription are only reported periodically.
+func reportedEvents(ue *context.AmfUe, subscriptionID string, subscription *context.AMFContextEventSubscription,
+	eventType models.AmfEventType) (reportTypes []models.AmfEventType) {
+	eventSubscription := &subscription.EventSubscription
+	if eventSubscription.EventList == nil ||
+		(eventSubscription.Options != nil && eventSubscription.Options.Trigger == models.AmfEventTrigger_PERIODIC) {
+		return nil
+	}
+	ueSubscription := ue.EventSubscriptionsInfo[subscriptionID]
+	for i := range *eventSubscription.EventList {
+		event := &(*eventSubscription.EventList)[i]
+		switch {
+		case event.Type == eventType:
+			if ue.MatchEventFilter(event) {
+				reportTypes = append(reportTypes, event.Type)
+			}
+		case eventType == models.AmfEventType_LOCATION_REPORT &&
+			(event.Type == models.AmfEventType_PRESENCE_IN_AOI_REPORT ||
+				event.Type == models.AmfEventType_UES_IN_AREA_REPORT):
+			presenceList, changed := ueSubscription.UpdatePresence(ue, event.Type, event.AreaList)
+			if changed && ue.MatchEventFilter(event) && context.MatchPresenceFilter(event.AreaList, presenceList) {
+				reportTypes = append(reportTypes, event.Type)
+			}
+		}
+	}
+	return reportTypes
+}
+
+// subscribedEventOf returns the event of eventType of a subscription
+func subscribedEventOf(subscription *models.AmfEventSubscription, eventType models.AmfEventType) *models.AmfEvent {
+	if subscription.EventList == nil {
+		return nil
+	}
+	for i, event := range *subscription.EventList {
+		if event.Type == eventType {
+			return &(*subscription.EventList)[i]
+		}
+	}
+	return nil
+}
+
+// subReports counts a report of the subscription, whose remaining reports are shared by its UEs and
+// saved so that a restart of the AMF does not reset them
 func subReports(ue *context.AmfUe, subscriptionId string) {
 	remainReport := ue.EventSubscriptionsInfo[subscriptionId].RemainReports
 	if remainReport == nil {
 		return
 	}
 	*remainReport--
+
+	amfSelf := context.AMF_Self()
+	if subscription, ok := amfSelf.FindEventSubscription(subscriptionId); ok {
+		amfSelf.SaveEventSubscription(subscriptionId, subscription)
+	}
 }
 
-// DO NOT handle AmfEventType_PRESENCE_IN_AOI_REPORT and AmfEventType_UES_IN_AREA_REPORT(about area)
+// NewAmfEventReport builds the report of an event of the UE to a subscription; the presence of the UE
+// is evaluated in the areas of the PRESENCE_IN_AOI_REPORT and UES_IN_AREA_REPORT events
 func NewAmfEventReport(ue *context.AmfUe, Type models.AmfEventType, subscriptionId string) (
 	report models.AmfEventReport, ok bool) {
 	ueSubscription, ok := ue.EventSubscriptionsInfo[subscriptionId]
@@ -323,18 +678,20 @@ func NewAmfEventReport(ue *context.AmfUe, Type models.AmfEventType, subscription
 	report.AnyUe = ueSubscription.AnyUe
 	report.Supi = ue.Supi
 	report.Type = Type
-	report.TimeStamp = &ueSubscription.Timestamp
+	timeStamp := time.Now().UTC()
+	report.TimeStamp = &timeStamp
 	report.State = new(models.AmfEventState)
 	mode := ueSubscription.EventSubscription.Options
 	if mode == nil {
 		report.State.Active = true
 	} else if mode.Trigger == models.AmfEventTrigger_ONE_TIME {
 		report.State.Active = false
-	} else if *ueSubscription.RemainReports <= 0 {
+	} else if ueSubscription.RemainReports != nil && *ueSubscription.RemainReports <= 0 {
 		report.State.Active = false
 	} else {
 		report.State.Active = getDuration(mode.Expiry, &report.State.RemainDuration)
-		if report.State.Active {
+		// the number of reports is not limited when RemainReports is nil
+		if report.State.Active && ueSubscription.RemainReports != nil {
 			report.State.RemainReports = *ueSubscription.RemainReports
 		}
 	}
@@ -342,8 +699,16 @@ func NewAmfEventReport(ue *context.AmfUe, Type models.AmfEventType, subscription
 	switch Type {
 	case models.AmfEventType_LOCATION_REPORT:
 		report.Location = &ue.Location
-	// case models.AmfEventType_PRESENCE_IN_AOI_REPORT:
-	// report.AreaList = (*subscription.EventList)[eventIndex].AreaList
+	case models.AmfEventType_PRESENCE_IN_AOI_REPORT:
+		if event := subscribedEventOf(ueSubscription.EventSubscription, Type); event != nil {
+			report.AreaList, _ = ueSubscription.UpdatePresence(ue, Type, event.AreaList)
+		}
+	case models.AmfEventType_UES_IN_AREA_REPORT:
+		if event := subscribedEventOf(ueSubscription.EventSubscription, Type); event != nil {
+			ueSubscription.UpdatePresence(ue, Type, event.AreaList)
+			report.AreaList = event.AreaList
+			report.NumberOfUes = ueSubscription.NumberOfUesInArea()
+		}
 	case models.AmfEventType_TIMEZONE_REPORT:
 		report.Timezone = ue.TimeZone
 	case models.AmfEventType_ACCESS_TYPE_REPORT:
@@ -372,7 +737,9 @@ func NewAmfEventReport(ue *context.AmfUe, Type models.AmfEventType, subscription
 	case models.AmfEventType_SUBSCRIBED_DATA_REPORT:
 		report.SubscribedData = &ue.SubscribedData
 	case models.AmfEventType_COMMUNICATION_FAILURE_REPORT:
-		// TODO : report.CommFailure
+		report.CommFailure = ue.CommFailure
+	case models.AmfEventType_LOSS_OF_CONNECTIVITY:
+		report.LossOfConnectReason = ue.LossOfConnectReason
 	case models.AmfEventType_SUBSCRIPTION_ID_CHANGE:
 		report.SubscriptionId = subscriptionId
 	case models.AmfEventType_SUBSCRIPTION_ID_ADDITION:
@@ -0,0 +1,45 @@
+package producer
+
+import (
+	"free5gc/lib/openapi/models"
+	"free5gc/src/amf/context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestContinuousSubscriptionWithoutMaxReports(t *testing.T) {
+	amfSelf := context.AMF_Self()
+	plmnID := models.PlmnId{Mcc: "208", Mnc: "93"}
+	amfSelf.ServedGuamiList = []models.Guami{{PlmnId: &plmnID, AmfId: "cafe00"}}
+	ue := amfSelf.NewAmfUe("imsi-2089300007487")
+	defer ue.Remove()
+
+	// maxReports is absent, so the number of reports is not limited
+	subscription := &models.AmfEventSubscription{
+		EventList: &[]models.AmfEvent{
+			{Type: models.AmfEventType_LOCATION_REPORT, ImmediateFlag: true},
+		},
+		EventNotifyUri: "http://nef/notify",
+		Supi:           ue.Supi,
+		Options:        &models.AmfEventMode{Trigger: models.AmfEventTrigger_CONTINUOUS},
+	}
+	created, problemDetails := CreateAMFEventSubscriptionProcedure(
+		models.AmfCreateEventSubscription{Subscription: subscription})
+	require.Nil(t, problemDetails)
+	require.NotNil(t, created)
+	defer DeleteAMFEventSubscriptionProcedure(created.SubscriptionId)
+
+	require.Len(t, created.ReportList, 1)
+	assert.True(t, created.ReportList[0].State.Active)
+	assert.Equal(t, int32(0), created.ReportList[0].State.RemainReports)
+
+	ueSubscription := ue.EventSubscriptionsInfo[created.SubscriptionId]
+	require.NotNil(t, ueSubscription)
+	assert.Nil(t, ueSubscription.RemainReports)
+	report, ok := NewAmfEventReport(ue, models.AmfEventType_LOCATION_REPORT, created.SubscriptionId)
+	require.True(t, ok)
+	assert.True(t, report.State.Active)
+	assert.Equal(t, int32(0), report.State.RemainReports)
+}
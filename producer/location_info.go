@@ -3,11 +3,19 @@ package producer
 import (
 	"free5gc/lib/http_wrapper"
 	"free5gc/lib/openapi/models"
+	"free5gc/src/amf/consumer"
 	"free5gc/src/amf/context"
 	"free5gc/src/amf/logger"
+	ngap_message "free5gc/src/amf/ngap/message"
 	"net/http"
+	"time"
+
+	"github.com/google/uuid"
 )
 
+// currentLocationTimeout bounds the wait of the Location Report of a UE
+const currentLocationTimeout = 2 * time.Second
+
 func HandleProvideLocationInfoRequest(request *http_wrapper.Request) *http_wrapper.Response {
 	logger.ProducerLog.Info("Handle Provide Location Info Request")
 
@@ -48,7 +56,8 @@ func ProvideLocationInfoProcedure(requestLocInfo models.RequestLocInfo, ueContex
 
 	ranUe := ue.RanUe[anType]
 	if requestLocInfo.Req5gsLoc || requestLocInfo.ReqCurrentLoc {
-		provideLocInfo.CurrentLoc = true
+		// the last known location is provided when the NG-RAN does not report the current one
+		provideLocInfo.CurrentLoc = requestCurrentLocation(ue)
 		provideLocInfo.Location = &ue.Location
 	}
 
@@ -65,3 +74,223 @@ func ProvideLocationInfoProcedure(requestLocInfo models.RequestLocInfo, ueContex
 	}
 	return provideLocInfo, nil
 }
+
+// requestCurrentLocation asks the NG-RAN node serving the UE to report its location directly,
+// and tells if it was reported in time
+func requestCurrentLocation(ue *context.AmfUe) bool {
+	if !ue.CmConnect(models.AccessType__3_GPP_ACCESS) {
+		return false
+	}
+
+	id := uuid.New().String()
+	reporting := context.NewLocationReporting(context.LocationReportingDirect)
+	if !ngap_message.StartLocationReporting(ue, id, reporting) {
+		return false
+	}
+	defer ngap_message.StopLocationReporting(ue, id)
+
+	select {
+	case <-reporting.Reported():
+		return true
+	case <-time.After(currentLocationTimeout):
+		logger.ProducerLog.Warnf("UE[%s] location is not reported", ue.Supi)
+		return false
+	}
+}
+
+// TS 29.518 5.2.2.6.2
+func HandleProvidePositioningInfoRequest(request *http_wrapper.Request) *http_wrapper.Response {
+	logger.ProducerLog.Info("Handle Provide Positioning Info Request")
+
+	requestPosInfo := request.Body.(models.RequestPosInfo)
+	ueContextID := request.Params["ueContextId"]
+
+	providePosInfo, problemDetails := ProvidePositioningInfoProcedure(requestPosInfo, ueContextID)
+	if problemDetails != nil {
+		return http_wrapper.NewResponse(int(problemDetails.Status), nil, problemDetails)
+	} else {
+		return http_wrapper.NewResponse(http.StatusOK, nil, providePosInfo)
+	}
+}
+
+func ProvidePositioningInfoProcedure(requestPosInfo models.RequestPosInfo, ueContextID string) (
+	*models.ProvidePosInfo, *models.ProblemDetails) {
+	amfSelf := context.AMF_Self()
+
+	ue, ok := amfSelf.AmfUeFindByUeContextID(ueContextID)
+	if !ok {
+		problemDetails := &models.ProblemDetails{
+			Status: http.StatusNotFound,
+			Cause:  "CONTEXT_NOT_FOUND",
+		}
+		return nil, problemDetails
+	}
+
+	// the privacy of the UE only allows to notify it or to verify the request with it,
+	// which the AMF does not support (TS 23.273 6.1.2)
+	if requestPosInfo.LcsLocation == models.LocationType_NOTIFICATION_VERIFICATION_ONLY {
+		problemDetails := &models.ProblemDetails{
+			Status: http.StatusForbidden,
+			Cause:  "POSITIONING_DENIED",
+			Detail: "UE notification and verification are not supported",
+		}
+		return nil, problemDetails
+	}
+
+	lcsPrivacyData, problemDetails, err := consumer.SDMGetLcsPrivacyData(ue)
+	if err != nil {
+		logger.ProducerLog.Errorf("Get LCS privacy data error: %+v", err)
+		problemDetails := &models.ProblemDetails{
+			Status: http.StatusInternalServerError,
+			Cause:  "POSITIONING_FAILED",
+			Detail: err.Error(),
+		}
+		return nil, problemDetails
+	}
+	if problemDetails != nil {
+		logger.ProducerLog.Warnf("Get LCS privacy data failed: %+v", problemDetails)
+		return nil, problemDetails
+	}
+	if !positioningAllowed(lcsPrivacyData, requestPosInfo.LcsClientType) {
+		problemDetails := &models.ProblemDetails{
+			Status: http.StatusForbidden,
+			Cause:  "POSITIONING_DENIED",
+			Detail: "Positioning is not allowed by the LCS privacy of the UE",
+		}
+		return nil, problemDetails
+	}
+
+	// the LMF positions the UE through the NG-RAN
+	anType := models.AccessType__3_GPP_ACCESS
+	if !ue.State[anType].Is(context.Registered) {
+		problemDetails := &models.ProblemDetails{
+			Status: http.StatusGatewayTimeout,
+			Cause:  "UE_NOT_REACHABLE",
+		}
+		return nil, problemDetails
+	}
+
+	if ue.CmIdle(anType) {
+		if requestPosInfo.LcsLocation == models.LocationType_CURRENT_OR_LAST_KNOWN_LOCATION {
+			return lastKnownPosInfo(ue), nil
+		}
+		if !pageUe(ue, nil) {
+			problemDetails := &models.ProblemDetails{
+				Status: http.StatusGatewayTimeout,
+				Cause:  "UE_NOT_REACHABLE",
+			}
+			return nil, problemDetails
+		}
+	}
+
+	if ue.LmfUri == "" {
+		if err := consumer.SearchLmfLocationInstance(ue, amfSelf.NrfUri, models.NfType_LMF,
+			models.NfType_AMF, nil); err != nil {
+			logger.ProducerLog.Errorf("LMF selection error: %+v", err)
+			problemDetails := &models.ProblemDetails{
+				Status: http.StatusInternalServerError,
+				Cause:  "POSITIONING_FAILED",
+				Detail: err.Error(),
+			}
+			return nil, problemDetails
+		}
+	}
+
+	determineLocationRequest := consumer.DetermineLocationRequest{
+		ExternalClientType: requestPosInfo.LcsClientType,
+		CorrelationID:      uuid.New().String(),
+		AmfId:              amfSelf.NfId,
+		LocationQoS:        requestPosInfo.LcsQoS,
+		Supi:               ue.Supi,
+		Pei:                ue.Pei,
+		Gpsi:               ue.Gpsi,
+		Priority:           requestPosInfo.Priority,
+		VelocityRequested:  requestPosInfo.VelocityRequested,
+	}
+	if requestPosInfo.LcsSupportedGADShapes != "" {
+		determineLocationRequest.SupportedGADShapes = []models.SupportedGadShapes{requestPosInfo.LcsSupportedGADShapes}
+	}
+	if ue.Location.EutraLocation != nil {
+		determineLocationRequest.Ecgi = ue.Location.EutraLocation.Ecgi
+	}
+	if ue.Location.NrLocation != nil {
+		determineLocationRequest.Ncgi = ue.Location.NrLocation.Ncgi
+	}
+
+	locationData, problemDetails, err := consumer.SendDetermineLocation(ue, determineLocationRequest)
+	if err != nil {
+		logger.ProducerLog.Errorf("DetermineLocation error: %+v", err)
+		// the LMF is selected again for the next request
+		ue.LmfUri = ""
+		problemDetails := &models.ProblemDetails{
+			Status: http.StatusInternalServerError,
+			Cause:  "POSITIONING_FAILED",
+			Detail: err.Error(),
+		}
+		return nil, problemDetails
+	}
+	if problemDetails != nil {
+		logger.ProducerLog.Warnf("DetermineLocation failed: %+v", problemDetails)
+		return nil, problemDetails
+	}
+
+	providePosInfo := &models.ProvidePosInfo{
+		LocationEstimate:            locationData.LocationEstimate,
+		AccuracyFulfilmentIndicator: locationData.AccuracyFulfilmentIndicator,
+		AgeOfLocationEstimate:       locationData.AgeOfLocationEstimate,
+		VelocityEstimate:            locationData.VelocityEstimate,
+		CivicAddress:                locationData.CivicAddress,
+		PositioningDataList:         locationData.PositioningDataList,
+		GnssPositioningDataList:     locationData.GnssPositioningDataList,
+		Ecgi:                        locationData.Ecgi,
+		Ncgi:                        locationData.Ncgi,
+		Altitude:                    locationData.Altitude,
+		BarometricPressure:          locationData.BarometricPressure,
+	}
+	if providePosInfo.Ecgi == nil && providePosInfo.Ncgi == nil {
+		providePosInfo.Ecgi = determineLocationRequest.Ecgi
+		providePosInfo.Ncgi = determineLocationRequest.Ncgi
+	}
+	return providePosInfo, nil
+}
+
+// positioningAllowed checks the LCS privacy of the UE for a client (TS 23.273 5.4.2); the AMF cannot
+// notify the UE nor verify the request with it, so the privacy classes which require it deny the positioning.
+// A UE without LCS privacy data is not restricted.
+func positioningAllowed(lcsPrivacyData *consumer.LcsPrivacyData, clientType models.ExternalClientType) bool {
+	switch {
+	case lcsPrivacyData == nil:
+		return true
+	case clientType == models.ExternalClientType_EMERGENCY_SERVICES ||
+		clientType == models.ExternalClientType_LAWFUL_INTERCEPT_SERVICES:
+		// the privacy is overridden
+		return true
+	case lcsPrivacyData.Lpi != nil && lcsPrivacyData.Lpi.LocationPrivacyInd == consumer.LocationPrivacyIndDisallowed:
+		return false
+	}
+
+	switch clientType {
+	case models.ExternalClientType_PLMN_OPERATOR_SERVICES, models.ExternalClientType_PLMN_OPERATOR_BROADCAST_SERVICES,
+		models.ExternalClientType_PLMN_OPERATOR_OM, models.ExternalClientType_PLMN_OPERATOR_ANONYMOUS_STATISTICS,
+		models.ExternalClientType_PLMN_OPERATOR_TARGET_MS_SERVICE_SUPPORT:
+		return len(lcsPrivacyData.PlmnOperatorClasses) > 0
+	default:
+		return lcsPrivacyData.UnrelatedClass != nil &&
+			lcsPrivacyData.UnrelatedClass.DefaultUnrelatedClass.PrivacyCheckRelatedAction ==
+				consumer.PrivacyCheckLocationAllowedWithoutNotification
+	}
+}
+
+// lastKnownPosInfo returns the serving cell of the UE when it last was in CM-CONNECTED
+func lastKnownPosInfo(ue *context.AmfUe) *models.ProvidePosInfo {
+	providePosInfo := new(models.ProvidePosInfo)
+	if location := ue.Location.EutraLocation; location != nil {
+		providePosInfo.Ecgi = location.Ecgi
+		providePosInfo.AgeOfLocationEstimate = location.AgeOfLocationInformation
+	}
+	if location := ue.Location.NrLocation; location != nil {
+		providePosInfo.Ncgi = location.Ncgi
+		providePosInfo.AgeOfLocationEstimate = location.AgeOfLocationInformation
+	}
+	return providePosInfo
+}
@@ -2,10 +2,13 @@ package producer
 
 import (
 	"free5gc/lib/http_wrapper"
+	"free5gc/lib/ngap/ngapType"
 	"free5gc/lib/openapi/models"
 	"free5gc/src/amf/context"
 	"free5gc/src/amf/logger"
+	ngap_message "free5gc/src/amf/ngap/message"
 	"net/http"
+	"time"
 )
 
 func HandleProvideDomainSelectionInfoRequest(request *http_wrapper.Request) *http_wrapper.Response {
@@ -53,3 +56,98 @@ func ProvideDomainSelectionInfoProcedure(ueContextID string, infoClassQuery stri
 
 	return ueContextInfo, nil
 }
+
+// TS 29.518 5.4.2.2
+func HandleEnableUeReachabilityRequest(request *http_wrapper.Request) *http_wrapper.Response {
+	logger.MtLog.Info("Handle Enable Ue Reachability Request")
+
+	ueContextID := request.Params["ueContextId"]
+	enableUeReachabilityReqData := request.Body.(models.EnableUeReachabilityReqData)
+
+	enableUeReachabilityRspData, problemDetails := EnableUeReachabilityProcedure(ueContextID,
+		enableUeReachabilityReqData)
+	if problemDetails != nil {
+		return http_wrapper.NewResponse(int(problemDetails.Status), nil, problemDetails)
+	} else {
+		return http_wrapper.NewResponse(http.StatusOK, nil, enableUeReachabilityRspData)
+	}
+}
+
+// EnableUeReachabilityProcedure pages the UE in CM-IDLE over 3GPP access, and answers once it is
+// CM-CONNECTED or the paging is abandoned. A UE in a restricted service area is only reachable for
+// regulatory prioritized services, for which it is paged with the highest priority.
+func EnableUeReachabilityProcedure(ueContextID string, enableUeReachabilityReqData models.EnableUeReachabilityReqData) (
+	*models.EnableUeReachabilityRspData, *models.ProblemDetails) {
+	amfSelf := context.AMF_Self()
+
+	ue, ok := amfSelf.AmfUeFindByUeContextID(ueContextID)
+	if !ok {
+		problemDetails := &models.ProblemDetails{
+			Status: http.StatusNotFound,
+			Cause:  "CONTEXT_NOT_FOUND",
+		}
+		return nil, problemDetails
+	}
+
+	anType := models.AccessType__3_GPP_ACCESS
+	if !ue.State[anType].Is(context.Registered) {
+		problemDetails := &models.ProblemDetails{
+			Status: http.StatusGatewayTimeout,
+			Cause:  "UE_NOT_REACHABLE",
+		}
+		return nil, problemDetails
+	}
+
+	// a UE in MICO mode cannot be paged, not even for regulatory prioritized services (TS 23.501 5.4.1.3),
+	// but the AMF does not accept MICO mode at registration, so a registered UE is always paged
+	enableUeReachabilityRspData := new(models.EnableUeReachabilityRspData)
+	reachability := models.UeReachability_REACHABLE
+	if ue.InRestrictedServiceArea() {
+		reachability = models.UeReachability_REGULATORY_ONLY
+		if enableUeReachabilityReqData.Reachability != models.UeReachability_REGULATORY_ONLY {
+			enableUeReachabilityRspData.Reachability = reachability
+			return enableUeReachabilityRspData, nil
+		}
+	}
+
+	if !ue.CmConnect(anType) {
+		var pagingPriority *ngapType.PagingPriority
+		if enableUeReachabilityReqData.Reachability == models.UeReachability_REGULATORY_ONLY {
+			pagingPriority = &ngapType.PagingPriority{Value: ngapType.PagingPriorityPresentPriolevel1}
+		}
+		if !pageUe(ue, pagingPriority) {
+			logger.MtLog.Infof("UE[%s] does not answer the paging", ue.Supi)
+			reachability = models.UeReachability_UNREACHABLE
+		}
+	}
+	enableUeReachabilityRspData.Reachability = reachability
+	return enableUeReachabilityRspData, nil
+}
+
+// pageUe pages the UE in CM-IDLE over 3GPP access, unless it is already paged, and waits for it to
+// be CM-CONNECTED until the paging is abandoned at the last T3513 expiry
+func pageUe(ue *context.AmfUe, pagingPriority *ngapType.PagingPriority) bool {
+	anType := models.AccessType__3_GPP_ACCESS
+	pagingDone := ue.PagingDone()
+	if ue.CmConnect(anType) {
+		return true
+	}
+	if ue.T3513 == nil {
+		pkg, err := ngap_message.BuildPaging(ue, pagingPriority, false)
+		if err != nil {
+			logger.NgapLog.Errorf("Build Paging failed : %s", err.Error())
+			return false
+		}
+		ue.OnGoing[anType].Procedure = context.OnGoingProcedurePaging
+		ngap_message.SendPaging(ue, pkg)
+	}
+
+	// the wait is bounded, for a paging which is stopped by a new one
+	timer := time.NewTimer(pagingHoldTime)
+	defer timer.Stop()
+	select {
+	case <-pagingDone:
+	case <-timer.C:
+	}
+	return ue.CmConnect(anType)
+}
@@ -1,6 +1,7 @@
 package producer
 
 import (
+	"fmt"
 	"free5gc/lib/aper"
 	"free5gc/lib/http_wrapper"
 	"free5gc/lib/nas/nasMessage"
@@ -14,8 +15,12 @@ import (
 	"free5gc/src/amf/util"
 	"net/http"
 	"strconv"
+	"time"
 )
 
+// pagingHoldTime bounds how long a transfer requested while the UE is paged is held
+const pagingHoldTime = context.TimeT3513 * time.Duration(context.MaxT3513RetryTimes+1)
+
 // TS23502 4.2.3.3, 4.2.4.3, 4.3.2.2, 4.3.2.3, 4.3.3.2, 4.3.7
 func HandleN1N2MessageTransferRequest(request *http_wrapper.Request) *http_wrapper.Response {
 
@@ -32,6 +37,10 @@ func HandleN1N2MessageTransferRequest(request *http_wrapper.Request) *http_wrapp
 		switch n1n2MessageTransferRspData.Cause {
 		case models.N1N2MessageTransferCause_N1_MSG_NOT_TRANSFERRED:
 			fallthrough
+		case models.N1N2MessageTransferCause_N2_MSG_NOT_TRANSFERRED:
+			fallthrough
+		case models.N1N2MessageTransferCause_WAITING_FOR_ASYNCHRONOUS_TRANSFER:
+			fallthrough
 		case models.N1N2MessageTransferCause_N1_N2_TRANSFER_INITIATED:
 			return http_wrapper.NewResponse(http.StatusOK, nil, n1n2MessageTransferRspData)
 		case models.N1N2MessageTransferCause_ATTEMPTING_TO_REACH_UE:
@@ -84,31 +93,36 @@ func N1N2MessageTransferProcedure(ueContextID string, reqUri string,
 		return nil, "", problemDetails, nil
 	}
 
-	if requestData.N1MessageContainer != nil && requestData.N1MessageContainer.N1MessageClass == models.N1MessageClass_SM {
-		smContext = ue.SmContextList[requestData.PduSessionId]
-	}
-	if smContext == nil && requestData.N2InfoContainer != nil &&
-		requestData.N2InfoContainer.N2InformationClass == models.N2InformationClass_SM {
-		smContext = ue.SmContextList[requestData.PduSessionId]
-	}
-	if smContext != nil {
-		anType = smContext.PduSessionContext.AccessType
+	if requestData.N2InfoContainer != nil && !n2InformationClassSupported(requestData.N2InfoContainer.N2InformationClass) {
+		problemDetails = &models.ProblemDetails{
+			Status: http.StatusForbidden,
+			Cause:  "UNSPECIFIED",
+			Detail: fmt.Sprintf("N2 information class %s is not supported", requestData.N2InfoContainer.N2InformationClass),
+		}
+		return nil, "", problemDetails, nil
 	}
+
+	smContext, anType = n1n2MessageContext(ue, requestData)
 	onGoing := ue.OnGoing[anType]
+	// a transfer requested while the UE is paged is held until the UE answers the paging, unless
+	// it has a higher priority: the UE is paged again for it, and the ongoing one is held
+	holdUntilPaged := false
 	// TODO: Error Status 307, 403 in TS29.518 Table 6.1.3.5.3.1-3
 	if onGoing != nil {
 		switch onGoing.Procedure {
 		case context.OnGoingProcedurePaging:
+			if ue.T3513 == nil {
+				break
+			}
 			if requestData.Ppi == 0 || (onGoing.Ppi != 0 && onGoing.Ppi <= requestData.Ppi) {
-				transferErr = new(models.N1N2MessageTransferError)
-				transferErr.Error = &models.ProblemDetails{
-					Status: http.StatusConflict,
-					Cause:  "HIGHER_PRIORITY_REQUEST_ONGOING",
-				}
-				return n1n2MessageTransferRspData, locationHeader, problemDetails, transferErr
+				holdUntilPaged = true
+				break
 			}
 			util.StopT3513(ue)
-			callback.SendN1N2TransferFailureNotification(ue, models.N1N2MessageTransferCause_UE_NOT_RESPONDING)
+			if ue.N1N2Message != nil {
+				ue.HoldN1N2Message(ue.N1N2Message, pagingHoldTime, n1n2MessageExpired)
+				ue.N1N2Message = nil
+			}
 		case context.OnGoingProcedureN2Handover:
 			transferErr = new(models.N1N2MessageTransferError)
 			transferErr.Error = &models.ProblemDetails{
@@ -131,86 +145,24 @@ func N1N2MessageTransferProcedure(ueContextID string, reqUri string,
 		n1n2MessageTransferRspData = new(models.N1N2MessageTransferRspData)
 		n1n2MessageTransferRspData.Cause = models.N1N2MessageTransferCause_N1_N2_TRANSFER_INITIATED
 
-		if n2Info == nil {
-			switch requestData.N1MessageContainer.N1MessageClass {
-			case models.N1MessageClass_SM:
-				gmm_message.SendDLNASTransport(ue.RanUe[anType], nasMessage.PayloadContainerTypeN1SMInfo, n1Msg,
-					requestData.PduSessionId, 0, nil, 0)
-			case models.N1MessageClass_LPP:
-				gmm_message.SendDLNASTransport(ue.RanUe[anType], nasMessage.PayloadContainerTypeLPP, n1Msg, 0, 0, nil, 0)
-			case models.N1MessageClass_SMS:
-				gmm_message.SendDLNASTransport(ue.RanUe[anType], nasMessage.PayloadContainerTypeSMS, n1Msg, 0, 0, nil, 0)
-			case models.N1MessageClass_UPDP:
-				gmm_message.SendDLNASTransport(ue.RanUe[anType], nasMessage.PayloadContainerTypeUEPolicy, n1Msg, 0, 0, nil, 0)
-			}
-			return n1n2MessageTransferRspData, locationHeader, problemDetails, transferErr
+		if err := transferN1N2Message(ue, anType, smContext, n1n2MessageTransferRequest); err != nil {
+			logger.ProducerLog.Errorf("Transfer N1N2 message to UE[%s] error: %+v", ue.Supi, err)
+			n1n2MessageTransferRspData.Cause = models.N1N2MessageTransferCause_N2_MSG_NOT_TRANSFERRED
 		}
-		if smContext != nil {
-			smInfo := requestData.N2InfoContainer.SmInfo
-			switch smInfo.N2InfoContent.NgapIeType {
-			case models.NgapIeType_PDU_RES_SETUP_REQ:
-				logger.ProducerLog.Debugln("AMF Transfer NGAP PDU Resource Setup Req from SMF")
-				var nasPdu []byte
-				var err error
-				if n1Msg != nil {
-					pduSessionId := uint8(smInfo.PduSessionId)
-					nasPdu, err = gmm_message.BuildDLNASTransport(ue, nasMessage.PayloadContainerTypeN1SMInfo, n1Msg,
-						pduSessionId, nil, nil, 0)
-					if err != nil {
-						logger.HttpLog.Errorln(err.Error())
-					}
-				}
-
-				if ue.RanUe[anType].SentInitialContextSetupRequest {
-					list := ngapType.PDUSessionResourceSetupListSUReq{}
-					ngap_message.AppendPDUSessionResourceSetupListSUReq(&list, smInfo.PduSessionId, *smInfo.SNssai, nasPdu, n2Info)
-					ngap_message.SendPDUSessionResourceSetupRequest(ue.RanUe[anType], nil, list)
-				} else {
-					list := ngapType.PDUSessionResourceSetupListCxtReq{}
-					ngap_message.AppendPDUSessionResourceSetupListCxtReq(&list, smInfo.PduSessionId, *smInfo.SNssai, nil, n2Info)
-					ngap_message.SendInitialContextSetupRequest(ue, anType, nasPdu, &list, nil, nil, nil)
-					ue.RanUe[anType].SentInitialContextSetupRequest = true
-				}
+		return n1n2MessageTransferRspData, locationHeader, problemDetails, transferErr
+	}
 
-			case models.NgapIeType_PDU_RES_MOD_REQ:
-				logger.ProducerLog.Debugln("AMF Transfer NGAP PDU Resource Modify Req from SMF")
-				var nasPdu []byte
-				var err error
-				if n1Msg != nil {
-					pduSessionId := uint8(smInfo.PduSessionId)
-					nasPdu, err = gmm_message.BuildDLNASTransport(ue, nasMessage.PayloadContainerTypeN1SMInfo,
-						n1Msg, pduSessionId, nil, nil, 0)
-					if err != nil {
-						logger.HttpLog.Errorln(err.Error())
-					}
-				}
-				list := ngapType.PDUSessionResourceModifyListModReq{}
-				ngap_message.AppendPDUSessionResourceModifyListModReq(&list, smInfo.PduSessionId, nasPdu, n2Info)
-				ngap_message.SendPDUSessionResourceModifyRequest(ue.RanUe[anType], list)
-
-			case models.NgapIeType_PDU_RES_REL_CMD:
-				logger.ProducerLog.Debugln("AMF Transfer NGAP PDU Resource Rel CMD from SMF")
-				var nasPdu []byte
-				var err error
-				if n1Msg != nil {
-					pduSessionId := uint8(smInfo.PduSessionId)
-					nasPdu, err = gmm_message.BuildDLNASTransport(ue, nasMessage.PayloadContainerTypeN1SMInfo,
-						n1Msg, pduSessionId, nil, nil, 0)
-					if err != nil {
-						logger.HttpLog.Errorln(err.Error())
-					}
-				}
-				list := ngapType.PDUSessionResourceToReleaseListRelCmd{}
-				ngap_message.AppendPDUSessionResourceToReleaseListRelCmd(&list, smInfo.PduSessionId, n2Info)
-				ngap_message.SendPDUSessionResourceReleaseCommand(ue.RanUe[anType], nasPdu, list)
-			}
+	// 409: transfer a N2 NRPPa PDU to a 5G-AN and if the UE is in CM-IDLE, the LMF positions
+	// CM-CONNECTED UEs only (TS 23.273 6.11.1)
+	if requestData.N2InfoContainer != nil &&
+		requestData.N2InfoContainer.N2InformationClass == models.N2InformationClass_NRP_PA {
+		transferErr = new(models.N1N2MessageTransferError)
+		transferErr.Error = &models.ProblemDetails{
+			Status: http.StatusConflict,
+			Cause:  "UE_IN_CM_IDLE_STATE",
 		}
-		//else {
-		//TODO: send n2 info for non pdu session case
-		//}
 		return n1n2MessageTransferRspData, locationHeader, problemDetails, transferErr
 	}
-
 	// 409: transfer a N2 PDU Session Resource Release Command to a 5G-AN and if the UE is in CM-IDLE
 	if smContext != nil && n2Info != nil &&
 		requestData.N2InfoContainer.SmInfo.N2InfoContent.NgapIeType == models.NgapIeType_PDU_RES_REL_CMD {
@@ -249,6 +201,31 @@ func N1N2MessageTransferProcedure(ueContextID string, reqUri string,
 	}
 	locationHeader = context.AMF_Self().GetIPv4Uri() + reqUri + "/" + strconv.Itoa(int(n1n2MessageID))
 
+	// a transfer to a UE which does not answer the paging is held until it contacts the network again,
+	// at the latest at the expiry of its mobile reachable timer
+	if !(requestData.SkipInd && n2Info == nil) {
+		var holdTime time.Duration
+		switch {
+		case holdUntilPaged:
+			n1n2MessageTransferRspData.Cause = models.N1N2MessageTransferCause_ATTEMPTING_TO_REACH_UE
+			holdTime = pagingHoldTime
+		case ue.Reachability == models.UeReachability_UNREACHABLE:
+			n1n2MessageTransferRspData.Cause = models.N1N2MessageTransferCause_WAITING_FOR_ASYNCHRONOUS_TRANSFER
+			holdTime = ue.MobileReachableTime()
+		}
+		if holdTime > 0 {
+			message := context.N1N2Message{
+				Request:     n1n2MessageTransferRequest,
+				Status:      n1n2MessageTransferRspData.Cause,
+				ResourceUri: locationHeader,
+				ID:          n1n2MessageID,
+			}
+			ue.HoldN1N2Message(&message, holdTime, n1n2MessageExpired)
+			logger.ProducerLog.Infof("Hold N1N2 message transfer[%s] for UE[%s]", locationHeader, ue.Supi)
+			return n1n2MessageTransferRspData, locationHeader, problemDetails, transferErr
+		}
+	}
+
 	// Case A (UE is CM-IDLE in 3GPP access and the associated access type is 3GPP access)
 	// in subclause 5.2.2.3.1.2 of TS29518
 	if anType == models.AccessType__3_GPP_ACCESS {
@@ -260,6 +237,7 @@ func N1N2MessageTransferProcedure(ueContextID string, reqUri string,
 				Request:     n1n2MessageTransferRequest,
 				Status:      n1n2MessageTransferRspData.Cause,
 				ResourceUri: locationHeader,
+				ID:          n1n2MessageID,
 			}
 			ue.N1N2Message = &message
 			onGoing.Procedure = context.OnGoingProcedurePaging
@@ -275,7 +253,6 @@ func N1N2MessageTransferProcedure(ueContextID string, reqUri string,
 			}
 			ngap_message.SendPaging(ue, pkg)
 		}
-		// TODO: WAITING_FOR_ASYNCHRONOUS_TRANSFER
 		return n1n2MessageTransferRspData, locationHeader, problemDetails, transferErr
 	}
 	// Case B (UE is CM-IDLE in Non-3GPP access but CM-CONNECTED in 3GPP access and the associated
@@ -291,6 +268,7 @@ func N1N2MessageTransferProcedure(ueContextID string, reqUri string,
 				Request:     n1n2MessageTransferRequest,
 				Status:      n1n2MessageTransferRspData.Cause,
 				ResourceUri: locationHeader,
+				ID:          n1n2MessageID,
 			}
 			ue.N1N2Message = &message
 			nasMsg, err := gmm_message.BuildNotification(ue, models.AccessType_NON_3_GPP_ACCESS)
@@ -309,6 +287,7 @@ func N1N2MessageTransferProcedure(ueContextID string, reqUri string,
 		Request:     n1n2MessageTransferRequest,
 		Status:      n1n2MessageTransferRspData.Cause,
 		ResourceUri: locationHeader,
+		ID:          n1n2MessageID,
 	}
 	ue.N1N2Message = &message
 
@@ -326,6 +305,191 @@ func N1N2MessageTransferProcedure(ueContextID string, reqUri string,
 	return n1n2MessageTransferRspData, locationHeader, problemDetails, transferErr
 }
 
+// n1n2MessageContext returns the SM context of the PDU session of a transfer, if any, and the
+// access type of the transfer
+func n1n2MessageContext(ue *context.AmfUe, requestData *models.N1N2MessageTransferReqData) (
+	smContext *context.SmContext, anType models.AccessType) {
+	anType = models.AccessType__3_GPP_ACCESS
+	if requestData.N1MessageContainer != nil && requestData.N1MessageContainer.N1MessageClass == models.N1MessageClass_SM {
+		smContext = ue.SmContextList[requestData.PduSessionId]
+	}
+	if smContext == nil && requestData.N2InfoContainer != nil &&
+		requestData.N2InfoContainer.N2InformationClass == models.N2InformationClass_SM {
+		smContext = ue.SmContextList[requestData.PduSessionId]
+	}
+	if smContext != nil {
+		anType = smContext.PduSessionContext.AccessType
+	}
+	return smContext, anType
+}
+
+// TransferPendingN1N2Messages transfers the N1N2 messages held for a UE which is CM-CONNECTED again;
+// the transfers in an access where the UE is still CM-IDLE fail
+func TransferPendingN1N2Messages(ue *context.AmfUe) {
+	for _, message := range ue.TakePendingN1N2Messages() {
+		smContext, anType := n1n2MessageContext(ue, message.Request.JsonData)
+		if !ue.CmConnect(anType) {
+			callback.SendHeldN1N2TransferFailureNotification(message, models.N1N2MessageTransferCause_UE_NOT_RESPONDING)
+			continue
+		}
+		logger.ProducerLog.Infof("Transfer held N1N2 message[%s] to UE[%s]", message.ResourceUri, ue.Supi)
+		if err := transferN1N2Message(ue, anType, smContext, message.Request); err != nil {
+			logger.ProducerLog.Errorf("Transfer held N1N2 message[%s] error: %+v", message.ResourceUri, err)
+			callback.SendHeldN1N2TransferFailureNotification(message,
+				models.N1N2MessageTransferCause_N2_MSG_NOT_TRANSFERRED)
+		}
+	}
+}
+
+// n1n2MessageExpired notifies the failure of a held transfer which expired
+func n1n2MessageExpired(message *context.N1N2Message) {
+	logger.ProducerLog.Infof("N1N2 message transfer[%s] expired", message.ResourceUri)
+	callback.SendHeldN1N2TransferFailureNotification(message, models.N1N2MessageTransferCause_UE_NOT_RESPONDING)
+}
+
+// transferN1N2Message transfers the N1 message and N2 information of a request to the UE, which is
+// CM-CONNECTED in anType
+func transferN1N2Message(ue *context.AmfUe, anType models.AccessType, smContext *context.SmContext,
+	n1n2MessageTransferRequest models.N1N2MessageTransferRequest) error {
+	requestData := n1n2MessageTransferRequest.JsonData
+	n2Info := n1n2MessageTransferRequest.BinaryDataN2Information
+	n1Msg := n1n2MessageTransferRequest.BinaryDataN1Message
+
+	if n2Info == nil {
+		sendN1Message(ue.RanUe[anType], requestData, n1Msg)
+		return nil
+	}
+	if smContext != nil {
+		smInfo := requestData.N2InfoContainer.SmInfo
+		switch smInfo.N2InfoContent.NgapIeType {
+		case models.NgapIeType_PDU_RES_SETUP_REQ:
+			logger.ProducerLog.Debugln("AMF Transfer NGAP PDU Resource Setup Req from SMF")
+			var nasPdu []byte
+			var err error
+			if n1Msg != nil {
+				pduSessionId := uint8(smInfo.PduSessionId)
+				nasPdu, err = gmm_message.BuildDLNASTransport(ue, nasMessage.PayloadContainerTypeN1SMInfo, n1Msg,
+					pduSessionId, nil, nil, 0)
+				if err != nil {
+					logger.HttpLog.Errorln(err.Error())
+				}
+			}
+
+			if ue.RanUe[anType].SentInitialContextSetupRequest {
+				list := ngapType.PDUSessionResourceSetupListSUReq{}
+				ngap_message.AppendPDUSessionResourceSetupListSUReq(&list, smInfo.PduSessionId, *smInfo.SNssai, nasPdu, n2Info)
+				ngap_message.SendPDUSessionResourceSetupRequest(ue.RanUe[anType], nil, list)
+			} else {
+				list := ngapType.PDUSessionResourceSetupListCxtReq{}
+				ngap_message.AppendPDUSessionResourceSetupListCxtReq(&list, smInfo.PduSessionId, *smInfo.SNssai, nil, n2Info)
+				ngap_message.SendInitialContextSetupRequest(ue, anType, nasPdu, &list, nil, nil, nil)
+				ue.RanUe[anType].SentInitialContextSetupRequest = true
+			}
+
+		case models.NgapIeType_PDU_RES_MOD_REQ:
+			logger.ProducerLog.Debugln("AMF Transfer NGAP PDU Resource Modify Req from SMF")
+			var nasPdu []byte
+			var err error
+			if n1Msg != nil {
+				pduSessionId := uint8(smInfo.PduSessionId)
+				nasPdu, err = gmm_message.BuildDLNASTransport(ue, nasMessage.PayloadContainerTypeN1SMInfo,
+					n1Msg, pduSessionId, nil, nil, 0)
+				if err != nil {
+					logger.HttpLog.Errorln(err.Error())
+				}
+			}
+			list := ngapType.PDUSessionResourceModifyListModReq{}
+			ngap_message.AppendPDUSessionResourceModifyListModReq(&list, smInfo.PduSessionId, nasPdu, n2Info)
+			ngap_message.SendPDUSessionResourceModifyRequest(ue.RanUe[anType], list)
+
+		case models.NgapIeType_PDU_RES_REL_CMD:
+			logger.ProducerLog.Debugln("AMF Transfer NGAP PDU Resource Rel CMD from SMF")
+			var nasPdu []byte
+			var err error
+			if n1Msg != nil {
+				pduSessionId := uint8(smInfo.PduSessionId)
+				nasPdu, err = gmm_message.BuildDLNASTransport(ue, nasMessage.PayloadContainerTypeN1SMInfo,
+					n1Msg, pduSessionId, nil, nil, 0)
+				if err != nil {
+					logger.HttpLog.Errorln(err.Error())
+				}
+			}
+			list := ngapType.PDUSessionResourceToReleaseListRelCmd{}
+			ngap_message.AppendPDUSessionResourceToReleaseListRelCmd(&list, smInfo.PduSessionId, n2Info)
+			ngap_message.SendPDUSessionResourceReleaseCommand(ue.RanUe[anType], nasPdu, list)
+		}
+		return nil
+	}
+	if n1Msg != nil && requestData.N1MessageContainer != nil {
+		sendN1Message(ue.RanUe[anType], requestData, n1Msg)
+	}
+	return transferN2Information(ue.RanUe[anType], requestData.N2InfoContainer, n2Info)
+}
+
+// sendN1Message sends the N1 message of a transfer to the UE in a DL NAS Transport
+func sendN1Message(ranUe *context.RanUe, requestData *models.N1N2MessageTransferReqData, n1Msg []byte) {
+	switch requestData.N1MessageContainer.N1MessageClass {
+	case models.N1MessageClass_SM:
+		gmm_message.SendDLNASTransport(ranUe, nasMessage.PayloadContainerTypeN1SMInfo, n1Msg,
+			requestData.PduSessionId, 0, nil, 0)
+	case models.N1MessageClass_LPP:
+		gmm_message.SendDLNASTransport(ranUe, nasMessage.PayloadContainerTypeLPP, n1Msg, 0, 0, nil, 0)
+	case models.N1MessageClass_SMS:
+		gmm_message.SendDLNASTransport(ranUe, nasMessage.PayloadContainerTypeSMS, n1Msg, 0, 0, nil, 0)
+	case models.N1MessageClass_UPDP:
+		gmm_message.SendDLNASTransport(ranUe, nasMessage.PayloadContainerTypeUEPolicy, n1Msg, 0, 0, nil, 0)
+	}
+}
+
+// n2InformationClassSupported reports whether the N2 information of a class can be transferred to a UE;
+// the LCS positioning information of an LMF is carried by the NRPPa class
+func n2InformationClassSupported(n2InformationClass models.N2InformationClass) bool {
+	switch n2InformationClass {
+	case models.N2InformationClass_SM, models.N2InformationClass_NRP_PA,
+		models.N2InformationClass_RAN, models.N2InformationClass_PWS:
+		return true
+	}
+	return false
+}
+
+// transferN2Information sends the non SM N2 information of a transfer to the NG-RAN node serving the UE,
+// by the NGAP procedure of its class
+func transferN2Information(ranUe *context.RanUe, n2InfoContainer *models.N2InfoContainer, n2Info []byte) error {
+	if n2InfoContainer == nil {
+		return fmt.Errorf("N2 information container is missing")
+	}
+	if ranUe == nil || ranUe.Ran == nil {
+		return fmt.Errorf("UE is not connected to an NG-RAN node")
+	}
+
+	switch n2InfoContainer.N2InformationClass {
+	case models.N2InformationClass_NRP_PA:
+		// TS 23.502 4.13.5.5: the NRPPa PDU of the LMF is sent to the serving NG-RAN node
+		if nrppaInfo := n2InfoContainer.NrppaInfo; nrppaInfo != nil {
+			ranUe.RoutingID = context.LmfRoutingID(nrppaInfo.NfId)
+		}
+		ngap_message.SendDownlinkUEAssociatedNRPPaTransport(ranUe, ngapType.NRPPaPDU{Value: n2Info})
+	case models.N2InformationClass_RAN:
+		// TS 38.413 8.16.2: the SON configuration is sent by a Downlink RAN Configuration Transfer
+		var transfer ngapType.SONConfigurationTransfer
+		if err := aper.UnmarshalWithParams(n2Info, &transfer, "valueExt"); err != nil {
+			return fmt.Errorf("Decode SON Configuration Transfer error: %+v", err)
+		}
+		ngap_message.SendDownlinkRanConfigurationTransfer(ranUe.Ran, &transfer)
+	case models.N2InformationClass_PWS:
+		// TS 23.041 9.1.3.5: the Write-Replace Warning or PWS Cancel Request is sent to the serving NG-RAN node
+		key, err := pwsTransactionKeyOf(n2Info)
+		if err != nil {
+			return err
+		}
+		pwsInfo := n2InfoContainer.PwsInfo
+		sendPwsMessage(key, []*context.AmfRan{ranUe.Ran}, n2Info, pwsInfo != nil && pwsInfo.SendRanResponse)
+	default:
+		return fmt.Errorf("N2 information class %s is not supported", n2InfoContainer.N2InformationClass)
+	}
+	return nil
+}
+
 func HandleN1N2MessageTransferStatusRequest(request *http_wrapper.Request) *http_wrapper.Response {
 	logger.CommLog.Info("Handle N1N2Message Transfer Status Request")
 
@@ -354,8 +518,8 @@ func N1N2MessageTransferStatusProcedure(ueContextID string, reqUri string) (mode
 	}
 
 	resourceUri := amfSelf.GetIPv4Uri() + reqUri
-	n1n2Message := ue.N1N2Message
-	if n1n2Message == nil || n1n2Message.ResourceUri != resourceUri {
+	n1n2Message, ok := ue.FindN1N2Message(resourceUri)
+	if !ok {
 		problemDetails := &models.ProblemDetails{
 			Status: http.StatusNotFound,
 			Cause:  "CONTEXT_NOT_FOUND",
@@ -0,0 +1,462 @@
+package producer
+
+import (
+	"fmt"
+	"free5gc/lib/http_wrapper"
+	libngap "free5gc/lib/ngap"
+	"free5gc/lib/ngap/ngapType"
+	"free5gc/lib/openapi/models"
+	"free5gc/src/amf/context"
+	"free5gc/src/amf/logger"
+	ngap_message "free5gc/src/amf/ngap/message"
+	"free5gc/src/amf/producer/callback"
+	"net/http"
+	"reflect"
+	"time"
+)
+
+// time the AMF waits for the RANs to respond to a Write-Replace Warning or PWS Cancel Request
+const pwsResponseTimeout = 10 * time.Second
+
+// TS 29.518 5.2.2.4.1
+func HandleNonUeN2MessageTransferRequest(request *http_wrapper.Request) *http_wrapper.Response {
+	logger.CommLog.Info("Handle Non Ue N2 Message Transfer Request")
+
+	nonUeN2MessageTransferRequest := request.Body.(models.NonUeN2MessageTransferRequest)
+
+	n2InformationTransferRspData, problemDetails := NonUeN2MessageTransferProcedure(nonUeN2MessageTransferRequest)
+	if problemDetails != nil {
+		return http_wrapper.NewResponse(int(problemDetails.Status), nil, problemDetails)
+	} else {
+		return http_wrapper.NewResponse(http.StatusOK, nil, n2InformationTransferRspData)
+	}
+}
+
+func NonUeN2MessageTransferProcedure(nonUeN2MessageTransferRequest models.NonUeN2MessageTransferRequest) (
+	*models.N2InformationTransferRspData, *models.ProblemDetails) {
+	requestData := nonUeN2MessageTransferRequest.JsonData
+	n2Info := nonUeN2MessageTransferRequest.BinaryDataN2Information
+
+	if requestData == nil || requestData.N2Information == nil || n2Info == nil {
+		problemDetails := &models.ProblemDetails{
+			Status: http.StatusBadRequest,
+			Cause:  "MANDATORY_IE_MISSING",
+		}
+		return nil, problemDetails
+	}
+
+	switch requestData.N2Information.N2InformationClass {
+	case models.N2InformationClass_PWS:
+		return pwsMessageTransfer(requestData, n2Info)
+	case models.N2InformationClass_NRP_PA:
+		return nrppaMessageTransfer(requestData, n2Info)
+	default:
+		problemDetails := &models.ProblemDetails{
+			Status: http.StatusForbidden,
+			Cause:  "UNSPECIFIED",
+			Detail: fmt.Sprintf("N2 information class %s is not supported",
+				requestData.N2Information.N2InformationClass),
+		}
+		return nil, problemDetails
+	}
+}
+
+// pwsMessageTransfer sends a Write-Replace Warning or PWS Cancel Request of the CBCF to
+// the RANs of the warning area (TS 23.041 9.1.3.5)
+func pwsMessageTransfer(requestData *models.N2InformationTransferReqData, n2Info []byte) (
+	*models.N2InformationTransferRspData, *models.ProblemDetails) {
+	pwsInfo := requestData.N2Information.PwsInfo
+	if pwsInfo == nil {
+		problemDetails := &models.ProblemDetails{
+			Status: http.StatusBadRequest,
+			Cause:  "MANDATORY_IE_MISSING",
+			Detail: "PWS information is missing",
+		}
+		return nil, problemDetails
+	}
+
+	key, err := pwsTransactionKeyOf(n2Info)
+	if err != nil {
+		logger.CommLog.Errorf("PWS N2 information error: %+v", err)
+		problemDetails := &models.ProblemDetails{
+			Status: http.StatusBadRequest,
+			Cause:  "INVALID_MSG_FORMAT",
+			Detail: err.Error(),
+		}
+		return nil, problemDetails
+	}
+
+	rans, unknownTaiList := pwsTargetRans(requestData)
+	sendPwsMessage(key, rans, n2Info, pwsInfo.SendRanResponse)
+
+	n2InformationTransferRspData := &models.N2InformationTransferRspData{
+		Result: models.N2InformationTransferResult_N2_INFO_TRANSFER_INITIATED,
+		PwsRspData: &models.PwsResponseData{
+			NgapMessageType:   int32(key.ProcedureCode),
+			SerialNumber:      key.SerialNumber,
+			MessageIdentifier: key.MessageIdentifier,
+			UnknownTaiList:    unknownTaiList,
+		},
+	}
+	return n2InformationTransferRspData, nil
+}
+
+// sendPwsMessage sends a PWS message to the RANs, and collects their responses until all of them
+// responded or pwsResponseTimeout; the responses are reported if sendRanResponse is set
+func sendPwsMessage(key context.PwsTransactionKey, rans []*context.AmfRan, n2Info []byte, sendRanResponse bool) {
+	amfSelf := context.AMF_Self()
+	transaction := amfSelf.NewPwsTransaction(key, rans)
+	for _, ran := range rans {
+		if err := ngap_message.SendToRan(ran, n2Info); err != nil {
+			logger.CommLog.Errorf("Send PWS message to RAN[%s] error: %+v", ran.Name, err)
+		}
+	}
+	logger.CommLog.Infof("PWS message[%d] with message identifier[%d] serial number[%d] sent to %d RANs",
+		key.ProcedureCode, key.MessageIdentifier, key.SerialNumber, len(rans))
+
+	go func() {
+		select {
+		case <-transaction.Done():
+		case <-time.After(pwsResponseTimeout):
+			logger.CommLog.Warnf("PWS message[%d] with message identifier[%d] serial number[%d]: "+
+				"RAN responses timed out", key.ProcedureCode, key.MessageIdentifier, key.SerialNumber)
+		}
+		amfSelf.DeletePwsTransaction(transaction)
+		if sendRanResponse {
+			reportPwsResponses(key, transaction.Responses())
+		}
+	}()
+}
+
+// nrppaMessageTransfer sends a non UE associated NRPPa PDU of an LMF to the NG-RAN nodes
+// listed in the request (TS 23.502 4.13.5.6)
+func nrppaMessageTransfer(requestData *models.N2InformationTransferReqData, n2Info []byte) (
+	*models.N2InformationTransferRspData, *models.ProblemDetails) {
+	nrppaInfo := requestData.N2Information.NrppaInfo
+	if nrppaInfo == nil || len(requestData.GlobalRanNodeList) == 0 {
+		problemDetails := &models.ProblemDetails{
+			Status: http.StatusBadRequest,
+			Cause:  "MANDATORY_IE_MISSING",
+			Detail: "NRPPa information or the target NG-RAN nodes are missing",
+		}
+		return nil, problemDetails
+	}
+
+	routingID := context.LmfRoutingID(nrppaInfo.NfId)
+	sent := 0
+	context.AMF_Self().AmfRanPool.Range(func(key, value interface{}) bool {
+		ran := value.(*context.AmfRan)
+		if ran.RanId == nil {
+			return true
+		}
+		for _, globalRanNodeId := range requestData.GlobalRanNodeList {
+			if reflect.DeepEqual(globalRanNodeId, *ran.RanId) {
+				ngap_message.SendDownlinkNonUEAssociatedNRPPATransport(ran, routingID, ngapType.NRPPaPDU{Value: n2Info})
+				sent++
+				break
+			}
+		}
+		return true
+	})
+	if sent == 0 {
+		problemDetails := &models.ProblemDetails{
+			Status: http.StatusNotFound,
+			Cause:  "UNSPECIFIED",
+			Detail: "None of the target NG-RAN nodes is connected",
+		}
+		return nil, problemDetails
+	}
+
+	n2InformationTransferRspData := &models.N2InformationTransferRspData{
+		Result: models.N2InformationTransferResult_N2_INFO_TRANSFER_INITIATED,
+	}
+	return n2InformationTransferRspData, nil
+}
+
+// pwsTransactionKeyOf decodes a Write-Replace Warning or PWS Cancel Request
+func pwsTransactionKeyOf(n2Info []byte) (key context.PwsTransactionKey, err error) {
+	pdu, err := libngap.Decoder(n2Info)
+	if err != nil {
+		return key, err
+	}
+	initiatingMessage := pdu.InitiatingMessage
+	if pdu.Present != ngapType.NGAPPDUPresentInitiatingMessage || initiatingMessage == nil {
+		return key, fmt.Errorf("PWS N2 information is not an NGAP request")
+	}
+
+	var messageIdentifier *ngapType.MessageIdentifier
+	var serialNumber *ngapType.SerialNumber
+	switch initiatingMessage.ProcedureCode.Value {
+	case ngapType.ProcedureCodeWriteReplaceWarning:
+		request := initiatingMessage.Value.WriteReplaceWarningRequest
+		if request == nil {
+			return key, fmt.Errorf("Write-Replace Warning Request is empty")
+		}
+		for _, ie := range request.ProtocolIEs.List {
+			switch ie.Id.Value {
+			case ngapType.ProtocolIEIDMessageIdentifier:
+				messageIdentifier = ie.Value.MessageIdentifier
+			case ngapType.ProtocolIEIDSerialNumber:
+				serialNumber = ie.Value.SerialNumber
+			}
+		}
+	case ngapType.ProcedureCodePWSCancel:
+		request := initiatingMessage.Value.PWSCancelRequest
+		if request == nil {
+			return key, fmt.Errorf("PWS Cancel Request is empty")
+		}
+		for _, ie := range request.ProtocolIEs.List {
+			switch ie.Id.Value {
+			case ngapType.ProtocolIEIDMessageIdentifier:
+				messageIdentifier = ie.Value.MessageIdentifier
+			case ngapType.ProtocolIEIDSerialNumber:
+				serialNumber = ie.Value.SerialNumber
+			}
+		}
+	default:
+		return key, fmt.Errorf("NGAP procedure[%d] is not a PWS procedure", initiatingMessage.ProcedureCode.Value)
+	}
+	if messageIdentifier == nil || serialNumber == nil {
+		return key, fmt.Errorf("Message Identifier or Serial Number is missing")
+	}
+	return context.NewPwsTransactionKey(initiatingMessage.ProcedureCode.Value, messageIdentifier, serialNumber), nil
+}
+
+// pwsTargetRans returns the RANs of the warning area, which are the RANs listed in the request,
+// or the RANs supporting one of the listed TAIs, or else all the RANs; the listed TAIs
+// supported by no RAN are returned as unknown
+func pwsTargetRans(requestData *models.N2InformationTransferReqData) (
+	rans []*context.AmfRan, unknownTaiList []models.Tai) {
+	knownTais := make(map[int]bool)
+	context.AMF_Self().AmfRanPool.Range(func(key, value interface{}) bool {
+		ran := value.(*context.AmfRan)
+		if !ran.Admitted {
+			return true
+		}
+
+		switch {
+		case len(requestData.GlobalRanNodeList) > 0:
+			for _, globalRanNodeId := range requestData.GlobalRanNodeList {
+				if ran.RanId != nil && reflect.DeepEqual(globalRanNodeId, *ran.RanId) {
+					rans = append(rans, ran)
+					break
+				}
+			}
+		case len(requestData.TaiList) > 0:
+			supportedTais := make([]models.Tai, 0, len(ran.SupportedTAList))
+			for _, supportedTAI := range ran.SupportedTAList {
+				supportedTais = append(supportedTais, supportedTAI.Tai)
+			}
+			selected := false
+			for i, tai := range requestData.TaiList {
+				if context.InTaiList(tai, supportedTais) {
+					knownTais[i] = true
+					selected = true
+				}
+			}
+			if selected {
+				rans = append(rans, ran)
+			}
+		default:
+			rans = append(rans, ran)
+		}
+		return true
+	})
+
+	if len(requestData.GlobalRanNodeList) == 0 {
+		for i, tai := range requestData.TaiList {
+			if !knownTais[i] {
+				unknownTaiList = append(unknownTaiList, tai)
+			}
+		}
+	}
+	return
+}
+
+// reportPwsResponses reports the responses of the RANs to the PWS-BCAL subscribers as a
+// single response, whose Broadcast Completed or Cancelled Area List merges the RAN ones
+func reportPwsResponses(key context.PwsTransactionKey, responses []context.PwsResponse) {
+	if len(responses) == 0 {
+		logger.CommLog.Warnf("PWS message[%d] with message identifier[%d] serial number[%d]: no RAN response",
+			key.ProcedureCode, key.MessageIdentifier, key.SerialNumber)
+		return
+	}
+
+	pdu := responses[0].Pdu
+	for _, response := range responses[1:] {
+		mergePwsAreaList(pdu, response.Pdu)
+	}
+
+	n2Info, err := libngap.Encoder(*pdu)
+	if err != nil {
+		logger.CommLog.Errorf("libngap Encoder Error: %+v", err)
+		return
+	}
+
+	n2InfoContainer := models.N2InfoContainer{
+		N2InformationClass: models.N2InformationClass_PWS_BCAL,
+		PwsInfo: &models.PwsInformation{
+			MessageIdentifier: key.MessageIdentifier,
+			SerialNumber:      key.SerialNumber,
+			PwsContainer: &models.N2InfoContent{
+				NgapMessageType: int32(key.ProcedureCode),
+				NgapData: &models.RefToBinaryData{
+					ContentId: "n2Info",
+				},
+			},
+		},
+	}
+	callback.SendNonUeN2InfoNotify(n2InfoContainer, nil, n2Info)
+}
+
+// mergePwsAreaList appends the Broadcast Completed or Cancelled Area List of the response
+// src to the one of the response dst
+func mergePwsAreaList(dst, src *ngapType.NGAPPDU) {
+	dstAreaList, dstIEs := pwsAreaListOf(dst)
+	srcAreaList, _ := pwsAreaListOf(src)
+	if srcAreaList == nil {
+		return
+	}
+	if dstAreaList == nil {
+		// the first response has no area list, take the one of src
+		if ie := pwsAreaListIEOf(src); ie.IsValid() && dstIEs.IsValid() {
+			dstIEs.Set(reflect.Append(dstIEs, ie))
+		}
+		return
+	}
+
+	// the area lists are CHOICEs of lists, which are merged if the same alternative is present
+	dstChoice, srcChoice := reflect.ValueOf(dstAreaList).Elem(), reflect.ValueOf(srcAreaList).Elem()
+	if dstChoice.FieldByName("Present").Int() != srcChoice.FieldByName("Present").Int() {
+		logger.CommLog.Warnln("PWS responses have different kinds of area list, which are not merged")
+		return
+	}
+	for i := 0; i < dstChoice.NumField(); i++ {
+		dstField, srcField := dstChoice.Field(i), srcChoice.Field(i)
+		if dstField.Kind() != reflect.Ptr || dstField.IsNil() || srcField.IsNil() {
+			continue
+		}
+		dstList, srcList := dstField.Elem().FieldByName("List"), srcField.Elem().FieldByName("List")
+		if dstList.IsValid() && srcList.IsValid() {
+			dstList.Set(reflect.AppendSlice(dstList, srcList))
+		}
+	}
+}
+
+// pwsAreaListOf returns the Broadcast Completed or Cancelled Area List of a Write-Replace
+// Warning or PWS Cancel Response, and the IE list of the response
+func pwsAreaListOf(pdu *ngapType.NGAPPDU) (areaList interface{}, ies reflect.Value) {
+	if pdu.SuccessfulOutcome == nil {
+		return nil, ies
+	}
+	switch value := pdu.SuccessfulOutcome.Value; {
+	case value.WriteReplaceWarningResponse != nil:
+		ies = reflect.ValueOf(&value.WriteReplaceWarningResponse.ProtocolIEs.List).Elem()
+		for _, ie := range value.WriteReplaceWarningResponse.ProtocolIEs.List {
+			if ie.Id.Value == ngapType.ProtocolIEIDBroadcastCompletedAreaList && ie.Value.BroadcastCompletedAreaList != nil {
+				return ie.Value.BroadcastCompletedAreaList, ies
+			}
+		}
+	case value.PWSCancelResponse != nil:
+		ies = reflect.ValueOf(&value.PWSCancelResponse.ProtocolIEs.List).Elem()
+		for _, ie := range value.PWSCancelResponse.ProtocolIEs.List {
+			if ie.Id.Value == ngapType.ProtocolIEIDBroadcastCancelledAreaList && ie.Value.BroadcastCancelledAreaList != nil {
+				return ie.Value.BroadcastCancelledAreaList, ies
+			}
+		}
+	}
+	return nil, ies
+}
+
+// pwsAreaListIEOf returns the IE carrying the area list of a response
+func pwsAreaListIEOf(pdu *ngapType.NGAPPDU) reflect.Value {
+	_, ies := pwsAreaListOf(pdu)
+	if !ies.IsValid() {
+		return ies
+	}
+	for i := 0; i < ies.Len(); i++ {
+		id := ies.Index(i).FieldByName("Id").FieldByName("Value").Int()
+		if id == ngapType.ProtocolIEIDBroadcastCompletedAreaList || id == ngapType.ProtocolIEIDBroadcastCancelledAreaList {
+			return ies.Index(i)
+		}
+	}
+	return reflect.Value{}
+}
+
+// TS 29.518 5.2.2.4.2
+func HandleNonUeN2InfoSubscribeRequest(request *http_wrapper.Request) *http_wrapper.Response {
+	logger.CommLog.Info("Handle Non Ue N2 Info Subscribe Request")
+
+	nonUeN2InfoSubscriptionCreateData := request.Body.(models.NonUeN2InfoSubscriptionCreateData)
+
+	nonUeN2InfoSubscriptionCreatedData, locationHeader, problemDetails :=
+		NonUeN2InfoSubscribeProcedure(nonUeN2InfoSubscriptionCreateData)
+	if problemDetails != nil {
+		return http_wrapper.NewResponse(int(problemDetails.Status), nil, problemDetails)
+	}
+
+	headers := http.Header{
+		"Location": {locationHeader},
+	}
+	return http_wrapper.NewResponse(http.StatusCreated, headers, nonUeN2InfoSubscriptionCreatedData)
+}
+
+func NonUeN2InfoSubscribeProcedure(nonUeN2InfoSubscriptionCreateData models.NonUeN2InfoSubscriptionCreateData) (
+	*models.NonUeN2InfoSubscriptionCreatedData, string, *models.ProblemDetails) {
+	amfSelf := context.AMF_Self()
+
+	if nonUeN2InfoSubscriptionCreateData.N2NotifyCallbackUri == "" {
+		problemDetails := &models.ProblemDetails{
+			Status: http.StatusBadRequest,
+			Cause:  "MANDATORY_IE_MISSING",
+			Detail: "n2NotifyCallbackUri is missing",
+		}
+		return nil, "", problemDetails
+	}
+
+	subscriptionID := amfSelf.NewNonUeN2InfoSubscription(nonUeN2InfoSubscriptionCreateData)
+	if subscriptionID == "" {
+		problemDetails := &models.ProblemDetails{
+			Status: http.StatusInternalServerError,
+			Cause:  "SYSTEM_FAILURE",
+		}
+		return nil, "", problemDetails
+	}
+	logger.CommLog.Infof("new Non Ue N2 Info Subscription[%s] of class %s", subscriptionID,
+		nonUeN2InfoSubscriptionCreateData.N2InformationClass)
+
+	nonUeN2InfoSubscriptionCreatedData := &models.NonUeN2InfoSubscriptionCreatedData{
+		N2NotifySubscriptionId: subscriptionID,
+	}
+	locationHeader := amfSelf.GetIPv4Uri() + "/namf-comm/v1/non-ue-n2-messages/subscriptions/" + subscriptionID
+	return nonUeN2InfoSubscriptionCreatedData, locationHeader, nil
+}
+
+// TS 29.518 5.2.2.4.3
+func HandleNonUeN2InfoUnSubscribeRequest(request *http_wrapper.Request) *http_wrapper.Response {
+	logger.CommLog.Info("Handle Non Ue N2 Info UnSubscribe Request")
+
+	subscriptionID := request.Params["n2NotifySubscriptionId"]
+
+	problemDetails := NonUeN2InfoUnSubscribeProcedure(subscriptionID)
+	if problemDetails != nil {
+		return http_wrapper.NewResponse(int(problemDetails.Status), nil, problemDetails)
+	} else {
+		return http_wrapper.NewResponse(http.StatusNoContent, nil, nil)
+	}
+}
+
+func NonUeN2InfoUnSubscribeProcedure(subscriptionID string) *models.ProblemDetails {
+	amfSelf := context.AMF_Self()
+
+	if _, ok := amfSelf.FindNonUeN2InfoSubscription(subscriptionID); !ok {
+		problemDetails := &models.ProblemDetails{
+			Status: http.StatusNotFound,
+			Cause:  "SUBSCRIPTION_NOT_FOUND",
+		}
+		return problemDetails
+	}
+	logger.CommLog.Debugf("Delete Non Ue N2 Info subscription[%s]", subscriptionID)
+	amfSelf.DeleteNonUeN2InfoSubscription(subscriptionID)
+	return nil
+}
@@ -120,3 +120,22 @@ func buildUEContext(ue *context.AmfUe, accessType models.AccessType) *UEContext
 	}
 	return nil
 }
+
+func HandleOAMRanEvents(request *http_wrapper.Request) *http_wrapper.Response {
+	logger.ProducerLog.Infof("[OAM] Handle RAN Events")
+
+	ranEvents := context.AMF_Self().RanEvents()
+	return http_wrapper.NewResponse(http.StatusOK, nil, ranEvents)
+}
+
+func HandleOAMRanSendStatistics(request *http_wrapper.Request) *http_wrapper.Response {
+	logger.ProducerLog.Infof("[OAM] Handle RAN Send Statistics")
+
+	ranSendStatistics := []context.RanSendStatistics{}
+	context.AMF_Self().AmfRanPool.Range(func(key, value interface{}) bool {
+		ran := value.(*context.AmfRan)
+		ranSendStatistics = append(ranSendStatistics, ran.SendStatistics())
+		return true
+	})
+	return http_wrapper.NewResponse(http.StatusOK, nil, ranSendStatistics)
+}
@@ -116,7 +116,7 @@ func AMFStatusChangeSubscribeModifyProcedure(subscriptionID string, subscription
 		currentSubscriptionData.GuamiList = append(currentSubscriptionData.GuamiList, subscriptionData.GuamiList...)
 		currentSubscriptionData.AmfStatusUri = subscriptionData.AmfStatusUri
 
-		amfSelf.AMFStatusSubscriptions.Store(subscriptionID, currentSubscriptionData)
+		amfSelf.UpdateAMFStatusSubscription(subscriptionID, *currentSubscriptionData)
 		return currentSubscriptionData, nil
 	}
 }
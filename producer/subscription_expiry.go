@@ -0,0 +1,114 @@
+package producer
+
+import (
+	"free5gc/lib/openapi/models"
+	"free5gc/src/amf/context"
+	"free5gc/src/amf/logger"
+	"sync"
+	"time"
+)
+
+// subscriptionReapInterval is how often the expired event subscriptions are removed
+const subscriptionReapInterval = 10 * time.Second
+
+var subscriptionReaper struct {
+	mutex sync.Mutex
+	stop  chan struct{}
+}
+
+// RestoreSubscriptions reloads the subscriptions of the subscription store, and resumes the periodic
+// reports of the event subscriptions
+func RestoreSubscriptions() {
+	amfSelf := context.AMF_Self()
+
+	eventSubscriptionMutex.Lock()
+	defer unlockEventSubscriptions()
+
+	subscriptionIDs, err := amfSelf.LoadSubscriptions()
+	if err != nil {
+		logger.EeLog.Errorf("Reload subscriptions error: %+v", err)
+		return
+	}
+	for _, subscriptionID := range subscriptionIDs {
+		if subscription, ok := amfSelf.FindEventSubscription(subscriptionID); ok {
+			startPeriodicReport(subscriptionID, subscription)
+		}
+	}
+}
+
+// StartSubscriptionReaper starts removing the event subscriptions once expired
+func StartSubscriptionReaper() {
+	r := &subscriptionReaper
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.stop != nil {
+		return
+	}
+	r.stop = make(chan struct{})
+	go func(stop chan struct{}) {
+		ticker := time.NewTicker(subscriptionReapInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				reapExpiredEventSubscriptions()
+			case <-stop:
+				return
+			}
+		}
+	}(r.stop)
+}
+
+// StopSubscriptionReaper stops removing the expired event subscriptions
+func StopSubscriptionReaper() {
+	r := &subscriptionReaper
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.stop != nil {
+		close(r.stop)
+		r.stop = nil
+	}
+}
+
+// reapExpiredEventSubscriptions removes the expired event subscriptions, whose subscribers are told
+// that they are no longer active by a final report of each event
+func reapExpiredEventSubscriptions() {
+	amfSelf := context.AMF_Self()
+
+	eventSubscriptionMutex.Lock()
+	defer unlockEventSubscriptions()
+
+	now := time.Now()
+	amfSelf.EventSubscriptions.Range(func(key, value interface{}) bool {
+		subscriptionID := key.(string)
+		subscription := value.(*context.AMFContextEventSubscription)
+		if subscription.Expiry == nil || now.Before(*subscription.Expiry) {
+			return true
+		}
+		logger.EeLog.Infof("Event subscription[%s] expired", subscriptionID)
+		sendFinalReports(subscription)
+		deleteEventSubscription(subscriptionID, subscription)
+		return true
+	})
+}
+
+// sendFinalReports reports the events of an expired subscription as inactive; a one time subscription
+// ends at its report instead
+func sendFinalReports(subscription *context.AMFContextEventSubscription) {
+	eventSubscription := &subscription.EventSubscription
+	if eventSubscription.EventList == nil ||
+		(eventSubscription.Options != nil && eventSubscription.Options.Trigger == models.AmfEventTrigger_ONE_TIME) {
+		return
+	}
+	timeStamp := time.Now().UTC()
+	for _, event := range *eventSubscription.EventList {
+		report := models.AmfEventReport{
+			Type:      event.Type,
+			State:     &models.AmfEventState{Active: false},
+			TimeStamp: &timeStamp,
+			AnyUe:     subscription.IsAnyUe,
+			Supi:      eventSubscription.Supi,
+		}
+		sendEventReport(subscription, report)
+	}
+}
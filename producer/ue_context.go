@@ -474,6 +474,14 @@ func RegistrationStatusUpdateProcedure(ueContextID string, ueRegStatusUpdateReqD
 			} else if err != nil {
 				logger.GmmLog.Errorf("AM Policy Control Delete Error[%v]", err.Error())
 			}
+			if ue.UePolicyAssociation != nil {
+				problem, err := consumer.UEPolicyControlDelete(ue)
+				if problem != nil {
+					logger.GmmLog.Errorf("UE Policy Control Delete Failed Problem[%+v]", problem)
+				} else if err != nil {
+					logger.GmmLog.Errorf("UE Policy Control Delete Error[%v]", err.Error())
+				}
+			}
 		}
 
 		ue.Remove()
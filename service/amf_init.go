@@ -8,8 +8,10 @@ import (
 	"os/signal"
 	"sync"
 	"syscall"
+	"time"
 
 	"github.com/gin-contrib/cors"
+	"github.com/gin-gonic/gin"
 	"github.com/sirupsen/logrus"
 	"github.com/urfave/cli"
 
@@ -17,6 +19,7 @@ import (
 	"free5gc/lib/logger_util"
 	"free5gc/lib/openapi/models"
 	"free5gc/lib/path_util"
+	"free5gc/src/amf/capture"
 	"free5gc/src/amf/communication"
 	"free5gc/src/amf/consumer"
 	"free5gc/src/amf/context"
@@ -30,6 +33,7 @@ import (
 	ngap_message "free5gc/src/amf/ngap/message"
 	ngap_service "free5gc/src/amf/ngap/service"
 	"free5gc/src/amf/oam"
+	"free5gc/src/amf/producer"
 	"free5gc/src/amf/producer/callback"
 	"free5gc/src/amf/util"
 	"free5gc/src/app"
@@ -132,6 +136,11 @@ func (amf *AMF) Start() {
 		AllowAllOrigins:  true,
 		MaxAge:           86400,
 	}))
+	router.Use(func(c *gin.Context) {
+		context.SbiRequestStarted()
+		defer context.SbiRequestDone()
+		c.Next()
+	})
 
 	httpcallback.AddService(router)
 	oam.AddService(router)
@@ -153,7 +162,30 @@ func (amf *AMF) Start() {
 
 	addr := fmt.Sprintf("%s:%d", self.BindingIPv4, self.SBIPort)
 
-	ngap_service.Run(self.NgapIpList, 38412, ngap.Dispatch)
+	if self.CaptureConfig.File != "" {
+		if err := capture.Start(self.CaptureConfig); err != nil {
+			initLog.Errorf("Capture error: %+v", err)
+		}
+	}
+
+	context.SetAmfEventHandler(producer.NotifyAmfEvent)
+	context.SetPendingN1N2MessageHandler(producer.TransferPendingN1N2Messages)
+	producer.RestoreSubscriptions()
+	producer.StartSubscriptionReaper()
+
+	ngap.SetDispatcherQueueSize(self.NgapUeQueueSize, self.NgapRanQueueSize)
+	ngap_service.SetMaxMessageSize(self.NgapMaxMessageSize)
+	if transport, err := ngap_service.NewTransport(self.NgapTransport, self.NgapTransportOptions); err != nil {
+		initLog.Errorf("NGAP transport error: %+v", err)
+	} else {
+		ngapHandler := ngap_service.Handler{
+			HandleMessage:          ngap.Dispatch,
+			HandleEvent:            ngap.HandleAssociationEvent,
+			HandleOversizedMessage: ngap.HandleOversizedMessage,
+		}
+		ngap_service.Run(transport, self.NgapAddressSets, self.NgapPort, ngapHandler)
+	}
+	ngap.StartOverloadControl()
 
 	// Register to NRF
 	var profile models.NfProfile
@@ -256,6 +288,9 @@ func (amf *AMF) Terminate() {
 
 	// TODO: forward registered UE contexts to target AMF in the same AMF set if there is one
 
+	ngap.StopOverloadControl()
+	producer.StopSubscriptionReaper()
+
 	// deregister with NRF
 	problemDetails, err := consumer.SendDeregisterNFInstance()
 	if problemDetails != nil {
@@ -274,8 +309,23 @@ func (amf *AMF) Terminate() {
 		ngap_message.SendAMFStatusIndication(ran, unavailableGuamiList)
 		return true
 	})
+	// the indications are written by the senders of the RANs, before the connections are closed
+	flushDeadline := time.Now().Add(time.Second)
+	amfSelf.AmfRanPool.Range(func(key, value interface{}) bool {
+		ran := value.(*context.AmfRan)
+		if !ran.FlushSendQueue(time.Until(flushDeadline)) {
+			logger.InitLog.Warnf("AMF Status Indication to RAN[Name: %s] may not be sent", ran.Name)
+		}
+		return true
+	})
 
 	ngap_service.Stop()
+	capture.Stop()
+	if amfSelf.SubscriptionStore != nil {
+		if err := amfSelf.SubscriptionStore.Close(); err != nil {
+			logger.InitLog.Errorf("Close subscription store error: %+v", err)
+		}
+	}
 
 	callback.SendAmfStatusChangeNotify((string)(models.StatusChange_UNAVAILABLE), amfSelf.ServedGuamiList)
 	logger.InitLog.Infof("AMF terminated")
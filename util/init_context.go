@@ -2,15 +2,19 @@ package util
 
 import (
 	"fmt"
+	"math"
 	"os"
+	"regexp"
 
 	"github.com/google/uuid"
 
 	"free5gc/lib/nas/security"
 	"free5gc/lib/openapi/models"
+	"free5gc/src/amf/capture"
 	"free5gc/src/amf/context"
 	"free5gc/src/amf/factory"
 	"free5gc/src/amf/logger"
+	ngap_service "free5gc/src/amf/ngap/service"
 )
 
 func InitAmfContext(context *context.AMFContext) {
@@ -26,6 +30,69 @@ func InitAmfContext(context *context.AMFContext) {
 	} else {
 		context.NgapIpList = []string{"127.0.0.1"} // default localhost
 	}
+	context.NgapTransport = "sctp"     // default transport
+	context.NgapPort = 38412           // default NGAP port
+	context.NgapUeQueueSize = 64       // default per-UE queue length
+	context.NgapRanQueueSize = 256     // default per-RAN queue length
+	context.NgapMaxMessageSize = 65536 // default maximum NGAP message size
+	context.NgapSendQueueSize = 256    // default per-RAN outbound queue length
+	context.NgapWriteTimeout = 3000    // default write timeout, unit is millisecond
+	// the largest INIT retransmission timeout keeps the default of the system, 60 seconds on Linux
+	context.NgapTransportOptions = ngap_service.TransportOptions{
+		NumOutStreams: 3,
+		MaxInStreams:  5,
+		MaxAttempts:   4,
+	}
+	context.NgapAddressSets = [][]string{context.NgapIpList}
+	if ngap := configuration.Ngap; ngap != nil {
+		if ngap.Transport != "" {
+			context.NgapTransport = ngap.Transport
+		}
+		if ngap.Port > 0 {
+			context.NgapPort = ngap.Port
+		}
+		if len(ngap.AddressSets) > 0 {
+			context.NgapAddressSets = ngap.AddressSets
+		}
+		initNgapTransportOptions(&context.NgapTransportOptions, ngap)
+		if ngap.UeQueueSize > 0 {
+			context.NgapUeQueueSize = ngap.UeQueueSize
+		}
+		if ngap.RanQueueSize > 0 {
+			context.NgapRanQueueSize = ngap.RanQueueSize
+		}
+		if ngap.MaxMessageSize > 0 {
+			context.NgapMaxMessageSize = ngap.MaxMessageSize
+		}
+		if ngap.SendQueueSize > 0 {
+			context.NgapSendQueueSize = ngap.SendQueueSize
+		}
+		if ngap.WriteTimeout > 0 {
+			context.NgapWriteTimeout = ngap.WriteTimeout
+		}
+	}
+	if c := configuration.Capture; c != nil {
+		context.CaptureConfig = capture.Config{
+			File:         c.File,
+			MaxFileSize:  int64(c.MaxFileSize) * 1024 * 1024,
+			MaxFiles:     c.MaxFiles,
+			NasPlaintext: c.NasPlaintext,
+		}
+	}
+	if subscriptionStore := configuration.SubscriptionStore; subscriptionStore != nil {
+		context.SubscriptionStore = initSubscriptionStore(subscriptionStore)
+	}
+	if ranAdmission := configuration.RanAdmission; ranAdmission != nil {
+		initRanAdmissionPolicy(&context.RanAdmissionPolicy, ranAdmission)
+	}
+	context.OverloadControl.Interval = 1000     // default overload check interval, unit is millisecond
+	context.OverloadControl.StartThreshold = 90 // default overload start, percent of the load
+	context.OverloadControl.StopThreshold = 70  // default overload stop, percent of the load
+	// default relative capacity advertised while overloaded, half of the full capacity
+	context.OverloadControl.RelativeCapacity = 0x7f
+	if overloadControl := configuration.OverloadControl; overloadControl != nil {
+		initOverloadControl(&context.OverloadControl, overloadControl)
+	}
 	sbi := configuration.Sbi
 	if sbi.Scheme != "" {
 		context.UriScheme = models.UriScheme(sbi.Scheme)
@@ -60,6 +127,12 @@ func InitAmfContext(context *context.AMFContext) {
 	for i := range context.SupportTaiLists {
 		context.SupportTaiLists[i].Tac = TACConfigToModels(context.SupportTaiLists[i].Tac)
 	}
+	for _, presenceReportingArea := range configuration.PresenceReportingAreaList {
+		for i := range presenceReportingArea.TrackingAreaList {
+			presenceReportingArea.TrackingAreaList[i].Tac = TACConfigToModels(presenceReportingArea.TrackingAreaList[i].Tac)
+		}
+		context.PresenceReportingAreas[presenceReportingArea.PraId] = presenceReportingArea
+	}
 	context.PlmnSupportList = configuration.PlmnSupportList
 	context.SupportDnnLists = configuration.SupportDnnList
 	if configuration.NrfURI != "" {
@@ -113,3 +186,96 @@ func getEncAlgOrder(cipheringOrder []string) (encOrder []uint8) {
 	}
 	return
 }
+
+func initNgapTransportOptions(options *ngap_service.TransportOptions, ngap *factory.Ngap) {
+	options.Ipv6 = ngap.Ipv6
+	if ngap.NumOutStreams > 0 && ngap.NumOutStreams <= math.MaxUint16 {
+		options.NumOutStreams = uint16(ngap.NumOutStreams)
+	}
+	if ngap.MaxInStreams > 0 && ngap.MaxInStreams <= math.MaxUint16 {
+		options.MaxInStreams = uint16(ngap.MaxInStreams)
+	}
+	if ngap.MaxAttempts > 0 && ngap.MaxAttempts <= math.MaxUint16 {
+		options.MaxAttempts = uint16(ngap.MaxAttempts)
+	}
+	if ngap.MaxInitTimeout > 0 && ngap.MaxInitTimeout <= math.MaxUint16 {
+		options.MaxInitTimeout = uint16(ngap.MaxInitTimeout)
+	}
+	if ngap.RtoInitial > 0 {
+		options.RtoInitial = uint32(ngap.RtoInitial)
+	}
+	if ngap.RtoMin > 0 {
+		options.RtoMin = uint32(ngap.RtoMin)
+	}
+	if ngap.RtoMax > 0 {
+		options.RtoMax = uint32(ngap.RtoMax)
+	}
+	if ngap.HeartbeatInterval > 0 {
+		options.HeartbeatInterval = uint32(ngap.HeartbeatInterval)
+	}
+	if ngap.PathMaxRetrans > 0 && ngap.PathMaxRetrans <= math.MaxUint16 {
+		options.PathMaxRetrans = uint16(ngap.PathMaxRetrans)
+	}
+}
+
+func initRanAdmissionPolicy(policy *context.RanAdmissionPolicy, ranAdmission *factory.RanAdmission) {
+	policy.AllowList = ranAdmission.AllowList
+	policy.DenyList = ranAdmission.DenyList
+	// the patterns are checked when the configuration is loaded
+	for _, pattern := range ranAdmission.RanNamePatterns {
+		policy.RanNamePatterns = append(policy.RanNamePatterns, regexp.MustCompile(pattern))
+	}
+	policy.MaxRansPerPlmn = make(map[models.PlmnId]int)
+	for _, limit := range ranAdmission.MaxRansPerPlmn {
+		policy.MaxRansPerPlmn[limit.PlmnId] = limit.MaxNumOfRans
+	}
+	policy.TimeToWait = ranAdmission.TimeToWait
+}
+
+// initSubscriptionStore opens the configured subscription store; the subscriptions are kept in
+// memory only if it cannot be opened
+func initSubscriptionStore(subscriptionStore *factory.SubscriptionStore) context.SubscriptionStore {
+	store, err := context.NewSubscriptionStore(subscriptionStore.Type, subscriptionStore.Path)
+	if err != nil {
+		logger.UtilLog.Errorf("Subscription store error: %+v", err)
+		return nil
+	}
+	return store
+}
+
+func initOverloadControl(control *context.OverloadControl, overloadControl *factory.OverloadControl) {
+	control.Enable = overloadControl.Enable
+	if overloadControl.Interval > 0 {
+		control.Interval = overloadControl.Interval
+	}
+	control.UeCapacity = overloadControl.UeCapacity
+	control.MaxQueuedMessages = overloadControl.MaxQueuedMessages
+	control.MaxSbiRequests = overloadControl.MaxSbiRequests
+	control.MaxCpuLoad = overloadControl.MaxCpuLoad
+	if overloadControl.StartThreshold > 0 {
+		control.StartThreshold = overloadControl.StartThreshold
+	}
+	if overloadControl.StopThreshold > 0 {
+		control.StopThreshold = overloadControl.StopThreshold
+	}
+	if control.StopThreshold > control.StartThreshold {
+		logger.UtilLog.Warnf("Overload stop threshold %d%% is above the start threshold %d%%, use %d%%",
+			control.StopThreshold, control.StartThreshold, control.StartThreshold)
+		control.StopThreshold = control.StartThreshold
+	}
+	control.OverloadAction = overloadControl.OverloadAction
+	if overloadControl.TrafficLoadReduction >= 1 && overloadControl.TrafficLoadReduction <= 99 {
+		control.TrafficLoadReduction = int64(overloadControl.TrafficLoadReduction)
+	} else if overloadControl.TrafficLoadReduction != 0 {
+		logger.UtilLog.Errorf("Traffic load reduction %d%% out of range (should be 1 ~ 99)",
+			overloadControl.TrafficLoadReduction)
+	}
+	control.SNssaiList = overloadControl.SNssaiList
+	if relativeCapacity := overloadControl.RelativeCapacity; relativeCapacity != nil {
+		if *relativeCapacity >= 0 && *relativeCapacity <= 0xff {
+			control.RelativeCapacity = int64(*relativeCapacity)
+		} else {
+			logger.UtilLog.Errorf("Relative capacity %d out of range (should be 0 ~ 255)", *relativeCapacity)
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package util
+
+import (
+	"crypto/tls"
+	"free5gc/lib/openapi/models"
+	"free5gc/src/amf/context"
+	"free5gc/src/amf/logger"
+	"net/http"
+	"sync"
+)
+
+var (
+	sbiClient     *http.Client
+	sbiClientOnce sync.Once
+)
+
+// SbiClient returns the HTTP client of the SBI requests for which there is no generated client.
+// When the SBI of the AMF uses https, the client presents the certificate of the AMF server; like
+// the generated clients, it does not verify the certificates of the other NFs.
+func SbiClient() *http.Client {
+	sbiClientOnce.Do(func() {
+		tlsConfig := &tls.Config{InsecureSkipVerify: true}
+		if context.AMF_Self().UriScheme == models.UriScheme_HTTPS {
+			if certificate, err := tls.LoadX509KeyPair(AmfPemPath, AmfKeyPath); err != nil {
+				logger.UtilLog.Errorf("Load SBI client certificate error: %+v", err)
+			} else {
+				tlsConfig.Certificates = []tls.Certificate{certificate}
+			}
+		}
+		sbiClient = &http.Client{
+			Transport: &http.Transport{
+				TLSClientConfig:   tlsConfig,
+				ForceAttemptHTTP2: true,
+			},
+		}
+	})
+	return sbiClient
+}